@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/proxy"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/ssl"
+	"github.com/spf13/cobra"
+)
+
+var certCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Manage the proxy TLS certificate",
+}
+
+var certGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a self-signed certificate into the cache directory",
+	Args:  cobra.NoArgs,
+	RunE:  runCertGenerate,
+}
+
+var certShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the current certificate",
+	Args:  cobra.NoArgs,
+	RunE:  runCertShow,
+}
+
+var certRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the cached self-signed certificate with a new one",
+	Long: `Replace the cached self-signed certificate with a new one.
+
+A running server keeps serving its current certificate until it is restarted.`,
+	Args: cobra.NoArgs,
+	RunE: runCertRotate,
+}
+
+var certExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the current certificate and private key as PEM",
+	Args:  cobra.NoArgs,
+	RunE:  runCertExport,
+}
+
+var certCACmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the local certificate authority",
+}
+
+var certCAExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the root CA certificate for installation on client devices",
+	Long: `Export the root CA certificate for installation on client devices.
+
+Formats:
+  pem  PEM certificate (Linux, Android, most tools)
+  der  DER certificate (Windows, iOS, Android)
+  p12  PKCS#12 trust store (Java, Windows); protected by --p12-password
+
+The root private key is never exported.`,
+	Args: cobra.NoArgs,
+	RunE: runCertCAExport,
+}
+
+func init() {
+	certGenerateCmd.Flags().Bool("force", false, "Replace an existing cached certificate")
+	certShowCmd.Flags().String("file", "", "Show a PEM certificate file instead of the configured certificate")
+	certExportCmd.Flags().String("cert-out", "", "Certificate output file (default stdout)")
+	certExportCmd.Flags().String("key-out", "", "Private key output file (required to export the key)")
+
+	certCAExportCmd.Flags().String("format", "pem", "Export format: pem, der or p12")
+	certCAExportCmd.Flags().StringP("out", "o", "", "Output file (default stdout)")
+	certCAExportCmd.Flags().String("p12-password", "", "Password for the PKCS#12 trust store")
+
+	certCACmd.AddCommand(certCAExportCmd)
+	certCmd.AddCommand(certGenerateCmd, certShowCmd, certRotateCmd, certExportCmd, certCACmd)
+}
+
+// certConfig loads the effective configuration and its certificate
+// settings
+func certConfig(cmd *cobra.Command) (*ssl.Config, *config.Config, error) {
+	eff, err := config.LoadEffective(cmd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuration error: %w", err)
+	}
+	cfg := eff.Config
+
+	if err := cfg.SSL.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid ssl configuration: %w", err)
+	}
+	return proxy.SSLConfig(cfg), cfg, nil
+}
+
+// certManager creates a certificate manager from the effective
+// configuration, which generates or loads the certificate; read-only
+// commands use loadCertificate instead
+func certManager(cmd *cobra.Command) (*ssl.Manager, *config.Config, error) {
+	sslCfg, cfg, err := certConfig(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manager, err := ssl.NewManager(sslCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create SSL manager: %w", err)
+	}
+	return manager, cfg, nil
+}
+
+// loadCertificate reads the configured certificate from its files or the
+// cache without generating one
+func loadCertificate(cmd *cobra.Command) (*tls.Certificate, error) {
+	sslCfg, cfg, err := certConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := ssl.LoadCertificate(sslCfg)
+	if err != nil {
+		if cfg.SSL.AutoGenerate || cfg.SSL.ACME.Enabled {
+			return nil, fmt.Errorf("%w (run `cert generate` or start the proxy first)", err)
+		}
+		return nil, err
+	}
+	return cert, nil
+}
+
+func runCertGenerate(cmd *cobra.Command, args []string) error {
+	manager, cfg, err := certManager(cmd)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	if !cfg.SSL.AutoGenerate {
+		return fmt.Errorf("ssl.auto_generate is disabled, certificates are loaded from %s", cfg.SSL.CertFile)
+	}
+
+	// The manager already loaded a cached certificate or generated one
+	force, _ := cmd.Flags().GetBool("force")
+	if force {
+		if err := manager.RotateCertificates(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Certificate cached in %s\n\n", cfg.SSL.CacheDir)
+	printCertificateInfo(cmd.OutOrStdout(), manager.GetCertificateInfo())
+	return nil
+}
+
+func runCertShow(cmd *cobra.Command, args []string) error {
+	if file, _ := cmd.Flags().GetString("file"); file != "" {
+		return showCertificateFile(cmd.OutOrStdout(), file)
+	}
+
+	cert, err := loadCertificate(cmd)
+	if err != nil {
+		return err
+	}
+	info, err := ssl.DescribeCertificate(cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	printCertificateInfo(cmd.OutOrStdout(), info)
+	return nil
+}
+
+func runCertRotate(cmd *cobra.Command, args []string) error {
+	manager, cfg, err := certManager(cmd)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	if err := manager.RotateCertificates(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Certificate rotated in %s\n\n", cfg.SSL.CacheDir)
+	printCertificateInfo(cmd.OutOrStdout(), manager.GetCertificateInfo())
+	return nil
+}
+
+func runCertExport(cmd *cobra.Command, args []string) error {
+	certOut, _ := cmd.Flags().GetString("cert-out")
+	keyOut, _ := cmd.Flags().GetString("key-out")
+
+	cert, err := loadCertificate(cmd)
+	if err != nil {
+		return err
+	}
+
+	certPEM, keyPEM, err := ssl.EncodePEM(cert)
+	if err != nil {
+		return fmt.Errorf("failed to export certificate: %w", err)
+	}
+
+	if certOut == "" {
+		cmd.OutOrStdout().Write(certPEM)
+	} else {
+		if err := os.WriteFile(certOut, certPEM, 0644); err != nil {
+			return fmt.Errorf("failed to write certificate: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Certificate written to %s\n", certOut)
+	}
+
+	// The private key is never written to stdout
+	if keyOut != "" {
+		if err := os.WriteFile(keyOut, keyPEM, 0600); err != nil {
+			return fmt.Errorf("failed to write private key: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Private key written to %s\n", keyOut)
+	}
+
+	return nil
+}
+
+func runCertCAExport(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	out, _ := cmd.Flags().GetString("out")
+	password, _ := cmd.Flags().GetString("p12-password")
+
+	sslCfg, cfg, err := certConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if !cfg.SSL.CA.Enabled {
+		return fmt.Errorf("local CA is not enabled (set ssl.ca.enabled)")
+	}
+
+	ca, err := ssl.ReadCA(sslCfg)
+	if err != nil {
+		return fmt.Errorf("%w (the root CA is created when the proxy or `cert generate` first runs)", err)
+	}
+
+	var data []byte
+	switch strings.ToLower(format) {
+	case "pem":
+		data = ca.PEM()
+	case "der":
+		data = ca.DER()
+	case "p12", "pkcs12":
+		if data, err = ca.PKCS12(password); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q (must be pem, der or p12)", format)
+	}
+
+	if out == "" {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("failed to write root certificate: %w", err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Root CA written to %s\nSHA-256: %s\n", out, ca.Fingerprint())
+	return nil
+}
+
+// printCertificateInfo prints a certificate description
+func printCertificateInfo(w io.Writer, info *ssl.CertificateInfo) {
+	if info == nil {
+		fmt.Fprintln(w, "No certificate available")
+		return
+	}
+
+	ips := make([]string, len(info.IPAddresses))
+	for i, ip := range info.IPAddresses {
+		ips[i] = ip.String()
+	}
+
+	fmt.Fprintf(w, "Subject:      %s\n", info.Subject)
+	fmt.Fprintf(w, "Issuer:       %s\n", info.Issuer)
+	fmt.Fprintf(w, "Not Before:   %s\n", info.NotBefore.UTC().Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, "Not After:    %s\n", info.NotAfter.UTC().Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, "DNS Names:    %s\n", strings.Join(info.DNSNames, ", "))
+	fmt.Fprintf(w, "IP Addresses: %s\n", strings.Join(ips, ", "))
+	fmt.Fprintf(w, "Key Type:     %s\n", info.KeyType)
+	fmt.Fprintf(w, "SHA-256:      %s\n", info.SHA256Fingerprint)
+}
+
+// showCertificateFile prints every certificate in a PEM file
+func showCertificateFile(w io.Writer, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate file: %w", err)
+	}
+
+	found := false
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+
+		if found {
+			fmt.Fprintln(w)
+		}
+		found = true
+
+		ips := make([]string, len(cert.IPAddresses))
+		for i, ip := range cert.IPAddresses {
+			ips[i] = ip.String()
+		}
+		fingerprint := sha256.Sum256(cert.Raw)
+
+		fmt.Fprintf(w, "Subject:      %s\n", cert.Subject)
+		fmt.Fprintf(w, "Issuer:       %s\n", cert.Issuer)
+		fmt.Fprintf(w, "Serial:       %s\n", cert.SerialNumber.Text(16))
+		fmt.Fprintf(w, "Not Before:   %s\n", cert.NotBefore.UTC().Format("2006-01-02 15:04:05 MST"))
+		fmt.Fprintf(w, "Not After:    %s\n", cert.NotAfter.UTC().Format("2006-01-02 15:04:05 MST"))
+		fmt.Fprintf(w, "DNS Names:    %s\n", strings.Join(cert.DNSNames, ", "))
+		fmt.Fprintf(w, "IP Addresses: %s\n", strings.Join(ips, ", "))
+		fmt.Fprintf(w, "SHA-256:      %s\n", hex.EncodeToString(fingerprint[:]))
+	}
+
+	if !found {
+		return fmt.Errorf("no certificate found in %s", file)
+	}
+	return nil
+}
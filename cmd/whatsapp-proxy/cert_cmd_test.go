@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCertShowAndExportOnlyRead(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	path := writeConfig(t, "ssl:\n  cache_dir: "+cacheDir+"\n")
+
+	// Nothing is generated or created before cert generate
+	for _, args := range [][]string{
+		{"cert", "show", "--config", path},
+		{"cert", "export", "--config", path},
+	} {
+		if _, err := execute(t, args...); err == nil {
+			t.Errorf("%s succeeded without a certificate", strings.Join(args[:2], " "))
+		}
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Fatalf("cache directory exists after show and export: %v", err)
+	}
+
+	if _, err := execute(t, "cert", "generate", "--config", path); err != nil {
+		t.Fatalf("cert generate error = %v", err)
+	}
+
+	out, err := execute(t, "cert", "show", "--config", path)
+	if err != nil || !strings.Contains(out, "Subject:") {
+		t.Errorf("cert show = %v:\n%s", err, out)
+	}
+	out, err = execute(t, "cert", "export", "--config", path)
+	if err != nil || !strings.HasPrefix(out, "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("cert export = %v:\n%s", err, out)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and validate configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration and report every problem",
+	Long: `Validate the configuration and report every error and warning, with the
+setting's path and the config file and line that set it.
+
+Exits non-zero if any error is found; warnings alone do not fail.
+With --offline, only the configuration itself is checked: no DNS lookups and
+no file system access, for CI and air-gapped or read-only environments.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigValidate,
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration and where each value came from",
+	Long: `Print the effective configuration merged from defaults, the config files,
+profiles, environment variables and command-line flags.
+
+Values from config files show the file and line that set them, and the
+profile if one did. Secrets are redacted.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigPrint,
+}
+
+var configEnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "List the environment variable of every setting with its value and source",
+	Long: `List the environment variable bound to every configuration key, with the
+effective value and where it came from.
+
+String lists are comma separated; lists of objects are JSON arrays.
+Secrets are redacted.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigEnv,
+}
+
+func init() {
+	configValidateCmd.Flags().Bool("offline", false, "Check only the configuration itself, without DNS lookups or file access")
+	configCmd.AddCommand(configValidateCmd, configPrintCmd, configEnvCmd)
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	eff, err := config.LoadEffective(cmd)
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	printFiles(out, eff, "")
+
+	offline, _ := cmd.Flags().GetBool("offline")
+	problems := eff.Check(config.ValidateOptions{Offline: offline})
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "Configuration is valid")
+		return nil
+	}
+
+	var errs int
+	for _, problem := range problems {
+		if problem.Severity == config.SeverityError {
+			errs++
+		}
+	}
+	fmt.Fprintf(out, "Found %d error(s) and %d warning(s):\n", errs, len(problems)-errs)
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  %-7s  %v\n", problem.Severity, problem)
+	}
+	if errs == 0 {
+		return nil
+	}
+
+	// Problems were already reported; only set the exit status
+	cmd.SilenceUsage = true
+	return fmt.Errorf("configuration is invalid")
+}
+
+func runConfigPrint(cmd *cobra.Command, args []string) error {
+	eff, err := config.LoadEffective(cmd)
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	printFiles(out, eff, "# ")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, setting := range eff.Settings() {
+		source := string(setting.Source)
+		if setting.Origin != "" {
+			source += " " + setting.Origin
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, setting.Display(), source)
+	}
+	return w.Flush()
+}
+
+// printFiles prints the config files and profiles that were loaded, each
+// line starting with prefix
+func printFiles(out io.Writer, eff *config.Effective, prefix string) {
+	if eff.File == "" {
+		fmt.Fprintf(out, "%sConfig file: none (defaults, environment and flags only)\n", prefix)
+		return
+	}
+	fmt.Fprintf(out, "%sConfig file: %s\n", prefix, eff.File)
+	for _, file := range eff.Files[1:] {
+		fmt.Fprintf(out, "%s  merged: %s\n", prefix, file)
+	}
+	if len(eff.Profiles) > 0 {
+		fmt.Fprintf(out, "%sProfiles: %s\n", prefix, strings.Join(eff.Profiles, ", "))
+	}
+}
+
+func runConfigEnv(cmd *cobra.Command, args []string) error {
+	eff, err := config.LoadEffective(cmd)
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIABLE\tVALUE\tSOURCE")
+	settings := eff.Settings()
+	for i, env := range config.EnvVars() {
+		source := string(settings[i].Source)
+		if legacy, ok := eff.LegacyEnv[env.Key]; ok {
+			source = fmt.Sprintf("%s (%s, deprecated)", source, legacy)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", env.Name, settings[i].Display(), source)
+	}
+	return w.Flush()
+}
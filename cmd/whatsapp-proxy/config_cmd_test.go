@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// execute runs the command line args and returns its output
+func execute(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs(args)
+	defer rootCmd.SetArgs(nil)
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+// writeConfig writes a config file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigValidateReportsEveryProblem(t *testing.T) {
+	path := writeConfig(t, `server:
+  port: 70000
+  max_connections: 0
+  idle_timeout: -1s
+logging:
+  level: loud
+`)
+
+	out, err := execute(t, "config", "validate", "--offline", "--config", path)
+	if err == nil {
+		t.Fatal("config validate accepted an invalid configuration")
+	}
+
+	if !strings.Contains(out, "Found 4 error(s) and 0 warning(s)") {
+		t.Errorf("output does not count every problem:\n%s", out)
+	}
+	for _, want := range []string{
+		"server.port (config.yaml:2)",
+		"server.max_connections (config.yaml:3)",
+		"server.idle_timeout (config.yaml:4)",
+		"logging.level (config.yaml:6)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not report %s:\n%s", want, out)
+		}
+	}
+
+	// A valid configuration passes
+	path = writeConfig(t, "server:\n  port: 9001\n")
+	out, err = execute(t, "config", "validate", "--offline", "--config", path)
+	if err != nil || !strings.Contains(out, "Configuration is valid") {
+		t.Errorf("config validate = %v:\n%s", err, out)
+	}
+}
+
+func TestConfigPrintRedactsSecretsAndShowsSources(t *testing.T) {
+	path := writeConfig(t, `socks5:
+  enabled: true
+  host: 127.0.0.1
+  password: hunter2
+admin:
+  token: 0123456789abcdef0123
+`)
+	t.Setenv("WHATSAPP_PROXY_LOGGING_LEVEL", "debug")
+
+	out, err := execute(t, "config", "print", "--config", path)
+	if err != nil {
+		t.Fatalf("config print error = %v", err)
+	}
+
+	for _, secret := range []string{"hunter2", "0123456789abcdef0123"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output contains secret %q:\n%s", secret, out)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"socks5.password", `\*{8}\s+file config\.yaml:4`},
+		{"admin.token", `\*{8}\s+file config\.yaml:6`},
+		{"socks5.host", `"127\.0\.0\.1"\s+file config\.yaml:3`},
+		{"logging.level", `"debug"\s+env`},
+		{"server.idle_timeout", `5m0s\s+default`},
+	}
+	for _, tt := range tests {
+		line := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(tt.key) + `\s+` + tt.want + `$`)
+		if !line.MatchString(out) {
+			t.Errorf("output has no line for %s matching %s:\n%s", tt.key, tt.want, out)
+		}
+	}
+}
@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
 	"github.com/RevEngine3r/whatsapp-proxy-go/internal/proxy"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/systemd"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/upgrade"
 	"github.com/spf13/cobra"
 )
 
@@ -34,25 +38,34 @@ Supports:
   - Protocol detection and routing`,
 	Version: Version,
 	RunE:    run,
+
+	// main reports returned errors
+	SilenceErrors: true,
 }
 
 func init() {
-	// Server flags
-	rootCmd.Flags().IntP("port", "p", 8443, "Server port")
-	rootCmd.Flags().String("bind", "0.0.0.0", "Bind address")
+	// Server flags are persistent so subcommands load the same configuration
+	rootCmd.PersistentFlags().IntP("port", "p", 8443, "Server port")
+	rootCmd.PersistentFlags().String("bind", "0.0.0.0", "Bind address")
 
 	// Config file
-	rootCmd.Flags().StringP("config", "c", "", "Config file path")
+	rootCmd.PersistentFlags().StringP("config", "c", "", "Config file path")
+	rootCmd.PersistentFlags().StringSlice("profile", nil, "Config profiles to apply over the config files, in order")
 
 	// SOCKS5 proxy
-	rootCmd.Flags().String("socks5-proxy", "", "Upstream SOCKS5 proxy (format: socks5://[user:pass@]host:port)")
+	rootCmd.PersistentFlags().String("socks5-proxy", "", "Upstream SOCKS5 proxy (format: socks5://[user:pass@]host:port)")
 
 	// Logging
-	rootCmd.Flags().String("log-level", "info", "Log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().String("log-level", "info", "Log level (debug, info, warn, error)")
 
 	// Metrics
-	rootCmd.Flags().Int("metrics-port", 8199, "Metrics endpoint port")
-	rootCmd.Flags().Bool("disable-metrics", false, "Disable metrics endpoint")
+	rootCmd.PersistentFlags().Int("metrics-port", 8199, "Metrics endpoint port")
+	rootCmd.PersistentFlags().Bool("disable-metrics", false, "Disable metrics endpoint")
+
+	// Reload
+	rootCmd.Flags().Bool("watch-config", false, "Reload the config files when they change")
+
+	rootCmd.AddCommand(configCmd, certCmd, upstreamCmd)
 
 	// Version template
 	rootCmd.SetVersionTemplate(fmt.Sprintf(
@@ -63,14 +76,21 @@ func init() {
 
 func run(cmd *cobra.Command, args []string) error {
 	// Load configuration
-	cfg, err := config.Load(cmd)
+	eff, err := config.LoadEffective(cmd)
 	if err != nil {
 		return fmt.Errorf("configuration error: %w", err)
 	}
+	cfg := eff.Config
+	if err := eff.Validate(); err != nil {
+		return fmt.Errorf("configuration error: invalid configuration: %w", err)
+	}
 
 	// Display configuration summary
 	printBanner()
 	printConfig(cfg)
+	if len(eff.Profiles) > 0 {
+		log.Printf("[INFO] Config profiles: %s", strings.Join(eff.Profiles, ", "))
+	}
 
 	// Create proxy server
 	server, err := proxy.New(cfg)
@@ -78,26 +98,129 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
+	// Pick up listeners handed over by a restarting parent process,
+	// or passed by systemd socket activation
+	inherited, err := upgrade.Inherited()
+	if err != nil {
+		return fmt.Errorf("failed to inherit listeners: %w", err)
+	}
+	handedOver := inherited != nil
+	if !handedOver {
+		inherited, err = activatedListeners()
+		if err != nil {
+			return err
+		}
+	}
+	proxyListener, metricsListener, acceptors := inheritedListeners(cfg, inherited)
+
 	// Start server
-	if err := server.Start(); err != nil {
+	if err := server.StartWithListeners(proxyListener, metricsListener, acceptors...); err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
+	// Let the parent know it can drain and exit
+	if err := upgrade.Ready(); err != nil {
+		log.Printf("[WARN] Failed to notify parent process: %v", err)
+	}
+
+	// Report readiness to systemd; a handed-over process becomes the main PID
+	notifyReady := systemd.Ready
+	if handedOver {
+		notifyReady = systemd.ReadyAsMainPID
+	}
+	if _, err := notifyReady(); err != nil {
+		log.Printf("[WARN] systemd notification failed: %v", err)
+	}
+
+	superviseCtx, stopSupervise := context.WithCancel(context.Background())
+	defer stopSupervise()
+	go systemd.Supervise(superviseCtx, server.CheckLiveness, func() string {
+		metrics := server.GetMetrics()
+		return fmt.Sprintf("Serving %d active connections (%d total)",
+			metrics.GetConnectionsActive(), metrics.GetConnectionsTotal())
+	})
+
 	log.Println("[INFO] Server started successfully")
 	log.Println("[INFO] Press Ctrl+C to stop")
 
-	// Wait for interrupt signal
+	// Reload the config file when it changes, if requested
+	var configChanges <-chan struct{}
+	if watch, _ := cmd.Flags().GetBool("watch-config"); watch {
+		if eff.File == "" {
+			log.Println("[WARN] --watch-config ignored: no config file in use")
+		} else {
+			watcher, err := config.Watch(eff.Files, eff.Dirs)
+			if err != nil {
+				return err
+			}
+			defer watcher.Close()
+			configChanges = watcher.Changes()
+			log.Printf("[INFO] Watching %s for changes", strings.Join(append(eff.Files, eff.Dirs...), ", "))
+		}
+	}
+
+	// Wait for interrupt, restart or reload signal
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, shutdownSignals...)
+	if restartSignal != nil {
+		signal.Notify(sigChan, restartSignal)
+	}
+	if reloadSignal != nil {
+		signal.Notify(sigChan, reloadSignal)
+	}
+
+	restarted := false
+wait:
+	for {
+		select {
+		case <-configChanges:
+			log.Println("[INFO] Config file changed, reloading...")
+			reloadConfig(cmd, server)
+
+		case sig := <-sigChan:
+			switch sig {
+			case reloadSignal:
+				log.Println("[INFO] Reload signal received, reloading configuration...")
+				reloadConfig(cmd, server)
+
+			case restartSignal:
+				log.Println("[INFO] Restart signal received, starting new process...")
+				if err := restartProcess(server); err != nil {
+					log.Printf("[ERROR] Restart failed, continuing to serve: %v", err)
+					continue
+				}
+				restarted = true
+				break wait
+
+			default:
+				log.Println("[INFO] Interrupt received, shutting down...")
+				break wait
+			}
+		}
+	}
 
-	log.Println("[INFO] Interrupt received, shutting down...")
+	// After a handoff the new process owns the systemd status and watchdog
+	stopSupervise()
+	if !restarted {
+		if _, err := systemd.Stopping(); err != nil {
+			log.Printf("[WARN] systemd notification failed: %v", err)
+		}
+	}
 
-	// Graceful shutdown with 30 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Graceful shutdown with a hard deadline
+	shutdownTimeout := server.Config().Server.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
+		var forced *proxy.ShutdownError
+		if errors.As(err, &forced) {
+			log.Printf("[WARN] Server stopped: %v", forced)
+			return nil
+		}
 		return fmt.Errorf("shutdown error: %w", err)
 	}
 
@@ -105,6 +228,139 @@ func run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// reloadConfig reads the configuration again and applies it to the server
+// An invalid configuration is logged and the running one kept.
+func reloadConfig(cmd *cobra.Command, server *proxy.Server) {
+	cfg, err := config.Load(cmd)
+	if err == nil {
+		_, err = server.Reload(cfg)
+	} else {
+		server.GetMetrics().IncrementConfigReloads(false)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Config reload failed, keeping the running configuration: %v", err)
+	}
+}
+
+// restartProcess hands the listeners to a new process and waits until it is ready
+func restartProcess(server *proxy.Server) error {
+	proxyListener, metricsListener := server.Listeners()
+	if proxyListener == nil {
+		return fmt.Errorf("server is draining, no listener to hand over")
+	}
+
+	listeners := []upgrade.Listener{
+		{Name: "proxy", Listener: proxyListener},
+		{Name: "metrics", Listener: metricsListener},
+	}
+	// Every SO_REUSEPORT acceptor holds its own queue of connections
+	for i, l := range server.Acceptors() {
+		listeners = append(listeners, upgrade.Listener{Name: acceptorName(i + 1), Listener: l})
+	}
+
+	systemd.PrepareHandoff()
+	pid, err := upgrade.Restart(listeners, upgrade.DefaultReadyTimeout)
+	if err != nil {
+		return err
+	}
+	server.ReleaseSocket()
+
+	log.Printf("[INFO] New process %d is ready, draining existing connections", pid)
+	return nil
+}
+
+// activatedListeners returns systemd socket-activated listeners keyed by
+// FileDescriptorName; unnamed sockets are assigned proxy, then metrics
+func activatedListeners() (map[string]net.Listener, error) {
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if activated == nil {
+		return nil, nil
+	}
+
+	listeners := make(map[string]net.Listener)
+	var unnamed []systemd.Listener
+	for _, l := range activated {
+		if (l.Name == "proxy" || l.Name == "metrics") && listeners[l.Name] == nil {
+			listeners[l.Name] = l.Listener
+		} else {
+			unnamed = append(unnamed, l)
+		}
+	}
+
+	for _, l := range unnamed {
+		switch {
+		case listeners["proxy"] == nil:
+			listeners["proxy"] = l.Listener
+		case listeners["metrics"] == nil:
+			listeners["metrics"] = l.Listener
+		default:
+			log.Printf("[WARN] Ignoring extra socket-activated listener %s (%s)", l.Name, l.Listener.Addr())
+			l.Listener.Close()
+		}
+	}
+
+	for name, l := range listeners {
+		log.Printf("[INFO] Socket-activated %s listener on %s", name, l.Addr())
+	}
+	return listeners, nil
+}
+
+// acceptorName is the name under which the nth additional acceptor is
+// handed to a restarted process
+func acceptorName(n int) string {
+	return fmt.Sprintf("proxy-%d", n)
+}
+
+// inheritedListeners returns the inherited proxy, metrics and additional
+// acceptor listeners that still match the configured ports or Unix socket
+// path; mismatching listeners are closed so the server opens the newly
+// configured address instead
+func inheritedListeners(cfg *config.Config, inherited map[string]net.Listener) (net.Listener, net.Listener, []net.Listener) {
+	matches := func(l net.Listener, network, address string, port int) bool {
+		switch addr := l.Addr().(type) {
+		case *net.TCPAddr:
+			return network == "tcp" && addr.Port == port
+		case *net.UnixAddr:
+			return network == "unix" && addr.Name == address
+		}
+		return false
+	}
+	match := func(name, network, address string, port int) net.Listener {
+		l, ok := inherited[name]
+		if !ok || l == nil {
+			return nil
+		}
+		if matches(l, network, address, port) {
+			log.Printf("[INFO] Using inherited %s listener %s", name, l.Addr())
+			return l
+		}
+		log.Printf("[WARN] Inherited %s listener %s does not match configured address %s, reopening", name, l.Addr(), address)
+		l.Close()
+		return nil
+	}
+
+	network, address := cfg.Server.Listener()
+	proxyListener := match("proxy", network, address, cfg.Server.Port)
+	metricsListener := match("metrics", "tcp", cfg.Metrics.GetAddress(), cfg.Metrics.Port)
+
+	var acceptors []net.Listener
+	for n := 1; inherited[acceptorName(n)] != nil; n++ {
+		l := inherited[acceptorName(n)]
+		if proxyListener == nil || !matches(l, network, address, cfg.Server.Port) {
+			l.Close()
+			continue
+		}
+		acceptors = append(acceptors, l)
+	}
+	if len(acceptors) > 0 {
+		log.Printf("[INFO] Using %d inherited acceptor listeners", len(acceptors))
+	}
+	return proxyListener, metricsListener, acceptors
+}
+
 func printBanner() {
 	fmt.Println()
 	fmt.Println("┏━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┓")
@@ -117,13 +373,14 @@ func printBanner() {
 func printConfig(cfg *config.Config) {
 	fmt.Println("🚀 Configuration:")
 	fmt.Println("===============================================")
-	fmt.Printf("🎯 Server:        %s\n", cfg.Server.GetAddress())
+	_, address := cfg.Server.Listener()
+	fmt.Printf("🎯 Server:        %s\n", address)
 
 	fmt.Printf("🔌 SOCKS5 Proxy:  ")
 	if cfg.SOCKS5.Enabled {
 		fmt.Printf("Enabled (%s)\n", cfg.SOCKS5.GetAddress())
 		if cfg.SOCKS5.HasAuth() {
-			fmt.Println("             with authentication")
+			fmt.Printf("             user %s, password %s\n", display(cfg, "socks5.username"), display(cfg, "socks5.password"))
 		}
 	} else {
 		fmt.Println("Disabled (direct connection)")
@@ -139,10 +396,20 @@ func printConfig(cfg *config.Config) {
 		fmt.Println("📊 Metrics:       Disabled")
 	}
 
+	if cfg.Admin.Enabled {
+		fmt.Printf("🛠  Admin API:     http://%s/admin/ (token %s)\n", cfg.Metrics.GetAddress(), display(cfg, "admin.token"))
+	}
+
 	fmt.Println("===============================================")
 	fmt.Println()
 }
 
+// display formats a config value for printing, with secrets redacted
+func display(cfg *config.Config, key string) string {
+	setting, _ := cfg.Lookup(key)
+	return setting.Display()
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignal triggers a zero-downtime restart with listener handoff
+var restartSignal os.Signal = syscall.SIGUSR2
+
+// reloadSignal reloads the configuration file
+var reloadSignal os.Signal = syscall.SIGHUP
+
+// shutdownSignals stop the server gracefully
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignal is not available on Windows
+var restartSignal os.Signal
+
+// reloadSignal is not available on Windows; use --watch-config instead
+var reloadSignal os.Signal
+
+// shutdownSignals stop the server gracefully
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/proxy"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/socks5"
+	"github.com/spf13/cobra"
+)
+
+var upstreamCmd = &cobra.Command{
+	Use:   "upstream",
+	Short: "Check the upstream SOCKS5 proxy",
+}
+
+var upstreamTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Connect to a target through the upstream proxy and report timing",
+	Long: `Connect to a target through the upstream SOCKS5 proxy and report timing.
+
+The proxy is taken from the configuration unless --socks5-proxy is given.`,
+	Args: cobra.NoArgs,
+	RunE: runUpstreamTest,
+}
+
+func init() {
+	upstreamTestCmd.Flags().String("target", socks5.DefaultTestEndpoint, "Target host:port to connect to")
+	upstreamTestCmd.Flags().Int("count", 1, "Number of connection attempts")
+
+	upstreamCmd.AddCommand(upstreamTestCmd)
+}
+
+func runUpstreamTest(cmd *cobra.Command, args []string) error {
+	target, _ := cmd.Flags().GetString("target")
+	count, _ := cmd.Flags().GetInt("count")
+	if count < 1 {
+		return fmt.Errorf("count must be at least 1, got %d", count)
+	}
+
+	eff, err := config.LoadEffective(cmd)
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	cfg := eff.Config
+
+	if !cfg.SOCKS5.Enabled {
+		return fmt.Errorf("no upstream proxy configured (set socks5.enabled or --socks5-proxy)")
+	}
+	if err := cfg.SOCKS5.Validate(); err != nil {
+		return fmt.Errorf("invalid socks5 configuration: %w", err)
+	}
+
+	// Reach the proxy exactly like the server, including upstream.tcp, both
+	// for the proxy connect timing and for the tunnel
+	warned := make(map[string]bool)
+	client, err := proxy.NewSOCKS5Client(cfg, func(err error) {
+		if !warned[err.Error()] {
+			warned[err.Error()] = true
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: socket option ignored: %v\n", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Testing %s via %s (auth=%v)\n", target, client.GetProxyAddr(), client.HasAuth())
+
+	var failed int
+	var total time.Duration
+	for i := 1; i <= count; i++ {
+		result, err := client.TestEndpoint(target)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "  #%d  failed: %v\n", i, err)
+			continue
+		}
+		total += result.Tunnel
+		fmt.Fprintf(out, "  #%d  proxy connect %v, tunnel established %v\n",
+			i, result.ProxyConnect.Round(time.Microsecond), result.Tunnel.Round(time.Microsecond))
+	}
+
+	succeeded := count - failed
+	if succeeded > 0 {
+		fmt.Fprintf(out, "%d/%d succeeded, average tunnel time %v\n",
+			succeeded, count, (total / time.Duration(succeeded)).Round(time.Microsecond))
+	}
+
+	if failed > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d attempts failed", failed, count)
+	}
+	return nil
+}
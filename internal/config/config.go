@@ -1,13 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/sockopt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -19,6 +23,10 @@ type Config struct {
 	SSL     SSLConfig     `mapstructure:"ssl"`
 	Logging LoggingConfig `mapstructure:"logging"`
 	Metrics MetricsConfig `mapstructure:"metrics"`
+	Admin   AdminConfig   `mapstructure:"admin"`
+	Jabber  JabberConfig  `mapstructure:"jabber"`
+
+	Upstream UpstreamConfig `mapstructure:"upstream"`
 }
 
 // ServerConfig holds server-specific settings
@@ -27,6 +35,106 @@ type ServerConfig struct {
 	BindAddr       string        `mapstructure:"bind_addr"`
 	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
 	MaxConnections int           `mapstructure:"max_connections"`
+
+	// DrainTimeout is how long shutdown waits for connections to finish
+	// before they are forcibly closed
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+
+	// ShutdownTimeout is the hard deadline for the whole shutdown
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	// DetectPeekLimit caps the bytes inspected to detect the protocol;
+	// 0 uses the built-in default
+	DetectPeekLimit int `mapstructure:"detect_peek_limit"`
+
+	// DetectTimeout bounds how long a client may take to send enough bytes
+	// for protocol detection; 0 disables the timeout
+	DetectTimeout time.Duration `mapstructure:"detect_timeout"`
+
+	// Fallback handles connections whose protocol is not recognized
+	Fallback FallbackConfig `mapstructure:"fallback"`
+
+	// UnixSocket, if its path is set, replaces the TCP listener on
+	// bind_addr and port
+	UnixSocket UnixSocketConfig `mapstructure:"unix_socket"`
+
+	// TCP tunes the listener and the client connections accepted on it
+	TCP TCPConfig `mapstructure:"tcp"`
+
+	// Acceptors is the number of listeners bound to the address with
+	// SO_REUSEPORT, each with its own accept loop; 0 or 1 opens a single
+	// listener
+	Acceptors int `mapstructure:"acceptors"`
+
+	// AcceptRate limits new connections per second across all acceptors,
+	// with bursts of up to AcceptBurst; 0 disables the limit
+	AcceptRate  float64 `mapstructure:"accept_rate"`
+	AcceptBurst int     `mapstructure:"accept_burst"`
+}
+
+// TCPConfig holds socket options of a listener or of upstream connections
+type TCPConfig struct {
+	// KeepAlive is the TCP keepalive period; negative disables keepalives
+	KeepAlive time.Duration `mapstructure:"keepalive"`
+
+	// NoDelay disables Nagle's algorithm (TCP_NODELAY)
+	NoDelay bool `mapstructure:"no_delay"`
+
+	// ReadBuffer and WriteBuffer are the socket buffer sizes in bytes;
+	// 0 keeps the system default
+	ReadBuffer  int `mapstructure:"read_buffer"`
+	WriteBuffer int `mapstructure:"write_buffer"`
+
+	// ReusePort sets SO_REUSEPORT on the listener
+	ReusePort bool `mapstructure:"reuse_port"`
+
+	// FastOpen enables TCP Fast Open
+	FastOpen bool `mapstructure:"fast_open"`
+
+	// Mark is the Linux fwmark (SO_MARK) for policy routing; 0 sets none
+	Mark int `mapstructure:"mark"`
+
+	// TOS is the IP TOS byte, e.g. a DSCP value shifted left by 2; 0 keeps
+	// the system default
+	TOS int `mapstructure:"tos"`
+}
+
+// UpstreamConfig holds settings of the connections the proxy opens:
+// to targets, the SOCKS5 proxy and the fallback target
+type UpstreamConfig struct {
+	TCP TCPConfig `mapstructure:"tcp"`
+}
+
+// UnixSocketConfig holds a Unix domain socket listener
+type UnixSocketConfig struct {
+	Path string `mapstructure:"path"`
+
+	// Mode is the octal file mode of the socket, e.g. "0660"; empty keeps
+	// the mode given by the umask
+	Mode string `mapstructure:"mode"`
+
+	// Owner and Group, names or numeric IDs, change the socket's ownership
+	Owner string `mapstructure:"owner"`
+	Group string `mapstructure:"group"`
+}
+
+// FallbackConfig holds the handling of unrecognized traffic on a listener
+type FallbackConfig struct {
+	// Action is close, forward, hold or reset
+	Action string `mapstructure:"action"`
+
+	// Target receives forwarded connections, dialed directly
+	Target string `mapstructure:"target"`
+
+	// Held connections are closed after a random delay between HoldMin
+	// and HoldMax
+	HoldMin time.Duration `mapstructure:"hold_min"`
+	HoldMax time.Duration `mapstructure:"hold_max"`
+
+	// SampleBytes of each unrecognized connection are logged at debug
+	// level, at most SampleRate times per minute; 0 disables sampling
+	SampleBytes int `mapstructure:"sample_bytes"`
+	SampleRate  int `mapstructure:"sample_rate"`
 }
 
 // SOCKS5Config holds SOCKS5 upstream proxy settings
@@ -35,8 +143,12 @@ type SOCKS5Config struct {
 	Host     string        `mapstructure:"host"`
 	Port     int           `mapstructure:"port"`
 	Username string        `mapstructure:"username"`
-	Password string        `mapstructure:"password"`
+	Password string        `mapstructure:"password" secret:"true"`
 	Timeout  time.Duration `mapstructure:"timeout"`
+
+	// PasswordFile is read instead of password, e.g. a Docker or
+	// Kubernetes secret mount
+	PasswordFile string `mapstructure:"password_file"`
 }
 
 // SSLConfig holds SSL/TLS certificate settings
@@ -48,6 +160,116 @@ type SSLConfig struct {
 	IPAddresses  []string `mapstructure:"ip_addresses"`
 	ValidityDays int      `mapstructure:"validity_days"`
 	CacheDir     string   `mapstructure:"cache_dir"`
+
+	// WatchInterval is how often cert_file and key_file are checked for
+	// changes; 0 disables hot reloading
+	WatchInterval time.Duration `mapstructure:"watch_interval"`
+
+	// ExpiryWarningDays reports the proxy as degraded on /health when a
+	// served certificate expires within this many days; 0 disables
+	ExpiryWarningDays int `mapstructure:"expiry_warning_days"`
+
+	// Certificates are selected by SNI server name; names matching no entry
+	// get the default certificate above
+	Certificates []CertificateEntry `mapstructure:"certificates"`
+
+	CA   CAConfig   `mapstructure:"ca"`
+	ACME ACMEConfig `mapstructure:"acme"`
+
+	// KeyType is the key algorithm of generated certificates
+	KeyType string `mapstructure:"key_type"`
+
+	TLS TLSConfig `mapstructure:"tls"`
+
+	ClientAuth ClientAuthConfig `mapstructure:"client_auth"`
+}
+
+// ClientAuthConfig holds TLS client certificate authentication settings
+// When mode is not none, TLS connections are terminated by the proxy and
+// clients are verified against the CA files
+type ClientAuthConfig struct {
+	// Mode is none, optional or require
+	Mode     string   `mapstructure:"mode"`
+	CAFiles  []string `mapstructure:"ca_files"`
+	CRLFiles []string `mapstructure:"crl_files"`
+
+	// Identity lists the certificate fields the client identity is taken
+	// from, in order: subject_cn, subject, san_dns, san_email or san_uri
+	Identity []string `mapstructure:"identity"`
+
+	// Routes send the connections of client identities to targets other
+	// than the chat server; matched in order
+	Routes []ClientAuthRoute `mapstructure:"routes"`
+}
+
+// ClientAuthRoute sends the connections of a client identity to a target
+type ClientAuthRoute struct {
+	Identity string `mapstructure:"identity"`
+	Target   string `mapstructure:"target"`
+}
+
+// TLSConfig holds the TLS protocol policy
+// Empty lists keep the built-in defaults
+type TLSConfig struct {
+	MinVersion     string              `mapstructure:"min_version"`
+	MaxVersion     string              `mapstructure:"max_version"`
+	CipherSuites   []string            `mapstructure:"cipher_suites"`
+	Curves         []string            `mapstructure:"curves"`
+	ALPN           []string            `mapstructure:"alpn"`
+	SessionTickets SessionTicketConfig `mapstructure:"session_tickets"`
+}
+
+// SessionTicketConfig holds session ticket key settings
+// Instances sharing key_file can resume each other's sessions
+type SessionTicketConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	RotationInterval time.Duration `mapstructure:"rotation_interval"`
+	KeyFile          string        `mapstructure:"key_file"`
+}
+
+// CertificateEntry is a certificate served for a set of SNI server names
+type CertificateEntry struct {
+	// Names are exact host names or wildcards such as *.example.com
+	Names        []string `mapstructure:"names"`
+	CertFile     string   `mapstructure:"cert_file"`
+	KeyFile      string   `mapstructure:"key_file"`
+	AutoGenerate bool     `mapstructure:"auto_generate"`
+}
+
+// CAConfig holds local certificate authority settings
+// When enabled, auto-generated certificates are issued by a persistent root
+// CA that clients trust once, instead of being self-signed
+type CAConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Dir holds the root certificate and encrypted key; defaults to
+	// <cache_dir>/ca
+	Dir              string `mapstructure:"dir"`
+	Passphrase       string `mapstructure:"passphrase" secret:"true"`
+	PassphraseFile   string `mapstructure:"passphrase_file"`
+	ValidityDays     int    `mapstructure:"validity_days"`
+	LeafValidityDays int    `mapstructure:"leaf_validity_days"`
+	OnDemand         bool   `mapstructure:"on_demand"`
+}
+
+// ACMEConfig holds ACME certificate issuance settings
+// When enabled, certificates are obtained and renewed from an ACME CA such as
+// Let's Encrypt, answering HTTP-01 and TLS-ALPN-01 challenges on the listener
+type ACMEConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	DirectoryURL string `mapstructure:"directory_url"`
+	Email        string `mapstructure:"email"`
+
+	// Domains defaults to dns_names
+	Domains    []string `mapstructure:"domains"`
+	AcceptTOS  bool     `mapstructure:"accept_tos"`
+	Challenges []string `mapstructure:"challenges"`
+
+	RenewBeforeDays int `mapstructure:"renew_before_days"`
+
+	// DirectoryCAFile trusts an extra root for the directory URL, for
+	// private or test ACME servers
+	DirectoryCAFile string `mapstructure:"directory_ca_file"`
 }
 
 // LoggingConfig holds logging settings
@@ -64,6 +286,45 @@ type MetricsConfig struct {
 	BindAddr string `mapstructure:"bind_addr"`
 }
 
+// AdminConfig holds admin API settings
+// The admin API is served on the metrics server under /admin/
+type AdminConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token" secret:"true"`
+
+	// TokenFile is read instead of token
+	TokenFile string `mapstructure:"token_file"`
+}
+
+// JabberConfig holds the routing of Jabber/XMPP streams by the domain in
+// the stream header's to attribute
+type JabberConfig struct {
+	// DefaultTarget receives streams matching no route
+	DefaultTarget string `mapstructure:"default_target"`
+
+	// Routes are matched in order
+	Routes []JabberRoute `mapstructure:"routes"`
+
+	// AllowedDomains restricts the domains clients may request, exact or
+	// wildcards such as *.whatsapp.net; empty allows any
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+}
+
+// JabberRoute sends streams for a domain to a target
+type JabberRoute struct {
+	// Domain is an exact domain or a wildcard such as *.whatsapp.net
+	Domain string `mapstructure:"domain"`
+	Target string `mapstructure:"target"`
+}
+
+// defaultTCP returns the socket options Go uses by default
+func defaultTCP() TCPConfig {
+	return TCPConfig{
+		KeepAlive: 15 * time.Second,
+		NoDelay:   true,
+	}
+}
+
 // Default returns a Config with sensible defaults
 func Default() *Config {
 	homeDir, _ := os.UserHomeDir()
@@ -71,10 +332,24 @@ func Default() *Config {
 
 	return &Config{
 		Server: ServerConfig{
-			Port:           8443,
-			BindAddr:       "0.0.0.0",
-			IdleTimeout:    300 * time.Second,
-			MaxConnections: 1000,
+			Port:            8443,
+			BindAddr:        "0.0.0.0",
+			IdleTimeout:     300 * time.Second,
+			MaxConnections:  1000,
+			DrainTimeout:    20 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+			DetectPeekLimit: 1024,
+			DetectTimeout:   30 * time.Second,
+			Fallback: FallbackConfig{
+				Action:      "close",
+				HoldMin:     5 * time.Second,
+				HoldMax:     30 * time.Second,
+				SampleBytes: 64,
+				SampleRate:  10,
+			},
+			TCP:         defaultTCP(),
+			Acceptors:   1,
+			AcceptBurst: 100,
 		},
 		SOCKS5: SOCKS5Config{
 			Enabled: false,
@@ -83,11 +358,36 @@ func Default() *Config {
 			Timeout: 30 * time.Second,
 		},
 		SSL: SSLConfig{
-			AutoGenerate: true,
-			DNSNames:     []string{"localhost"},
-			IPAddresses:  []string{"127.0.0.1"},
-			ValidityDays: 365,
-			CacheDir:     cacheDir,
+			AutoGenerate:      true,
+			DNSNames:          []string{"localhost"},
+			IPAddresses:       []string{"127.0.0.1"},
+			ValidityDays:      365,
+			CacheDir:          cacheDir,
+			WatchInterval:     10 * time.Second,
+			ExpiryWarningDays: 7,
+			CA: CAConfig{
+				Enabled:          false,
+				ValidityDays:     3650,
+				LeafValidityDays: 30,
+			},
+			ACME: ACMEConfig{
+				Enabled:         false,
+				DirectoryURL:    "https://acme-v02.api.letsencrypt.org/directory",
+				Challenges:      []string{"tls-alpn-01", "http-01"},
+				RenewBeforeDays: 30,
+			},
+			KeyType: "rsa-2048",
+			TLS: TLSConfig{
+				MinVersion: "1.2",
+				SessionTickets: SessionTicketConfig{
+					Enabled:          true,
+					RotationInterval: 24 * time.Hour,
+				},
+			},
+			ClientAuth: ClientAuthConfig{
+				Mode:     "none",
+				Identity: []string{"subject_cn"},
+			},
 		},
 		Logging: LoggingConfig{
 			Level:  "info",
@@ -99,11 +399,150 @@ func Default() *Config {
 			Port:     8199,
 			BindAddr: "127.0.0.1",
 		},
+		Admin: AdminConfig{
+			Enabled: false,
+		},
+		Jabber: JabberConfig{
+			DefaultTarget: "e1.whatsapp.net:5222",
+		},
+		Upstream: UpstreamConfig{
+			TCP: defaultTCP(),
+		},
 	}
 }
 
+// Source identifies where an effective configuration value came from
+type Source string
+
+const (
+	// SourceDefault is a built-in default value
+	SourceDefault Source = "default"
+	// SourceFile is a value from the config file
+	SourceFile Source = "file"
+	// SourceEnv is a value from an environment variable
+	SourceEnv Source = "env"
+	// SourceFlag is a value from a command-line flag
+	SourceFlag Source = "flag"
+)
+
+// flagKeys maps command-line flags to the config keys they override
+var flagKeys = map[string][]string{
+	"port":            {"server.port"},
+	"bind":            {"server.bind_addr"},
+	"socks5-proxy":    {"socks5.enabled", "socks5.host", "socks5.port", "socks5.username", "socks5.password"},
+	"log-level":       {"logging.level"},
+	"metrics-port":    {"metrics.port"},
+	"disable-metrics": {"metrics.enabled"},
+}
+
+// Effective is a loaded configuration together with the source of each value
+type Effective struct {
+	// Config is the merged configuration
+	Config *Config
+
+	// File is the main config file that was read, empty if none
+	File string
+
+	// Files are all config files that were merged, in order: File, its
+	// includes and the conf.d directory
+	Files []string
+
+	// Dirs are the included and conf.d directories whose YAML files were
+	// merged
+	Dirs []string
+
+	// Profiles are the profiles applied over the files, in order
+	Profiles []string
+
+	// Sources maps each config key to where its value came from
+	Sources map[string]Source
+
+	// LegacyEnv maps config keys set from deprecated environment variables
+	// to the variable used
+	LegacyEnv map[string]string
+
+	// index locates settings in Files
+	index *fileIndex
+}
+
+// Settings returns the effective settings with their sources, and the file
+// and line of those set in a config file
+func (e *Effective) Settings() []Setting {
+	settings := Settings(e.Config)
+	for i := range settings {
+		src, ok := e.Sources[settings[i].Key]
+		if !ok {
+			src = SourceDefault
+		}
+		settings[i].Source = src
+		if src == SourceFile && e.index != nil {
+			if loc, ok := e.index.locations[settings[i].Key]; ok {
+				settings[i].Origin = loc.String()
+			}
+		}
+	}
+	return settings
+}
+
+// Check validates the configuration like Config.Check, adding the config
+// file and line of each problem and warnings for unknown keys in the files
+func (e *Effective) Check(opts ValidateOptions) []Problem {
+	problems := e.Config.Check(opts)
+	if e.index == nil {
+		return problems
+	}
+
+	for i := range problems {
+		// Values from the environment or flags are not where the file says
+		if src := e.Sources[settingKey(problems[i].Path)]; src == SourceEnv || src == SourceFlag {
+			continue
+		}
+		if loc, ok := e.index.locate(problems[i].Path); ok {
+			problems[i].File, problems[i].Line = loc.file, loc.line
+		}
+	}
+	for _, key := range e.index.unknownKeys() {
+		problems = append(problems, Problem{
+			Path:     key.path,
+			File:     key.file,
+			Line:     key.line,
+			Severity: SeverityWarning,
+			Err:      fmt.Errorf("unknown setting, ignored"),
+		})
+	}
+	return problems
+}
+
+// Validate checks the configuration, logging warnings and returning every
+// error joined
+func (e *Effective) Validate() error {
+	problems := e.Check(ValidateOptions{})
+	for _, p := range problems {
+		if p.Severity == SeverityWarning {
+			log.Printf("[WARN] Config: %v", p)
+		}
+	}
+	return errors.Join(errorsOnly(problems)...)
+}
+
 // Load loads configuration from file and CLI flags
 func Load(cmd *cobra.Command) (*Config, error) {
+	eff, err := LoadEffective(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate configuration
+	if err := eff.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return eff.Config, nil
+}
+
+// LoadEffective loads configuration from file, environment and CLI flags
+// without validating it, and records where each value came from
+func LoadEffective(cmd *cobra.Command) (*Effective, error) {
 	cfg := Default()
 
 	// Set up viper
@@ -111,24 +550,36 @@ func Load(cmd *cobra.Command) (*Config, error) {
 	v.SetConfigType("yaml")
 
 	// Bind environment variables
-	v.SetEnvPrefix("WHATSAPP_PROXY")
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	v.AutomaticEnv()
+	legacyEnv, err := bindEnv(v)
+	if err != nil {
+		return nil, err
+	}
 
-	// Load config file if specified
+	// Load the config file if specified, else search common locations,
+	// with its includes, conf.d directory and profiles
 	configFile, _ := cmd.Flags().GetString("config")
+	if configFile == "" {
+		configFile = findConfigFile()
+	}
+	profiles := activeProfiles(cmd)
+
+	var layers []configLayer
+	var dirs []string
+	var index *fileIndex
 	if configFile != "" {
-		v.SetConfigFile(configFile)
-		if err := v.ReadInConfig(); err != nil {
+		if layers, dirs, err = loadLayers(configFile); err != nil {
+			return nil, err
+		}
+		values, ix, err := mergeLayers(layers, profiles)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.MergeConfigMap(values); err != nil {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
-	} else {
-		// Search for config in common locations
-		v.SetConfigName("config")
-		v.AddConfigPath(".")
-		v.AddConfigPath("$HOME/.whatsapp-proxy")
-		v.AddConfigPath("/etc/whatsapp-proxy")
-		_ = v.ReadInConfig() // Ignore error if no config file found
+		index = ix
+	} else if len(profiles) > 0 {
+		return nil, fmt.Errorf("profile %s requested but no config file found", strings.Join(profiles, ", "))
 	}
 
 	// Unmarshal into config struct
@@ -141,12 +592,88 @@ func Load(cmd *cobra.Command) (*Config, error) {
 		return nil, err
 	}
 
-	// Validate configuration
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	// Secrets may be references, including in --socks5-proxy
+	if err := resolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+
+	eff := &Effective{
+		Config:    cfg,
+		File:      configFile,
+		Dirs:      dirs,
+		Profiles:  profiles,
+		Sources:   sources(cmd, v, legacyEnv),
+		LegacyEnv: legacyEnv,
+		index:     index,
+	}
+	for _, layer := range layers {
+		eff.Files = append(eff.Files, layer.path)
+	}
+	return eff, nil
+}
+
+// LoadFile loads configuration like LoadEffective for a program without
+// command-line flags: from the config file at path, or the first one found
+// in the search paths if path is empty, with the named profiles and the
+// environment
+func LoadFile(path string, profiles ...string) (*Effective, error) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", path, "")
+	cmd.Flags().StringSlice("profile", nil, "")
+	for _, profile := range profiles {
+		if err := cmd.Flags().Set("profile", profile); err != nil {
+			return nil, err
+		}
+	}
+	return LoadEffective(cmd)
+}
+
+// activeProfiles returns the profiles named by --profile, or else by the
+// comma-separated WHATSAPP_PROXY_PROFILE environment variable
+func activeProfiles(cmd *cobra.Command) []string {
+	var names []string
+	if f := cmd.Flags().Lookup("profile"); f != nil && f.Changed {
+		names, _ = cmd.Flags().GetStringSlice("profile")
+	} else {
+		names = strings.Split(os.Getenv(envPrefix+"_PROFILE"), ",")
 	}
 
-	return cfg, nil
+	var profiles []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			profiles = append(profiles, name)
+		}
+	}
+	return profiles
+}
+
+// sources determines where each config key's effective value came from
+func sources(cmd *cobra.Command, v *viper.Viper, legacyEnv map[string]string) map[string]Source {
+	result := make(map[string]Source)
+
+	for _, key := range Keys() {
+		if envSet(key, legacyEnv) {
+			result[key] = SourceEnv
+		} else if v.InConfig(key) {
+			result[key] = SourceFile
+		}
+	}
+
+	for flag, keys := range flagKeys {
+		f := cmd.Flags().Lookup(flag)
+		if f == nil || !f.Changed {
+			continue
+		}
+		for _, key := range keys {
+			// Credentials only come from the proxy URL if it contains them
+			if (key == "socks5.username" || key == "socks5.password") && !strings.Contains(f.Value.String(), "@") {
+				continue
+			}
+			result[key] = SourceFlag
+		}
+	}
+
+	return result
 }
 
 // overrideFromFlags overrides config values with CLI flags
@@ -203,10 +730,11 @@ func parseSOCKS5URL(proxyURL string, cfg *Config) error {
 		auth = rest[:idx]
 		hostPort = rest[idx+1:]
 
-		// Parse username:password
+		// Parse username:password; without a password, password_file
+		// or socks5.password supplies it
 		parts := strings.SplitN(auth, ":", 2)
+		cfg.SOCKS5.Username = parts[0]
 		if len(parts) == 2 {
-			cfg.SOCKS5.Username = parts[0]
 			cfg.SOCKS5.Password = parts[1]
 		}
 	} else {
@@ -257,6 +785,40 @@ func (c *ServerConfig) GetAddress() string {
 	return net.JoinHostPort(c.BindAddr, fmt.Sprintf("%d", c.Port))
 }
 
+// Listener returns the network and address the proxy listens on: the Unix
+// socket if configured, else the TCP address
+func (c *ServerConfig) Listener() (network, address string) {
+	if c.UnixSocket.Path != "" {
+		return "unix", c.UnixSocket.Path
+	}
+	return "tcp", c.GetAddress()
+}
+
+// SocketOptions returns the raw socket options, which are applied through
+// the sockopt package
+func (c *TCPConfig) SocketOptions() sockopt.Options {
+	return sockopt.Options{
+		ReadBuffer:  c.ReadBuffer,
+		WriteBuffer: c.WriteBuffer,
+		ReusePort:   c.ReusePort,
+		FastOpen:    c.FastOpen,
+		Mark:        c.Mark,
+		TOS:         c.TOS,
+	}
+}
+
+// FileMode returns the parsed socket mode, or 0 if none is set
+func (c *UnixSocketConfig) FileMode() (os.FileMode, error) {
+	if c.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q, want octal permissions such as 0660", c.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
 // GetMetricsAddress returns the metrics listen address
 func (c *MetricsConfig) GetAddress() string {
 	return net.JoinHostPort(c.BindAddr, fmt.Sprintf("%d", c.Port))
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is a setting whose value differs between two configurations
+type Change struct {
+	Key string
+	Old Setting
+	New Setting
+}
+
+// String describes the change with secrets redacted
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Key, c.Old.Display(), c.New.Display())
+}
+
+// Diff returns the settings that differ between old and new, in declaration
+// order
+func Diff(old, new *Config) []Change {
+	oldSettings := Settings(old)
+	newSettings := Settings(new)
+
+	var changes []Change
+	for i := range oldSettings {
+		if !equalValues(oldSettings[i].Value, newSettings[i].Value) {
+			changes = append(changes, Change{
+				Key: oldSettings[i].Key,
+				Old: oldSettings[i],
+				New: newSettings[i],
+			})
+		}
+	}
+	return changes
+}
+
+// equalValues compares setting values, treating nil and empty lists alike
+// since an explicit empty list in a file means the same as none
+func equalValues(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Slice && vb.Kind() == reflect.Slice && va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// envPrefix is the prefix of configuration environment variables
+const envPrefix = "WHATSAPP_PROXY"
+
+// legacyEnv maps environment variable names used by earlier releases and
+// the old docker-compose.yml to the keys they set
+// They are still accepted, with a deprecation warning. SSL_CERT_FILE and
+// SSL_KEY_FILE are not: OpenSSL and Go use SSL_CERT_FILE for the system CA
+// bundle, so it is set on many hosts for unrelated reasons.
+var legacyEnv = map[string]string{
+	"PROXY_PORT":            "server.port",
+	"PROXY_BIND_ADDR":       "server.bind_addr",
+	"PROXY_IDLE_TIMEOUT":    "server.idle_timeout",
+	"PROXY_MAX_CONNECTIONS": "server.max_connections",
+	"SOCKS5_ENABLED":        "socks5.enabled",
+	"SOCKS5_HOST":           "socks5.host",
+	"SOCKS5_PORT":           "socks5.port",
+	"SOCKS5_USERNAME":       "socks5.username",
+	"SOCKS5_PASSWORD":       "socks5.password",
+	"SOCKS5_TIMEOUT":        "socks5.timeout",
+	"SSL_AUTO_GENERATE":     "ssl.auto_generate",
+	"SSL_DNS_NAMES":         "ssl.dns_names",
+	"SSL_IP_ADDRESSES":      "ssl.ip_addresses",
+	"SSL_VALIDITY_DAYS":     "ssl.validity_days",
+	"LOG_LEVEL":             "logging.level",
+	"LOG_FORMAT":            "logging.format",
+	"LOG_OUTPUT":            "logging.output",
+	"METRICS_ENABLED":       "metrics.enabled",
+	"METRICS_PORT":          "metrics.port",
+	"METRICS_BIND_ADDR":     "metrics.bind_addr",
+}
+
+// EnvVar is the environment variable bound to a config key
+type EnvVar struct {
+	// Key is the config key, e.g. "server.port"
+	Key string
+
+	// Name is the variable, e.g. "WHATSAPP_PROXY_SERVER_PORT"
+	Name string
+
+	// Legacy is a deprecated name also accepted, empty if none
+	Legacy string
+}
+
+// EnvVars returns the environment variable of every config key, in
+// declaration order
+func EnvVars() []EnvVar {
+	legacy := make(map[string]string, len(legacyEnv))
+	for name, key := range legacyEnv {
+		legacy[key] = name
+	}
+
+	keys := Keys()
+	vars := make([]EnvVar, len(keys))
+	for i, key := range keys {
+		vars[i] = EnvVar{Key: key, Name: envName(key), Legacy: legacy[key]}
+	}
+	return vars
+}
+
+// envName returns the environment variable name for a config key
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// bindEnv binds every config key to its environment variable
+// Lists of strings are comma separated; lists of objects, such as
+// ssl.certificates, are JSON arrays. It returns the config keys that were
+// set from legacy variables, mapped to the variable used.
+func bindEnv(v *viper.Viper) (map[string]string, error) {
+	for _, setting := range Settings(Default()) {
+		name := envName(setting.Key)
+		if isObjectList(setting.Value) {
+			// Viper cannot decode a string into a list of structs
+			if value := os.Getenv(name); value != "" {
+				if err := setJSONList(v, setting.Key, name, value); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := v.BindEnv(setting.Key, name); err != nil {
+			return nil, fmt.Errorf("failed to bind %s: %w", name, err)
+		}
+	}
+
+	names := make([]string, 0, len(legacyEnv))
+	for legacy := range legacyEnv {
+		names = append(names, legacy)
+	}
+	sort.Strings(names)
+
+	used := make(map[string]string)
+	for _, legacy := range names {
+		key := legacyEnv[legacy]
+		value := os.Getenv(legacy)
+		if value == "" {
+			continue
+		}
+		if os.Getenv(envName(key)) != "" {
+			log.Printf("[WARN] Environment variable %s is deprecated and ignored since %s is set", legacy, envName(key))
+			continue
+		}
+		log.Printf("[WARN] Environment variable %s is deprecated, use %s", legacy, envName(key))
+
+		// Durations were given in seconds
+		if _, ok := settingValue(key).(time.Duration); ok && isDigits(value) {
+			value += "s"
+		}
+		v.Set(key, value)
+		used[key] = legacy
+	}
+	return used, nil
+}
+
+// envSet reports whether the environment variable for key, or the legacy
+// variable it was read from, is set
+func envSet(key string, legacy map[string]string) bool {
+	if _, ok := legacy[key]; ok {
+		return true
+	}
+	return os.Getenv(envName(key)) != ""
+}
+
+// setJSONList decodes a JSON array from an environment variable into key
+func setJSONList(v *viper.Viper, key, name, value string) error {
+	var list []map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return fmt.Errorf("%s must be a JSON array of objects: %w", name, err)
+	}
+	items := make([]interface{}, len(list))
+	for i, item := range list {
+		items[i] = item
+	}
+	v.Set(key, items)
+	return nil
+}
+
+// isObjectList reports whether a setting value is a list of structs
+func isObjectList(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct
+}
+
+// settingValue returns the default value of key
+func settingValue(key string) interface{} {
+	setting, _ := Default().Lookup(key)
+	return setting.Value
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// location is where a setting is set in the config files
+type location struct {
+	file string
+	line int
+
+	// profile is the profile that set the value, empty for none
+	profile string
+}
+
+// String formats the location as file:line, with the profile if any
+func (l location) String() string {
+	s := fmt.Sprintf("%s:%d", l.file, l.line)
+	if l.profile != "" {
+		s += fmt.Sprintf(" (profile %s)", l.profile)
+	}
+	return s
+}
+
+// keyLocation is a mapping key found in a config file
+type keyLocation struct {
+	path string
+	location
+}
+
+// fileIndex locates settings in the merged config files
+type fileIndex struct {
+	// locations maps YAML paths of the merged configuration, e.g.
+	// "ssl.certificates[1].cert_file", to where they were set
+	locations map[string]location
+
+	// keys are the paths of every mapping key in every file, in merge order
+	keys []keyLocation
+
+	// files maps the nodes of every file to the file's name
+	files map[*yaml.Node]string
+}
+
+// newFileIndex creates an empty index
+func newFileIndex() *fileIndex {
+	return &fileIndex{
+		locations: make(map[string]location),
+		files:     make(map[*yaml.Node]string),
+	}
+}
+
+// collectKeys records the keys below node, which is at path in file
+func (ix *fileIndex) collectKeys(node *yaml.Node, path, file string) {
+	ix.files[node] = file
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinPath(path, strings.ToLower(key.Value))
+			ix.files[key] = file
+			ix.keys = append(ix.keys, keyLocation{keyPath, location{file: file, line: key.Line}})
+			ix.collectKeys(value, keyPath, file)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			ix.collectKeys(item, index(path, i), file)
+		}
+	}
+}
+
+// addTree records the locations of value, set by key at path, and of
+// everything below it; profile is the profile being applied, if any
+func (ix *fileIndex) addTree(key, value *yaml.Node, path string, profile string) {
+	ix.locations[path] = location{file: ix.files[key], line: key.Line, profile: profile}
+	ix.addChildren(resolveAlias(value), path, profile)
+}
+
+// addChildren records the locations of the items and keys below node
+func (ix *fileIndex) addChildren(node *yaml.Node, path string, profile string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			ix.addTree(node.Content[i], node.Content[i+1], joinPath(path, strings.ToLower(node.Content[i].Value)), profile)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := index(path, i)
+			ix.locations[itemPath] = location{file: ix.files[item], line: item.Line, profile: profile}
+			ix.addChildren(resolveAlias(item), itemPath, profile)
+		}
+	}
+}
+
+// removeUnder forgets the locations below path, whose value is replaced
+func (ix *fileIndex) removeUnder(path string) {
+	for p := range ix.locations {
+		if strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+			delete(ix.locations, p)
+		}
+	}
+}
+
+// locate returns where path, or its closest ancestor, is set
+func (ix *fileIndex) locate(path string) (location, bool) {
+	for ; path != ""; path = parentPath(path) {
+		if loc, ok := ix.locations[path]; ok {
+			return loc, true
+		}
+	}
+	return location{}, false
+}
+
+// unknownKeys returns the keys in the files that are not settings,
+// reporting only the outermost of nested unknown keys
+// Keys inside profiles are checked whether or not the profile is used.
+func (ix *fileIndex) unknownKeys() []keyLocation {
+	known := knownPaths()
+	var unknown []keyLocation
+	for _, key := range ix.keys {
+		if known[settingPath(key.path)] {
+			continue
+		}
+		nested := false
+		for _, u := range unknown {
+			if strings.HasPrefix(key.path, u.path+".") || strings.HasPrefix(key.path, u.path+"[") {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+// settingPath returns the setting path a file key refers to, without list
+// indices and with any profiles.<name> prefix removed
+func settingPath(path string) string {
+	path = listIndex.ReplaceAllString(path, "")
+	if rest, ok := strings.CutPrefix(path, "profiles."); ok {
+		if _, setting, found := strings.Cut(rest, "."); found {
+			return setting
+		}
+		return "profiles"
+	}
+	return path
+}
+
+// listIndex matches the list indices in a YAML path
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// parentPath returns the path containing path, empty at the top level
+func parentPath(path string) string {
+	if strings.HasSuffix(path, "]") {
+		return path[:strings.LastIndex(path, "[")]
+	}
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// settingKey returns the config key of the setting at path, e.g.
+// "ssl.certificates" for "ssl.certificates[1].cert_file"
+func settingKey(path string) string {
+	if i := strings.Index(path, "["); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// knownPaths returns every path a config file may set, with list indices
+// removed
+func knownPaths() map[string]bool {
+	known := map[string]bool{"include": true, "profiles": true}
+	addKnownPaths(reflect.TypeOf(Config{}), "", known)
+	return known
+}
+
+// addKnownPaths adds the paths of the fields of struct type t
+func addKnownPaths(t reflect.Type, prefix string, known map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := joinPath(prefix, name)
+		known[key] = true
+
+		switch ft := field.Type; {
+		case ft.Kind() == reflect.Struct:
+			addKnownPaths(ft, key, known)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			addKnownPaths(ft.Elem(), key, known)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// confDir is the directory next to the main config file whose files are
+// merged after it
+const confDir = "conf.d"
+
+// configSearchPaths are searched for config.yaml when no file is given
+var configSearchPaths = []string{".", "$HOME/.whatsapp-proxy", "/etc/whatsapp-proxy"}
+
+// configLayer is one parsed config file
+type configLayer struct {
+	// path is the file's absolute path
+	path string
+
+	// name is the file as shown in locations, relative to the main config
+	// file's directory where possible
+	name string
+
+	// root is the top-level mapping, nil for an empty file
+	root *yaml.Node
+}
+
+// findConfigFile returns the first config.yaml or config.yml in the search
+// paths, empty if there is none
+func findConfigFile() string {
+	for _, dir := range configSearchPaths {
+		for _, name := range []string{"config.yaml", "config.yml"} {
+			path := filepath.Join(os.ExpandEnv(dir), name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// loadLayers reads the main config file, the files it includes and the
+// conf.d directory next to it, in merge order, and returns the directories
+// whose YAML files were merged
+// Included files are resolved relative to the main file; globs and
+// directories expand to their YAML files in lexical order. Only the main
+// file may include others.
+func loadLayers(mainFile string) ([]configLayer, []string, error) {
+	mainPath, err := filepath.Abs(mainFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve config file path: %w", err)
+	}
+	baseDir := filepath.Dir(mainPath)
+
+	main, err := readLayer(mainPath, mainFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	main.name = filepath.Base(mainPath)
+	includes, err := takeIncludes(main.root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", mainFile, err)
+	}
+
+	layers := []configLayer{main}
+	var dirs []string
+	seen := map[string]bool{mainPath: true}
+	add := func(paths []string) error {
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			layer, err := readLayer(path, displayPath(baseDir, path))
+			if err != nil {
+				return err
+			}
+			if nested, _ := takeIncludes(layer.root); len(nested) > 0 {
+				return fmt.Errorf("%s: include is only supported in the main config file", layer.name)
+			}
+			layers = append(layers, layer)
+		}
+		return nil
+	}
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(baseDir, include)
+		}
+		paths, dir, err := expandInclude(include)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: include %s: %w", mainFile, include, err)
+		}
+		if err := add(paths); err != nil {
+			return nil, nil, err
+		}
+		if dir {
+			dirs = append(dirs, include)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(baseDir, confDir)); err == nil && info.IsDir() {
+		dirs = append(dirs, filepath.Join(baseDir, confDir))
+		paths, err := yamlFiles(filepath.Join(baseDir, confDir))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := add(paths); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return layers, dirs, nil
+}
+
+// readLayer parses a config file
+func readLayer(path, name string) (configLayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configLayer{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return configLayer{}, fmt.Errorf("failed to parse config file %s: %w", name, err)
+	}
+
+	layer := configLayer{path: path, name: name}
+	if len(doc.Content) == 0 || isNull(doc.Content[0]) {
+		return layer, nil
+	}
+	if root := resolveAlias(doc.Content[0]); root.Kind == yaml.MappingNode {
+		layer.root = root
+		return layer, nil
+	}
+	return configLayer{}, fmt.Errorf("failed to parse config file %s: top level must be a mapping", name)
+}
+
+// takeIncludes removes the include list from a file's top-level mapping and
+// returns it; a single string is accepted as a one-item list
+func takeIncludes(root *yaml.Node) ([]string, error) {
+	node := removeKey(root, "include")
+	if node == nil || isNull(node) {
+		return nil, nil
+	}
+
+	var includes []string
+	if node.Kind == yaml.ScalarNode {
+		includes = []string{node.Value}
+	} else if err := node.Decode(&includes); err != nil {
+		return nil, fmt.Errorf("include must be a list of files: %w", err)
+	}
+	return includes, nil
+}
+
+// expandInclude returns the files an include entry names, and whether it
+// names a directory
+// Globs without matches include nothing; a missing plain path is an error.
+func expandInclude(include string) ([]string, bool, error) {
+	if strings.ContainsAny(include, "*?[") {
+		matches, err := filepath.Glob(include)
+		if err != nil {
+			return nil, false, err
+		}
+		sort.Strings(matches)
+		return matches, false, nil
+	}
+
+	info, err := os.Stat(include)
+	if err != nil {
+		return nil, false, err
+	}
+	if info.IsDir() {
+		files, err := yamlFiles(include)
+		return files, true, err
+	}
+	return []string{include}, false, nil
+}
+
+// yamlFiles returns the .yaml and .yml files in dir in lexical order,
+// skipping hidden files such as Kubernetes' ..data links
+func yamlFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || entry.IsDir() {
+			continue
+		}
+		if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, nil
+}
+
+// displayPath shows path relative to the main config file's directory when
+// it is inside it
+func displayPath(baseDir, path string) string {
+	if rel, err := filepath.Rel(baseDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// mergeLayers merges config files in order, then overlays the named
+// profiles, and records where each setting came from
+// Maps are merged key by key; scalars and lists replace the earlier value;
+// null removes it so the default applies.
+func mergeLayers(layers []configLayer, profiles []string) (map[string]interface{}, *fileIndex, error) {
+	ix := newFileIndex()
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+	for _, layer := range layers {
+		if layer.root == nil {
+			continue
+		}
+		ix.collectKeys(layer.root, "", layer.name)
+		mergeMapping(merged, layer.root, "", ix, "")
+	}
+
+	// Profiles may be defined in any file, and are not settings themselves
+	defined := removeKey(merged, "profiles")
+	ix.removeUnder("profiles")
+	for _, name := range profiles {
+		profile := findKey(defined, name)
+		if profile == nil {
+			return nil, nil, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(keyNames(defined), ", "))
+		}
+		if profile = resolveAlias(profile); isNull(profile) {
+			continue
+		}
+		if profile.Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("profile %q must be a mapping", name)
+		}
+		mergeMapping(merged, profile, "", ix, name)
+	}
+
+	var values map[string]interface{}
+	if err := merged.Decode(&values); err != nil {
+		return nil, nil, fmt.Errorf("failed to merge config files: %w", err)
+	}
+	return values, ix, nil
+}
+
+// mergeMapping merges the mapping src into dst; path is their YAML path and
+// profile the profile being applied, if any
+func mergeMapping(dst, src *yaml.Node, path string, ix *fileIndex, profile string) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], resolveAlias(src.Content[i+1])
+		keyPath := joinPath(path, strings.ToLower(key.Value))
+		j := keyIndex(dst, key.Value)
+
+		if isNull(value) {
+			if j >= 0 {
+				dst.Content = append(dst.Content[:j], dst.Content[j+2:]...)
+			}
+			ix.removeUnder(keyPath)
+			delete(ix.locations, keyPath)
+			continue
+		}
+
+		if j >= 0 && dst.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeMapping(dst.Content[j+1], value, keyPath, ix, profile)
+			continue
+		}
+
+		ix.removeUnder(keyPath)
+		ix.addTree(key, value, keyPath, profile)
+		if j >= 0 {
+			dst.Content[j+1] = value
+		} else {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
+
+// keyIndex returns the index of key's node in a mapping, -1 if absent
+// Keys are case-insensitive like viper's.
+func keyIndex(mapping *yaml.Node, key string) int {
+	if mapping == nil {
+		return -1
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if strings.EqualFold(mapping.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findKey returns the value of key in a mapping, nil if absent
+func findKey(mapping *yaml.Node, key string) *yaml.Node {
+	if i := keyIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// removeKey removes key from a mapping and returns its value, nil if absent
+func removeKey(mapping *yaml.Node, key string) *yaml.Node {
+	i := keyIndex(mapping, key)
+	if i < 0 {
+		return nil
+	}
+	value := mapping.Content[i+1]
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	return value
+}
+
+// keyNames returns the keys of a mapping
+func keyNames(mapping *yaml.Node) []string {
+	var names []string
+	if mapping != nil {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			names = append(names, mapping.Content[i].Value)
+		}
+	}
+	if len(names) == 0 {
+		return []string{"none"}
+	}
+	return names
+}
+
+// resolveAlias follows a YAML alias to its anchor
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// isNull reports whether node is an explicit or empty null
+func isNull(node *yaml.Node) bool {
+	return node != nil && node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// joinPath appends key to a YAML path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// secretFilePrefix marks a secret value read from a file, e.g.
+// file:/run/secrets/socks5_password
+const secretFilePrefix = "file:"
+
+// resolveSecrets replaces secret references with the secrets they name
+// Every field tagged `secret:"true"` may be set in one of three ways besides
+// plaintext: from its <name>_file companion field, as ${NAME} naming an
+// environment variable, or as file:<path>. Files are read on every load, so
+// rotated secrets take effect on reload.
+func resolveSecrets(cfg *Config) error {
+	return resolveSecretFields(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// resolveSecretFields walks struct fields like flatten, resolving secrets
+func resolveSecretFields(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := resolveSecretFields(fv, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Tag.Get("secret") != "true" || fv.Kind() != reflect.String {
+			continue
+		}
+
+		secret, err := resolveSecret(fv.String(), secretFile(v, name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		fv.SetString(secret)
+	}
+	return nil
+}
+
+// secretFile returns the value of the <name>_file companion of a secret
+// field, empty if there is none
+func secretFile(v reflect.Value, name string) string {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("mapstructure") == name+"_file" {
+			return v.Field(i).String()
+		}
+	}
+	return ""
+}
+
+// resolveSecret returns the secret that value refers to
+// Errors name the variable or file but never include secret material.
+func resolveSecret(value, file string) (string, error) {
+	if file != "" {
+		if value != "" {
+			return "", fmt.Errorf("set either the value or the _file option, not both")
+		}
+		return readSecretFile(file)
+	}
+
+	if name, ok := strings.CutPrefix(value, "${"); ok {
+		if name, ok = strings.CutSuffix(name, "}"); ok && name != "" {
+			secret, found := os.LookupEnv(name)
+			if !found {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			return secret, nil
+		}
+	}
+
+	if path, ok := strings.CutPrefix(value, secretFilePrefix); ok {
+		return readSecretFile(path)
+	}
+
+	return value, nil
+}
+
+// readSecretFile reads a secret from path
+// A trailing newline, as left by editors and `echo`, is not part of the
+// secret.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
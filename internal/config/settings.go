@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces secret values in printouts
+const redacted = "********"
+
+// Setting is a single effective configuration value
+type Setting struct {
+	// Key is the config path, e.g. "server.port"
+	Key string
+
+	// Value is the effective value
+	Value interface{}
+
+	// Secret marks values that must not be printed
+	Secret bool
+
+	// Source is where the value came from
+	Source Source
+
+	// Origin is the file and line, and profile if any, of a value from a
+	// config file, e.g. "conf.d/10-tls.yaml:4"
+	Origin string
+}
+
+// Display returns the value formatted for printing, with secrets redacted
+func (s Setting) Display() string {
+	if s.Secret {
+		if isZero(s.Value) {
+			return `""`
+		}
+		return redacted
+	}
+
+	switch v := s.Value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, item := range v {
+			quoted[i] = fmt.Sprintf("%q", item)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Settings flattens the configuration into settings ordered as declared
+// Fields tagged `secret:"true"` are marked secret
+func Settings(cfg *Config) []Setting {
+	var settings []Setting
+	flatten(reflect.ValueOf(cfg).Elem(), "", &settings)
+	return settings
+}
+
+// Lookup returns the effective setting for key, with secrets marked so that
+// Display redacts them
+func (c *Config) Lookup(key string) (Setting, bool) {
+	for _, setting := range Settings(c) {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Keys returns every configuration key in declaration order
+func Keys() []string {
+	settings := Settings(Default())
+	keys := make([]string, len(settings))
+	for i, s := range settings {
+		keys[i] = s.Key
+	}
+	return keys
+}
+
+// flatten walks struct fields using their mapstructure tags as key segments
+func flatten(v reflect.Value, prefix string, settings *[]Setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			flatten(fv, key, settings)
+			continue
+		}
+
+		*settings = append(*settings, Setting{
+			Key:    key,
+			Value:  fv.Interface(),
+			Secret: field.Tag.Get("secret") == "true",
+		})
+	}
+}
+
+// isZero reports whether a value is the zero value of its type
+func isZero(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
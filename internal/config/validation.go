@@ -1,141 +1,763 @@
 package config
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/sockopt"
 )
 
+// Severity classifies a configuration problem
+type Severity string
+
+const (
+	// SeverityError prevents the configuration from being used
+	SeverityError Severity = "error"
+	// SeverityWarning is reported but does not prevent startup
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a configuration problem found by validation
+type Problem struct {
+	// Path is the YAML path of the offending setting, e.g.
+	// "ssl.certificates[1].cert_file"
+	Path string
+
+	// File and Line are where Path is set in the config files; File is
+	// empty and Line 0 if unknown or the value did not come from a file
+	File string
+	Line int
+
+	Severity Severity
+	Err      error
+}
+
+// Error describes the problem with its path and, if known, file and line
+func (p Problem) Error() string {
+	if p.File != "" {
+		return fmt.Sprintf("%s (%s:%d): %v", p.Path, p.File, p.Line, p.Err)
+	}
+	return fmt.Sprintf("%s: %v", p.Path, p.Err)
+}
+
+// Unwrap returns the underlying error
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// ValidateOptions control how thoroughly a configuration is checked
+type ValidateOptions struct {
+	// Offline checks only the configuration itself, without DNS lookups or
+	// file system access, for CI and read-only or air-gapped environments
+	Offline bool
+}
+
+// validator collects problems; checks never change anything on disk
+type validator struct {
+	opts     ValidateOptions
+	problems []Problem
+}
+
+// errorf records an error at path
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: path, Severity: SeverityError, Err: fmt.Errorf(format, args...)})
+}
+
+// warnf records a warning at path
+func (v *validator) warnf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: path, Severity: SeverityWarning, Err: fmt.Errorf(format, args...)})
+}
+
+// fileExists records an error if file does not exist; skipped offline
+func (v *validator) fileExists(path, file, what string) {
+	if v.opts.Offline {
+		return
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		v.errorf(path, "%s does not exist: %s", what, file)
+	}
+}
+
+// err joins the errors found, ignoring warnings
+func (v *validator) err() error {
+	return errors.Join(errorsOnly(v.problems)...)
+}
+
+// errorsOnly returns the problems with error severity
+func errorsOnly(problems []Problem) []error {
+	var errs []error
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// checkSection runs a section check with full validation
+func checkSection(check func(v *validator)) error {
+	v := &validator{}
+	check(v)
+	return v.err()
+}
+
+// index returns the path of list item i
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
 // Validate validates the entire configuration
+// All errors are reported, joined into a single error; warnings are not
+// errors
 func (c *Config) Validate() error {
-	if err := c.Server.Validate(); err != nil {
-		return fmt.Errorf("server config: %w", err)
-	}
+	return errors.Join(c.ValidateAll()...)
+}
+
+// ValidateAll validates the entire configuration and returns every error
+// found instead of stopping at the first one
+func (c *Config) ValidateAll() []error {
+	return errorsOnly(c.Check(ValidateOptions{}))
+}
+
+// Check validates the entire configuration and returns every error and
+// warning, in declaration order
+func (c *Config) Check(opts ValidateOptions) []Problem {
+	v := &validator{opts: opts}
+
+	c.Server.check(v, "server")
 
 	if c.SOCKS5.Enabled {
-		if err := c.SOCKS5.Validate(); err != nil {
-			return fmt.Errorf("socks5 config: %w", err)
-		}
+		c.SOCKS5.check(v, "socks5")
 	}
 
-	if err := c.SSL.Validate(); err != nil {
-		return fmt.Errorf("ssl config: %w", err)
+	c.SSL.check(v, "ssl")
+	c.Logging.check(v, "logging")
+
+	if c.Metrics.Enabled {
+		c.Metrics.check(v, "metrics")
 	}
 
-	if err := c.Logging.Validate(); err != nil {
-		return fmt.Errorf("logging config: %w", err)
+	if c.Admin.Enabled {
+		if !c.Metrics.Enabled {
+			v.errorf("admin.enabled", "admin API requires the metrics server to be enabled")
+		} else if ip := net.ParseIP(c.Metrics.BindAddr); ip != nil && !ip.IsLoopback() {
+			v.warnf("admin.enabled", "admin API is reachable on %s; bind the metrics server to a loopback address", c.Metrics.BindAddr)
+		}
+		c.Admin.check(v, "admin")
 	}
 
+	c.Jabber.check(v, "jabber")
+	c.Upstream.TCP.check(v, "upstream.tcp", false)
+
+	listenerProblems(v, c.listeners())
+
+	return v.problems
+}
+
+// listener is a socket the proxy listens on
+type listener struct {
+	// path is the config path of the listener's port
+	path     string
+	name     string
+	bindAddr string
+	port     int
+}
+
+// listeners returns every socket the configuration listens on
+func (c *Config) listeners() []listener {
+	var listeners []listener
+	if c.Server.UnixSocket.Path == "" {
+		listeners = append(listeners, listener{"server.port", "proxy", c.Server.BindAddr, c.Server.Port})
+	}
 	if c.Metrics.Enabled {
-		if err := c.Metrics.Validate(); err != nil {
-			return fmt.Errorf("metrics config: %w", err)
-		}
+		listeners = append(listeners, listener{"metrics.port", "metrics", c.Metrics.BindAddr, c.Metrics.Port})
 	}
+	return listeners
+}
 
-	// Check for port conflicts
-	if c.Metrics.Enabled && c.Server.Port == c.Metrics.Port {
-		return fmt.Errorf("server port and metrics port cannot be the same")
+// listenerProblems reports listeners whose addresses collide
+func listenerProblems(v *validator, listeners []listener) {
+	for i, l := range listeners {
+		for _, other := range listeners[:i] {
+			if l.port == other.port && addrsOverlap(l.bindAddr, other.bindAddr) {
+				v.errorf(l.path, "%s listener %s conflicts with %s listener %s",
+					l.name, net.JoinHostPort(l.bindAddr, fmt.Sprint(l.port)),
+					other.name, net.JoinHostPort(other.bindAddr, fmt.Sprint(other.port)))
+				break
+			}
+		}
 	}
+}
 
-	return nil
+// addrsOverlap reports whether two bind addresses share an address; an
+// unspecified address such as 0.0.0.0 overlaps every other
+func addrsOverlap(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.IsUnspecified() || ipB.IsUnspecified() || ipA.Equal(ipB)
 }
 
 // Validate validates server configuration
 func (c *ServerConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "server") })
+}
+
+// maxDetectPeekLimit is the largest accepted detect_peek_limit
+const maxDetectPeekLimit = 64 * 1024
+
+func (c *ServerConfig) check(v *validator, path string) {
 	if c.Port < 1 || c.Port > 65535 {
-		return fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
+		v.errorf(path+".port", "port must be between 1 and 65535, got %d", c.Port)
 	}
 
 	if c.BindAddr == "" {
-		return fmt.Errorf("bind address cannot be empty")
-	}
-
-	// Validate bind address is a valid IP
-	if ip := net.ParseIP(c.BindAddr); ip == nil {
-		return fmt.Errorf("invalid bind address: %s", c.BindAddr)
+		v.errorf(path+".bind_addr", "bind address cannot be empty")
+	} else if ip := net.ParseIP(c.BindAddr); ip == nil {
+		// Validate bind address is a valid IP
+		v.errorf(path+".bind_addr", "invalid bind address: %s", c.BindAddr)
 	}
 
 	if c.IdleTimeout < 0 {
-		return fmt.Errorf("idle timeout cannot be negative")
+		v.errorf(path+".idle_timeout", "idle timeout cannot be negative")
 	}
 
 	if c.MaxConnections < 1 {
-		return fmt.Errorf("max connections must be at least 1, got %d", c.MaxConnections)
+		v.errorf(path+".max_connections", "max connections must be at least 1, got %d", c.MaxConnections)
+	}
+
+	if c.DrainTimeout < 0 {
+		v.errorf(path+".drain_timeout", "drain timeout cannot be negative")
+	}
+
+	if c.ShutdownTimeout < 0 {
+		v.errorf(path+".shutdown_timeout", "shutdown timeout cannot be negative")
 	}
 
-	return nil
+	if c.DetectPeekLimit < 0 || c.DetectPeekLimit > maxDetectPeekLimit {
+		v.errorf(path+".detect_peek_limit", "detect peek limit must be between 0 and %d, got %d", maxDetectPeekLimit, c.DetectPeekLimit)
+	}
+
+	if c.DetectTimeout < 0 {
+		v.errorf(path+".detect_timeout", "detect timeout cannot be negative")
+	}
+
+	if c.ShutdownTimeout > 0 && c.DrainTimeout > c.ShutdownTimeout {
+		v.errorf(path+".drain_timeout", "drain timeout (%s) cannot exceed shutdown timeout (%s)", c.DrainTimeout, c.ShutdownTimeout)
+	}
+
+	c.Fallback.check(v, path+".fallback")
+
+	if c.UnixSocket.Path != "" {
+		c.UnixSocket.check(v, path+".unix_socket")
+	} else {
+		c.TCP.check(v, path+".tcp", true)
+	}
+
+	if c.Acceptors < 0 || c.Acceptors > maxAcceptors {
+		v.errorf(path+".acceptors", "acceptors must be between 0 and %d, got %d", maxAcceptors, c.Acceptors)
+	} else if c.Acceptors > 1 {
+		switch {
+		case c.UnixSocket.Path != "":
+			v.errorf(path+".acceptors", "multiple acceptors need a TCP listener, not unix_socket")
+		case runtime.GOOS == "windows":
+			v.errorf(path+".acceptors", "multiple acceptors need SO_REUSEPORT, which Windows does not have")
+		case runtime.GOOS != "linux":
+			v.warnf(path+".acceptors", "%s does not balance connections across SO_REUSEPORT listeners", runtime.GOOS)
+		}
+	}
+
+	if c.AcceptRate < 0 {
+		v.errorf(path+".accept_rate", "accept rate cannot be negative")
+	}
+	if c.AcceptRate > 0 && c.AcceptBurst < 1 {
+		v.errorf(path+".accept_burst", "accept burst must be at least 1 with accept_rate set, got %d", c.AcceptBurst)
+	}
 }
 
-// Validate validates SOCKS5 configuration
-func (c *SOCKS5Config) Validate() error {
-	if c.Host == "" {
-		return fmt.Errorf("socks5 host cannot be empty")
+// maxAcceptors is the largest accepted number of acceptors
+const maxAcceptors = 256
+
+// Validate validates the Unix socket settings
+func (c *UnixSocketConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "server.unix_socket") })
+}
+
+// Validate validates socket options of a listener, or of upstream
+// connections if listener is false
+func (c *TCPConfig) Validate(listener bool) error {
+	path := "upstream.tcp"
+	if listener {
+		path = "server.tcp"
 	}
+	return checkSection(func(v *validator) { c.check(v, path, listener) })
+}
 
-	if c.Port < 1 || c.Port > 65535 {
-		return fmt.Errorf("socks5 port must be between 1 and 65535, got %d", c.Port)
+func (c *TCPConfig) check(v *validator, path string, listener bool) {
+	if c.ReadBuffer < 0 {
+		v.errorf(path+".read_buffer", "read buffer cannot be negative")
+	}
+	if c.WriteBuffer < 0 {
+		v.errorf(path+".write_buffer", "write buffer cannot be negative")
+	}
+	if c.Mark < 0 || int64(c.Mark) > math.MaxUint32 {
+		v.errorf(path+".mark", "mark must be between 0 and %d, got %d", uint32(math.MaxUint32), c.Mark)
+	}
+	if c.TOS < 0 || c.TOS > 255 {
+		v.errorf(path+".tos", "tos must be between 0 and 255, got %d", c.TOS)
+	}
+	if c.ReusePort && !listener {
+		v.warnf(path+".reuse_port", "reuse_port only applies to listeners")
 	}
 
-	if c.Timeout < 0 {
-		return fmt.Errorf("socks5 timeout cannot be negative")
+	// Ask the kernel whether it accepts the options; a refused option is
+	// skipped at runtime, so it is only a warning
+	if v.opts.Offline {
+		return
+	}
+	for _, err := range sockopt.Probe(c.SocketOptions(), listener) {
+		var optErr *sockopt.OptionError
+		if errors.As(err, &optErr) {
+			v.warnf(path+"."+optErr.Option, "%s is not supported here and will be ignored: %v", optErr.Option, optErr.Err)
+		} else {
+			v.warnf(path, "cannot check socket options: %v", err)
+		}
+	}
+}
+
+// maxUnixPathLen is the longest socket path every supported system accepts
+const maxUnixPathLen = 103
+
+func (c *UnixSocketConfig) check(v *validator, path string) {
+	if len(c.Path) > maxUnixPathLen {
+		v.errorf(path+".path", "socket path is %d bytes long, the limit is %d", len(c.Path), maxUnixPathLen)
 	}
 
-	// Validate that host is resolvable or valid IP
-	if ip := net.ParseIP(c.Host); ip == nil {
-		// Not an IP, try to resolve hostname
+	if dir := filepath.Dir(c.Path); !v.opts.Offline {
+		if info, err := os.Stat(dir); err != nil {
+			v.warnf(path+".path", "socket directory %s does not exist", dir)
+		} else if !info.IsDir() {
+			v.errorf(path+".path", "socket directory %s is not a directory", dir)
+		}
+	}
+
+	if _, err := c.FileMode(); err != nil {
+		v.errorf(path+".mode", "%v", err)
+	}
+
+	if (c.Owner != "" || c.Group != "") && runtime.GOOS == "windows" {
+		v.warnf(path+".owner", "socket ownership cannot be changed on Windows")
+	}
+}
+
+// Validate validates the fallback settings
+func (c *FallbackConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "server.fallback") })
+}
+
+func (c *FallbackConfig) check(v *validator, path string) {
+	switch c.Action {
+	case "", "close", "hold", "reset":
+	case "forward":
+		if c.Target == "" {
+			v.errorf(path+".target", "fallback target is required when action is forward")
+		} else if _, _, err := net.SplitHostPort(c.Target); err != nil {
+			v.errorf(path+".target", "invalid fallback target %q: %w", c.Target, err)
+		}
+	default:
+		v.errorf(path+".action", "unknown fallback action %q (must be close, forward, hold or reset)", c.Action)
+	}
+
+	if c.HoldMin < 0 || c.HoldMax < 0 {
+		v.errorf(path+".hold_min", "fallback hold_min and hold_max cannot be negative")
+	} else if c.HoldMax < c.HoldMin {
+		v.errorf(path+".hold_max", "fallback hold_max (%s) cannot be less than hold_min (%s)", c.HoldMax, c.HoldMin)
+	}
+
+	if c.SampleBytes < 0 || c.SampleBytes > maxDetectPeekLimit {
+		v.errorf(path+".sample_bytes", "fallback sample_bytes must be between 0 and %d, got %d", maxDetectPeekLimit, c.SampleBytes)
+	}
+
+	if c.SampleRate < 0 {
+		v.errorf(path+".sample_rate", "fallback sample_rate cannot be negative")
+	}
+}
+
+// Validate validates SOCKS5 configuration
+func (c *SOCKS5Config) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "socks5") })
+}
+
+func (c *SOCKS5Config) check(v *validator, path string) {
+	if c.Host == "" {
+		v.errorf(path+".host", "socks5 host cannot be empty")
+	} else if ip := net.ParseIP(c.Host); ip == nil && !v.opts.Offline {
+		// The upstream is dialed per connection, so a name that does not
+		// resolve yet only matters once traffic arrives
 		if _, err := net.LookupHost(c.Host); err != nil {
-			return fmt.Errorf("cannot resolve socks5 host %s: %w", c.Host, err)
+			v.warnf(path+".host", "cannot resolve socks5 host %s: %w", c.Host, err)
 		}
 	}
 
-	return nil
+	if c.Port < 1 || c.Port > 65535 {
+		v.errorf(path+".port", "socks5 port must be between 1 and 65535, got %d", c.Port)
+	}
+
+	if c.Timeout < 0 {
+		v.errorf(path+".timeout", "socks5 timeout cannot be negative")
+	}
 }
 
 // Validate validates SSL configuration
 func (c *SSLConfig) Validate() error {
-	if !c.AutoGenerate {
+	return checkSection(func(v *validator) { c.check(v, "ssl") })
+}
+
+func (c *SSLConfig) check(v *validator, path string) {
+	if !c.AutoGenerate && !c.ACME.Enabled {
 		// Custom certificates - must provide both cert and key
 		if c.CertFile == "" {
-			return fmt.Errorf("cert_file must be specified when auto_generate is false")
+			v.errorf(path+".cert_file", "cert_file must be specified when auto_generate is false")
+		} else {
+			v.fileExists(path+".cert_file", c.CertFile, "cert file")
 		}
+
 		if c.KeyFile == "" {
-			return fmt.Errorf("key_file must be specified when auto_generate is false")
+			v.errorf(path+".key_file", "key_file must be specified when auto_generate is false")
+		} else {
+			v.fileExists(path+".key_file", c.KeyFile, "key file")
+		}
+	} else if c.CacheDir != "" && !v.opts.Offline {
+		// The cache directory is created at startup if missing
+		if info, err := os.Stat(c.CacheDir); err == nil && !info.IsDir() {
+			v.errorf(path+".cache_dir", "cache directory %s is not a directory", c.CacheDir)
 		}
+	}
 
-		// Check files exist
-		if _, err := os.Stat(c.CertFile); os.IsNotExist(err) {
-			return fmt.Errorf("cert file does not exist: %s", c.CertFile)
+	// Validate IP addresses
+	for i, ipStr := range c.IPAddresses {
+		if ip := net.ParseIP(ipStr); ip == nil {
+			v.errorf(index(path+".ip_addresses", i), "invalid IP address: %s", ipStr)
 		}
-		if _, err := os.Stat(c.KeyFile); os.IsNotExist(err) {
-			return fmt.Errorf("key file does not exist: %s", c.KeyFile)
+	}
+
+	certificateEntryChecks(v, path+".certificates", c.Certificates)
+
+	if c.WatchInterval < 0 {
+		v.errorf(path+".watch_interval", "watch interval cannot be negative, got %v", c.WatchInterval)
+	}
+
+	if c.ExpiryWarningDays < 0 {
+		v.errorf(path+".expiry_warning_days", "expiry warning days cannot be negative, got %d", c.ExpiryWarningDays)
+	}
+
+	if c.ValidityDays < 1 || c.ValidityDays > 3650 {
+		v.errorf(path+".validity_days", "validity days must be between 1 and 3650, got %d", c.ValidityDays)
+	}
+
+	if c.CA.Enabled {
+		if !c.AutoGenerate {
+			v.errorf(path+".ca.enabled", "ca requires auto_generate to be true")
 		}
-	} else {
-		// Auto-generate - validate cache directory
-		if c.CacheDir != "" {
-			// Try to create cache directory if it doesn't exist
-			if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
-				return fmt.Errorf("cannot create cache directory %s: %w", c.CacheDir, err)
+		c.CA.check(v, path+".ca")
+	}
+
+	if c.ACME.Enabled {
+		if c.CA.Enabled {
+			v.errorf(path+".acme.enabled", "acme and ca cannot both be enabled")
+		}
+		c.ACME.check(v, path+".acme", c.DNSNames)
+	}
+
+	if c.KeyType != "" && !isKnownKeyType(c.KeyType) {
+		v.errorf(path+".key_type", "unknown key type %q (must be rsa-2048, rsa-3072, rsa-4096, ecdsa-p256, ecdsa-p384 or ed25519)", c.KeyType)
+	}
+	c.TLS.check(v, path+".tls")
+	c.ClientAuth.check(v, path+".client_auth")
+}
+
+// Validate validates client certificate authentication settings
+func (c *ClientAuthConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "ssl.client_auth") })
+}
+
+func (c *ClientAuthConfig) check(v *validator, path string) {
+	switch c.Mode {
+	case "", "none":
+		return
+	case "optional", "require":
+	default:
+		v.errorf(path+".mode", "unknown client_auth mode %q (must be none, optional or require)", c.Mode)
+		return
+	}
+
+	if len(c.CAFiles) == 0 {
+		v.errorf(path+".ca_files", "client_auth ca_files must not be empty when mode is %s", c.Mode)
+	}
+	for _, files := range []struct {
+		key   string
+		paths []string
+	}{{"ca_files", c.CAFiles}, {"crl_files", c.CRLFiles}} {
+		for i, file := range files.paths {
+			if v.opts.Offline {
+				break
+			}
+			if _, err := os.Stat(file); err != nil {
+				v.errorf(index(path+"."+files.key, i), "client_auth %s: %w", files.key, err)
 			}
 		}
 	}
 
-	// Validate IP addresses
-	for _, ipStr := range c.IPAddresses {
-		if ip := net.ParseIP(ipStr); ip == nil {
-			return fmt.Errorf("invalid IP address: %s", ipStr)
+	for i, source := range c.Identity {
+		switch source {
+		case "subject_cn", "subject", "san_dns", "san_email", "san_uri":
+		default:
+			v.errorf(index(path+".identity", i), "unknown client_auth identity %q (must be subject_cn, subject, san_dns, san_email or san_uri)", source)
 		}
 	}
 
-	if c.ValidityDays < 1 || c.ValidityDays > 3650 {
-		return fmt.Errorf("validity days must be between 1 and 3650, got %d", c.ValidityDays)
+	for i, route := range c.Routes {
+		routePath := index(path+".routes", i)
+		if route.Identity == "" {
+			v.errorf(routePath+".identity", "client_auth route identity must not be empty")
+		}
+		if _, _, err := net.SplitHostPort(route.Target); err != nil {
+			v.errorf(routePath+".target", "invalid target %q: %w", route.Target, err)
+		}
+	}
+}
+
+// isKnownKeyType reports whether name is a supported key type; like the
+// ssl package it ignores case and the dash in curve names
+func isKnownKeyType(name string) bool {
+	switch strings.ReplaceAll(strings.ToLower(name), "p-", "p") {
+	case "rsa-2048", "rsa-3072", "rsa-4096", "ecdsa-p256", "ecdsa-p384", "ed25519":
+		return true
+	}
+	return false
+}
+
+// tlsVersions orders the supported TLS version names
+var tlsVersions = map[string]int{"1.0": 0, "1.1": 1, "1.2": 2, "1.3": 3}
+
+// Validate validates the TLS policy
+func (c *TLSConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "ssl.tls") })
+}
+
+func (c *TLSConfig) check(v *validator, path string) {
+	minVersion, minOK := tlsVersions[c.MinVersion]
+	if c.MinVersion != "" && !minOK {
+		v.errorf(path+".min_version", "unknown tls min_version %q (must be 1.0, 1.1, 1.2 or 1.3)", c.MinVersion)
+	} else if minOK && minVersion < tlsVersions["1.2"] {
+		v.warnf(path+".min_version", "tls %s is deprecated and insecure; clients should use 1.2 or later", c.MinVersion)
+	}
+	if c.MaxVersion != "" {
+		maxVersion, ok := tlsVersions[c.MaxVersion]
+		if !ok {
+			v.errorf(path+".max_version", "unknown tls max_version %q (must be 1.0, 1.1, 1.2 or 1.3)", c.MaxVersion)
+		} else if minOK && maxVersion < minVersion {
+			v.errorf(path+".max_version", "tls max_version %s is below min_version %s", c.MaxVersion, c.MinVersion)
+		}
+	}
+
+	for i, name := range c.CipherSuites {
+		if err := cipherSuiteProblem(name); err != nil {
+			v.errorf(index(path+".cipher_suites", i), "%w", err)
+		}
+	}
+
+	for i, name := range c.Curves {
+		switch strings.ToLower(name) {
+		case "x25519", "p-256", "p-384", "p-521":
+		default:
+			v.errorf(index(path+".curves", i), "unknown tls curve %q (must be X25519, P-256, P-384 or P-521)", name)
+		}
+	}
+
+	for i, proto := range c.ALPN {
+		if proto == "" || len(proto) > 255 {
+			v.errorf(index(path+".alpn", i), "invalid tls alpn protocol %q", proto)
+		}
+	}
+
+	if c.SessionTickets.Enabled {
+		if c.SessionTickets.RotationInterval < time.Minute {
+			v.errorf(path+".session_tickets.rotation_interval", "tls session ticket rotation_interval must be at least 1m, got %v", c.SessionTickets.RotationInterval)
+		}
+		if c.SessionTickets.KeyFile != "" && !v.opts.Offline {
+			if _, err := os.Stat(filepath.Dir(c.SessionTickets.KeyFile)); err != nil {
+				v.errorf(path+".session_tickets.key_file", "tls session ticket key_file directory: %w", err)
+			}
+		}
+	}
+}
+
+// cipherSuiteProblem reports why a cipher suite name cannot be configured
+func cipherSuiteProblem(name string) error {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name != name {
+			continue
+		}
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			return fmt.Errorf("tls cipher suite %s is TLS 1.3 only and cannot be configured", name)
+		}
+		return nil
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			return fmt.Errorf("tls cipher suite %s is insecure", name)
+		}
+	}
+	return fmt.Errorf("unknown tls cipher suite %q", name)
+}
+
+// certificateEntryChecks validates SNI certificate entries
+func certificateEntryChecks(v *validator, path string, entries []CertificateEntry) {
+	seen := make(map[string]int)
+
+	for i, entry := range entries {
+		entryPath := index(path, i)
+		if len(entry.Names) == 0 {
+			v.errorf(entryPath+".names", "names must not be empty")
+		}
+		for j, name := range entry.Names {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			if !isValidCertificateName(name) {
+				v.errorf(index(entryPath+".names", j), "invalid name %q", name)
+				continue
+			}
+			if k, ok := seen[name]; ok {
+				v.errorf(index(entryPath+".names", j), "name %q is already used by %s", name, index(path, k))
+				continue
+			}
+			seen[name] = i
+		}
+
+		if entry.AutoGenerate {
+			if entry.CertFile != "" || entry.KeyFile != "" {
+				v.errorf(entryPath+".auto_generate", "cert_file and key_file cannot be combined with auto_generate")
+			}
+			continue
+		}
+		for _, file := range []struct{ key, path string }{{"cert_file", entry.CertFile}, {"key_file", entry.KeyFile}} {
+			if file.path == "" {
+				v.errorf(entryPath+"."+file.key, "%s must be specified when auto_generate is false", file.key)
+			} else {
+				v.fileExists(entryPath+"."+file.key, file.path, file.key)
+			}
+		}
+	}
+}
+
+// isValidCertificateName reports whether name is a host name, optionally
+// with a wildcard as its whole leftmost label
+func isValidCertificateName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 || strings.Contains(name, "*") {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
 	}
+	return true
+}
 
-	return nil
+// Validate validates ACME configuration
+func (c *ACMEConfig) Validate(dnsNames []string) error {
+	return checkSection(func(v *validator) { c.check(v, "ssl.acme", dnsNames) })
+}
+
+func (c *ACMEConfig) check(v *validator, path string, dnsNames []string) {
+	if u, err := url.Parse(c.DirectoryURL); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		v.errorf(path+".directory_url", "invalid acme directory url: %q", c.DirectoryURL)
+	}
+
+	if !c.AcceptTOS {
+		v.errorf(path+".accept_tos", "acme accept_tos must be true to register with the CA")
+	}
+
+	domains, domainsPath := c.Domains, path+".domains"
+	if len(domains) == 0 {
+		domains, domainsPath = dnsNames, "ssl.dns_names"
+	}
+	if len(domains) == 0 {
+		v.errorf(path+".domains", "acme requires domains or dns_names")
+	}
+	for i, domain := range domains {
+		// Wildcards need DNS-01, which is not supported
+		if domain == "localhost" || strings.Contains(domain, "*") || net.ParseIP(domain) != nil || !strings.Contains(domain, ".") {
+			v.errorf(index(domainsPath, i), "acme domain %q must be a public DNS name", domain)
+		}
+	}
+
+	if len(c.Challenges) == 0 {
+		v.errorf(path+".challenges", "acme challenges must not be empty")
+	}
+	for i, challenge := range c.Challenges {
+		if challenge != "http-01" && challenge != "tls-alpn-01" {
+			v.errorf(index(path+".challenges", i), "unknown acme challenge %q (must be http-01 or tls-alpn-01)", challenge)
+		}
+	}
+
+	if c.RenewBeforeDays < 1 || c.RenewBeforeDays > 60 {
+		v.errorf(path+".renew_before_days", "acme renew_before_days must be between 1 and 60, got %d", c.RenewBeforeDays)
+	}
+
+	if c.DirectoryCAFile != "" && !v.opts.Offline {
+		if _, err := os.Stat(c.DirectoryCAFile); err != nil {
+			v.errorf(path+".directory_ca_file", "acme directory ca file: %w", err)
+		}
+	}
+}
+
+// Validate validates local CA configuration
+func (c *CAConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "ssl.ca") })
+}
+
+func (c *CAConfig) check(v *validator, path string) {
+	if c.Passphrase == "" {
+		v.errorf(path+".passphrase", "ca passphrase or passphrase_file must be set to protect the root key")
+	} else if len(c.Passphrase) < 8 {
+		v.errorf(path+".passphrase", "ca passphrase must be at least 8 characters, got %d", len(c.Passphrase))
+	}
+
+	if c.ValidityDays < 1 || c.ValidityDays > 7300 {
+		v.errorf(path+".validity_days", "ca validity days must be between 1 and 7300, got %d", c.ValidityDays)
+	}
+
+	// 397 days is the maximum leaf lifetime accepted by browsers
+	if c.LeafValidityDays < 1 || c.LeafValidityDays > 397 {
+		v.errorf(path+".leaf_validity_days", "ca leaf validity days must be between 1 and 397, got %d", c.LeafValidityDays)
+	} else if c.LeafValidityDays > c.ValidityDays {
+		v.errorf(path+".leaf_validity_days", "ca leaf validity (%d days) cannot exceed root validity (%d days)", c.LeafValidityDays, c.ValidityDays)
+	}
 }
 
 // Validate validates logging configuration
 func (c *LoggingConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "logging") })
+}
+
+func (c *LoggingConfig) check(v *validator, path string) {
 	validLevels := map[string]bool{
 		"debug": true,
 		"info":  true,
@@ -144,7 +766,7 @@ func (c *LoggingConfig) Validate() error {
 	}
 
 	if !validLevels[c.Level] {
-		return fmt.Errorf("invalid log level: %s (must be debug, info, warn, or error)", c.Level)
+		v.errorf(path+".level", "invalid log level: %s (must be debug, info, warn, or error)", c.Level)
 	}
 
 	validFormats := map[string]bool{
@@ -153,37 +775,78 @@ func (c *LoggingConfig) Validate() error {
 	}
 
 	if !validFormats[c.Format] {
-		return fmt.Errorf("invalid log format: %s (must be text or json)", c.Format)
+		v.errorf(path+".format", "invalid log format: %s (must be text or json)", c.Format)
 	}
 
 	// Validate output
-	if c.Output != "stdout" && c.Output != "stderr" {
+	if c.Output != "stdout" && c.Output != "stderr" && !v.opts.Offline {
 		// Assume it's a file path - validate directory exists
 		dir := filepath.Dir(c.Output)
 		if dir != "." && dir != "" {
 			if _, err := os.Stat(dir); os.IsNotExist(err) {
-				return fmt.Errorf("log output directory does not exist: %s", dir)
+				v.errorf(path+".output", "log output directory does not exist: %s", dir)
 			}
 		}
 	}
-
-	return nil
 }
 
 // Validate validates metrics configuration
 func (c *MetricsConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "metrics") })
+}
+
+func (c *MetricsConfig) check(v *validator, path string) {
 	if c.Port < 1 || c.Port > 65535 {
-		return fmt.Errorf("metrics port must be between 1 and 65535, got %d", c.Port)
+		v.errorf(path+".port", "metrics port must be between 1 and 65535, got %d", c.Port)
 	}
 
 	if c.BindAddr == "" {
-		return fmt.Errorf("metrics bind address cannot be empty")
+		v.errorf(path+".bind_addr", "metrics bind address cannot be empty")
+	} else if ip := net.ParseIP(c.BindAddr); ip == nil {
+		// Validate bind address is a valid IP
+		v.errorf(path+".bind_addr", "invalid metrics bind address: %s", c.BindAddr)
+	}
+}
+
+// Validate validates Jabber routing configuration
+func (c *JabberConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "jabber") })
+}
+
+func (c *JabberConfig) check(v *validator, path string) {
+	// An empty default target keeps the built-in chat server
+	if c.DefaultTarget != "" {
+		if _, _, err := net.SplitHostPort(c.DefaultTarget); err != nil {
+			v.errorf(path+".default_target", "invalid default_target %q: %w", c.DefaultTarget, err)
+		}
+	}
+
+	for i, route := range c.Routes {
+		routePath := index(path+".routes", i)
+		if !isValidCertificateName(strings.ToLower(strings.TrimSuffix(route.Domain, "."))) {
+			v.errorf(routePath+".domain", "invalid domain %q", route.Domain)
+		}
+		if _, _, err := net.SplitHostPort(route.Target); err != nil {
+			v.errorf(routePath+".target", "invalid target %q: %w", route.Target, err)
+		}
 	}
 
-	// Validate bind address is a valid IP
-	if ip := net.ParseIP(c.BindAddr); ip == nil {
-		return fmt.Errorf("invalid metrics bind address: %s", c.BindAddr)
+	for i, domain := range c.AllowedDomains {
+		if !isValidCertificateName(strings.ToLower(strings.TrimSuffix(domain, "."))) {
+			v.errorf(index(path+".allowed_domains", i), "invalid allowed domain %q", domain)
+		}
 	}
+}
+
+// Validate validates admin API configuration
+func (c *AdminConfig) Validate() error {
+	return checkSection(func(v *validator) { c.check(v, "admin") })
+}
 
-	return nil
+func (c *AdminConfig) check(v *validator, path string) {
+	if c.Token == "" {
+		v.errorf(path+".token", "admin token or token_file must be set when the admin API is enabled")
+	} else if len(c.Token) < 16 {
+		v.errorf(path+".token", "admin token must be at least 16 characters, got %d", len(c.Token))
+	}
 }
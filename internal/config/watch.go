@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce collapses the burst of events an editor or deployment tool
+// produces when saving a file into one notification
+const watchDebounce = 500 * time.Millisecond
+
+// Watcher notifies about changes to config files
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	changes chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// watchSet decides which file system events are config changes
+type watchSet struct {
+	// files are the watched config files
+	files map[string]bool
+
+	// anyIn are directories where any change counts
+	anyIn map[string]bool
+
+	// yamlIn are directories where changes to YAML files count
+	yamlIn map[string]bool
+}
+
+// matches reports whether a change to name is a config change
+func (s *watchSet) matches(name string) bool {
+	name = filepath.Clean(name)
+	dir := filepath.Dir(name)
+	if s.files[name] || s.anyIn[dir] {
+		return true
+	}
+	ext := filepath.Ext(name)
+	return s.yamlIn[dir] && (ext == ".yaml" || ext == ".yml")
+}
+
+// Watch starts watching the config files and the directories whose YAML
+// files are merged
+// A file's directory is watched rather than the file, since editors and
+// configuration management tools often replace the file instead of writing
+// it in place. If a file is a symlink, as with Kubernetes ConfigMaps, any
+// change in its directory counts.
+func Watch(files, dirs []string) (*Watcher, error) {
+	set := &watchSet{
+		files:  make(map[string]bool),
+		anyIn:  make(map[string]bool),
+		yamlIn: make(map[string]bool),
+	}
+	watched := make(map[string]bool)
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve config file path: %w", err)
+		}
+		set.files[path] = true
+		watched[filepath.Dir(path)] = true
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			set.anyIn[filepath.Dir(path)] = true
+		}
+	}
+	for _, dir := range dirs {
+		path, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve config directory path: %w", err)
+		}
+		set.yamlIn[path] = true
+		watched[path] = true
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	for dir := range watched {
+		if err := fw.Add(dir); err != nil {
+			fw.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	w := &Watcher{
+		watcher: fw,
+		changes: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go w.loop(set)
+	return w, nil
+}
+
+// Changes delivers a value after a config file changed
+func (w *Watcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return w.watcher.Close()
+}
+
+// loop forwards debounced change events until the watcher is closed
+func (w *Watcher) loop(set *watchSet) {
+	var timer *time.Timer
+	notify := func() {
+		select {
+		case w.changes <- struct{}{}:
+		default:
+			// A reload is already pending
+		}
+	}
+
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !set.matches(event.Name) {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) && !event.Has(fsnotify.Remove) {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(watchDebounce, notify)
+			} else {
+				timer.Reset(watchDebounce)
+			}
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[WARN] Config file watch error: %v", err)
+		}
+	}
+}
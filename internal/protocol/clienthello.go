@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// TLS constants used when parsing a ClientHello
+const (
+	recordTypeHandshake      = 0x16
+	handshakeTypeClientHello = 0x01
+	recordHeaderLen          = 5
+	maxRecordLen             = 16384
+
+	extensionServerName = 0
+	extensionALPN       = 16
+)
+
+// ClientHello holds the fields of a TLS ClientHello used for routing
+type ClientHello struct {
+	// ServerName is the SNI host name, empty if none was sent
+	ServerName string
+
+	// ALPNProtocols lists the offered application protocols
+	ALPNProtocols []string
+}
+
+// errMalformedClientHello is returned for ClientHellos that cannot be parsed
+var errMalformedClientHello = errors.New("malformed TLS ClientHello")
+
+// PeekClientHello parses the ClientHello at the start of reader without
+// consuming it. Only ClientHellos contained in a single TLS record are
+// supported.
+func PeekClientHello(reader *bufio.Reader) (*ClientHello, error) {
+	header, err := reader.Peek(recordHeaderLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to peek TLS record header: %w", err)
+	}
+	if header[0] != recordTypeHandshake {
+		return nil, fmt.Errorf("not a TLS handshake record")
+	}
+
+	length := int(header[3])<<8 | int(header[4])
+	if length > maxRecordLen {
+		return nil, errMalformedClientHello
+	}
+
+	record, err := reader.Peek(recordHeaderLen + length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to peek TLS record: %w", err)
+	}
+	return ParseClientHello(record[recordHeaderLen:])
+}
+
+// ParseClientHello parses a ClientHello handshake message
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	s := cryptobyte.String(data)
+
+	var msgType uint8
+	var body cryptobyte.String
+	if !s.ReadUint8(&msgType) || msgType != handshakeTypeClientHello ||
+		!s.ReadUint24LengthPrefixed(&body) {
+		return nil, errMalformedClientHello
+	}
+
+	var sessionID, cipherSuites, compression cryptobyte.String
+	if !body.Skip(2+32) || // version and random
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!body.ReadUint8LengthPrefixed(&compression) {
+		return nil, errMalformedClientHello
+	}
+
+	hello := &ClientHello{}
+	if body.Empty() {
+		// No extensions
+		return hello, nil
+	}
+
+	var extensions cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errMalformedClientHello
+	}
+
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return nil, errMalformedClientHello
+		}
+
+		switch extType {
+		case extensionServerName:
+			var names cryptobyte.String
+			if !extData.ReadUint16LengthPrefixed(&names) {
+				return nil, errMalformedClientHello
+			}
+			for !names.Empty() {
+				var nameType uint8
+				var name cryptobyte.String
+				if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+					return nil, errMalformedClientHello
+				}
+				// Type 0 is host_name
+				if nameType == 0 {
+					hello.ServerName = string(name)
+				}
+			}
+
+		case extensionALPN:
+			var protos cryptobyte.String
+			if !extData.ReadUint16LengthPrefixed(&protos) {
+				return nil, errMalformedClientHello
+			}
+			for !protos.Empty() {
+				var proto cryptobyte.String
+				if !protos.ReadUint8LengthPrefixed(&proto) || len(proto) == 0 {
+					return nil, errMalformedClientHello
+				}
+				hello.ALPNProtocols = append(hello.ALPNProtocols, string(proto))
+			}
+		}
+	}
+
+	return hello, nil
+}
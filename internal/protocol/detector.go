@@ -2,9 +2,11 @@ package protocol
 
 import (
 	"bufio"
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"time"
 )
 
 // Protocol represents the detected protocol type
@@ -23,110 +25,119 @@ const (
 
 // String returns the string representation of the protocol
 func (p Protocol) String() string {
-	switch p {
-	case ProtocolHTTP:
-		return "HTTP"
-	case ProtocolHTTPS:
-		return "HTTPS"
-	case ProtocolJabber:
-		return "Jabber"
-	default:
-		return "Unknown"
+	protocolNames.RLock()
+	defer protocolNames.RUnlock()
+	if p > 0 && int(p) < len(protocolNames.byID) {
+		return protocolNames.byID[p]
 	}
+	return "Unknown"
 }
 
-// Detector detects the protocol from initial connection bytes
+// Detection defaults
+const (
+	// DefaultPeekLimit is how many bytes detection inspects at most
+	DefaultPeekLimit = 1024
+
+	// DefaultDetectTimeout bounds how long a client may take to send enough
+	// bytes for detection
+	DefaultDetectTimeout = 30 * time.Second
+)
+
+// defaultDetector detects the built-in protocols
+var defaultDetector = NewDetector(DefaultRegistry(), DefaultPeekLimit, 0)
+
+// Detector detects the protocol from initial connection bytes using the
+// matchers of a registry
 type Detector struct {
-	buffer []byte
+	registry  *Registry
+	peekLimit int
+	timeout   time.Duration
 }
 
-// NewDetector creates a new protocol detector
-func NewDetector() *Detector {
+// NewDetector creates a protocol detector
+// peekLimit caps the bytes inspected, and timeout bounds detection in
+// DetectConn; 0 uses DefaultPeekLimit and disables the timeout
+func NewDetector(registry *Registry, peekLimit int, timeout time.Duration) *Detector {
+	if peekLimit <= 0 {
+		peekLimit = DefaultPeekLimit
+	}
 	return &Detector{
-		buffer: make([]byte, 0, 1024),
+		registry:  registry,
+		peekLimit: peekLimit,
+		timeout:   timeout,
 	}
 }
 
-// Detect attempts to detect the protocol from the reader
-// It peeks at the first few bytes without consuming them
-func Detect(reader *bufio.Reader) (Protocol, error) {
-	// Peek at first few bytes (up to 32 bytes should be enough)
-	peek, err := reader.Peek(32)
-	if err != nil && err != io.EOF {
-		return ProtocolUnknown, fmt.Errorf("failed to peek bytes: %w", err)
-	}
-
-	if len(peek) == 0 {
-		return ProtocolUnknown, fmt.Errorf("no data to detect")
-	}
-
-	// Check for TLS/HTTPS (starts with 0x16 for TLS handshake)
-	if peek[0] == 0x16 {
-		// TLS handshake record
-		if len(peek) > 1 && peek[1] == 0x03 {
-			// SSL/TLS version (0x03 0x01 = TLS 1.0, 0x03 0x03 = TLS 1.2, etc.)
-			return ProtocolHTTPS, nil
-		}
-	}
-
-	// Check for HTTP methods
-	httpMethods := []string{
-		"GET ",
-		"POST ",
-		"PUT ",
-		"DELETE ",
-		"HEAD ",
-		"OPTIONS ",
-		"CONNECT ",
-		"PATCH ",
-		"TRACE ",
-	}
+// Registry returns the detector's matcher registry
+func (d *Detector) Registry() *Registry {
+	return d.registry
+}
 
-	for _, method := range httpMethods {
-		if bytes.HasPrefix(peek, []byte(method)) {
-			return ProtocolHTTP, nil
-		}
-	}
+// PeekLimit returns the most bytes the detector inspects
+func (d *Detector) PeekLimit() int {
+	return d.peekLimit
+}
 
-	// Check for Jabber/XMPP (starts with <?xml or <stream)
-	if bytes.HasPrefix(peek, []byte("<?xml")) ||
-		bytes.HasPrefix(peek, []byte("<stream:stream")) ||
-		bytes.HasPrefix(peek, []byte("<stream")) {
-		return ProtocolJabber, nil
+// DetectConn detects the protocol of conn, read through reader, within the
+// detector's timeout
+func (d *Detector) DetectConn(conn net.Conn, reader *bufio.Reader) (Protocol, error) {
+	if d.timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(d.timeout))
+		defer conn.SetReadDeadline(time.Time{})
 	}
-
-	return ProtocolUnknown, nil
+	return d.Detect(reader)
 }
 
-// DetectFromBytes detects protocol from a byte slice
-func DetectFromBytes(data []byte) Protocol {
-	if len(data) == 0 {
-		return ProtocolUnknown
+// Detect detects the protocol from the reader without consuming any bytes
+// It peeks incrementally until a matcher decides, the peek limit is reached
+// or the reader fails. The limit is capped at the reader's buffer size.
+func (d *Detector) Detect(reader *bufio.Reader) (Protocol, error) {
+	limit := d.peekLimit
+	if limit > reader.Size() {
+		limit = reader.Size()
 	}
 
-	// Check for TLS/HTTPS
-	if data[0] == 0x16 && len(data) > 1 && data[1] == 0x03 {
-		return ProtocolHTTPS
-	}
+	want := d.registry.minBytes()
+	for {
+		if want > limit {
+			want = limit
+		}
+		data, err := reader.Peek(want)
+		final := false
+		if err != nil {
+			var netErr net.Error
+			if err != io.EOF && !(errors.As(err, &netErr) && netErr.Timeout() && len(data) > 0) {
+				return ProtocolUnknown, fmt.Errorf("failed to peek bytes: %w", err)
+			}
+			final = true
+		} else if buffered := reader.Buffered(); buffered > len(data) {
+			// Use everything that already arrived
+			if buffered > limit {
+				buffered = limit
+			}
+			data, _ = reader.Peek(buffered)
+		}
 
-	// Check for HTTP methods
-	httpMethods := []string{
-		"GET ", "POST ", "PUT ", "DELETE ", "HEAD ",
-		"OPTIONS ", "CONNECT ", "PATCH ", "TRACE ",
-	}
+		if len(data) == 0 {
+			return ProtocolUnknown, fmt.Errorf("no data to detect")
+		}
 
-	for _, method := range httpMethods {
-		if bytes.HasPrefix(data, []byte(method)) {
-			return ProtocolHTTP
+		proto, result := d.registry.Match(data, final || len(data) >= limit)
+		if result != NeedMore {
+			return proto, nil
 		}
+		want = len(data) + 1
 	}
+}
 
-	// Check for Jabber/XMPP
-	if bytes.HasPrefix(data, []byte("<?xml")) ||
-		bytes.HasPrefix(data, []byte("<stream:stream")) ||
-		bytes.HasPrefix(data, []byte("<stream")) {
-		return ProtocolJabber
-	}
+// Detect attempts to detect one of the built-in protocols from the reader
+// It peeks at the first bytes without consuming them
+func Detect(reader *bufio.Reader) (Protocol, error) {
+	return defaultDetector.Detect(reader)
+}
 
-	return ProtocolUnknown
+// DetectFromBytes detects one of the built-in protocols from a byte slice
+func DetectFromBytes(data []byte) Protocol {
+	proto, _ := defaultDetector.registry.Match(data, true)
+	return proto
 }
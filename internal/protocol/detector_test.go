@@ -3,7 +3,12 @@ package protocol
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDetectHTTP(t *testing.T) {
@@ -227,6 +232,86 @@ func TestProtocolString(t *testing.T) {
 	}
 }
 
+// clientHello captures the first flight a TLS client sends with cfg
+func clientHello(t *testing.T, cfg *tls.Config) []byte {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	go func() {
+		tls.Client(clientConn, cfg).Handshake()
+		clientConn.Close()
+	}()
+
+	reader := bufio.NewReader(serverConn)
+	header, err := reader.Peek(5)
+	if err != nil {
+		t.Fatalf("failed to read ClientHello: %v", err)
+	}
+	record := make([]byte, 5+(int(header[3])<<8|int(header[4])))
+	if _, err := io.ReadFull(reader, record); err != nil {
+		t.Fatalf("failed to read ClientHello: %v", err)
+	}
+	return record
+}
+
+func TestPeekClientHello(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *tls.Config
+		serverName string
+		protocols  []string
+	}{
+		{
+			name:       "SNI and ALPN",
+			config:     &tls.Config{ServerName: "web.whatsapp.com", NextProtos: []string{"h2", "http/1.1"}},
+			serverName: "web.whatsapp.com",
+			protocols:  []string{"h2", "http/1.1"},
+		},
+		{
+			name:       "ACME TLS-ALPN-01",
+			config:     &tls.Config{ServerName: "proxy.example.com", NextProtos: []string{"acme-tls/1"}},
+			serverName: "proxy.example.com",
+			protocols:  []string{"acme-tls/1"},
+		},
+		{
+			name:   "no SNI",
+			config: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := clientHello(t, tt.config)
+			reader := bufio.NewReader(bytes.NewReader(data))
+
+			hello, err := PeekClientHello(reader)
+			if err != nil {
+				t.Fatalf("PeekClientHello() error = %v", err)
+			}
+			if hello.ServerName != tt.serverName {
+				t.Errorf("ServerName = %q, want %q", hello.ServerName, tt.serverName)
+			}
+			if strings.Join(hello.ALPNProtocols, ",") != strings.Join(tt.protocols, ",") {
+				t.Errorf("ALPNProtocols = %v, want %v", hello.ALPNProtocols, tt.protocols)
+			}
+			if reader.Buffered() != len(data) {
+				t.Errorf("PeekClientHello() consumed data")
+			}
+		})
+	}
+}
+
+func TestParseClientHelloMalformed(t *testing.T) {
+	data := clientHello(t, &tls.Config{ServerName: "web.whatsapp.com"})[5:]
+
+	for _, n := range []int{0, 1, 4, 40, len(data) - 1} {
+		if _, err := ParseClientHello(data[:n]); err == nil {
+			t.Errorf("ParseClientHello() of %d bytes succeeded", n)
+		}
+	}
+}
+
 // Benchmark tests
 func BenchmarkDetect(b *testing.B) {
 	data := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n")
@@ -247,3 +332,91 @@ func BenchmarkDetectFromBytes(b *testing.B) {
 		DetectFromBytes(data)
 	}
 }
+
+func TestRegistryMatch(t *testing.T) {
+	registry, err := NewRegistry(
+		TLSMatcher(), HTTPMatcher(), JabberMatcher(),
+		NewPrefixMatcher("SSH", 5, "SSH-2.0-"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssh := ProtocolFor("SSH")
+
+	tests := []struct {
+		name       string
+		data       string
+		final      bool
+		wantProto  Protocol
+		wantResult MatchResult
+	}{
+		{"partial method", "GE", false, ProtocolUnknown, NeedMore},
+		{"partial method at end of input", "GE", true, ProtocolUnknown, NoMatch},
+		{"complete method", "GET /", false, ProtocolHTTP, Match},
+		{"registered protocol", "SSH-2.0-OpenSSH", false, ssh, Match},
+		{"partial registered protocol", "SSH-", false, ProtocolUnknown, NeedMore},
+		{"no match", "hello", false, ProtocolUnknown, NoMatch},
+		{"TLS needs two bytes", "\x16", false, ProtocolUnknown, NeedMore},
+		{"TLS", "\x16\x03", false, ProtocolHTTPS, Match},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proto, result := registry.Match([]byte(tt.data), tt.final)
+			if proto != tt.wantProto || result != tt.wantResult {
+				t.Errorf("Match() = %v, %v, want %v, %v", proto, result, tt.wantProto, tt.wantResult)
+			}
+		})
+	}
+
+	if got := ssh.String(); got != "SSH" {
+		t.Errorf("String() = %q, want SSH", got)
+	}
+	if err := registry.Register(NewPrefixMatcher("SSH", 1, "SSH-1")); err == nil {
+		t.Error("expected an error registering a duplicate matcher")
+	}
+}
+
+func TestDetectorIncremental(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunks    []string
+		peekLimit int
+		timeout   time.Duration
+		want      Protocol
+		wantErr   bool
+	}{
+		{"method split across writes", []string{"G", "ET", " / HTTP/1.1\r\n"}, 0, time.Second, ProtocolHTTP, false},
+		{"stream header split across writes", []string{"<str", "eam:stream>"}, 0, time.Second, ProtocolJabber, false},
+		{"peek limit reached", []string{"GET"}, 3, time.Second, ProtocolUnknown, false},
+		{"timeout with partial data", []string{"GE"}, 0, 50 * time.Millisecond, ProtocolUnknown, false},
+		{"timeout without data", nil, 0, 50 * time.Millisecond, ProtocolUnknown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go func() {
+				for _, chunk := range tt.chunks {
+					client.Write([]byte(chunk))
+					time.Sleep(5 * time.Millisecond)
+				}
+			}()
+
+			detector := NewDetector(DefaultRegistry(), tt.peekLimit, tt.timeout)
+			reader := bufio.NewReader(server)
+			proto, err := detector.DetectConn(server, reader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectConn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if proto != tt.want {
+				t.Errorf("DetectConn() = %v, want %v", proto, tt.want)
+			}
+			if err == nil && reader.Buffered() == 0 {
+				t.Error("DetectConn() consumed or lost the peeked bytes")
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MatchResult is the outcome of a Matcher inspecting connection bytes
+type MatchResult int
+
+const (
+	// NoMatch means the bytes are not the matcher's protocol
+	NoMatch MatchResult = iota
+	// Match means the bytes are the matcher's protocol
+	Match
+	// NeedMore means the matcher cannot decide until more bytes arrive
+	NeedMore
+)
+
+// String returns the string representation of the match result
+func (r MatchResult) String() string {
+	switch r {
+	case Match:
+		return "match"
+	case NeedMore:
+		return "need-more"
+	default:
+		return "no-match"
+	}
+}
+
+// Matcher recognizes a protocol from the first bytes of a connection
+type Matcher interface {
+	// Name is the protocol name; matchers with the same name as a built-in
+	// protocol report that protocol
+	Name() string
+
+	// Priority orders matchers; higher priorities are consulted first and
+	// win when several match
+	Priority() int
+
+	// MinBytes is how many bytes the matcher needs before Match is called
+	MinBytes() int
+
+	// Match inspects the bytes peeked so far without consuming them
+	Match(data []byte) MatchResult
+}
+
+// protocolNames maps protocols to their names, including protocols added by
+// registered matchers
+var protocolNames = struct {
+	sync.RWMutex
+	byID   []string
+	byName map[string]Protocol
+}{
+	byID: []string{"Unknown", "HTTP", "HTTPS", "Jabber"},
+	byName: map[string]Protocol{
+		"Unknown": ProtocolUnknown,
+		"HTTP":    ProtocolHTTP,
+		"HTTPS":   ProtocolHTTPS,
+		"Jabber":  ProtocolJabber,
+	},
+}
+
+// ProtocolFor returns the protocol with the given name, allocating a new one
+// the first time a name is seen
+func ProtocolFor(name string) Protocol {
+	protocolNames.Lock()
+	defer protocolNames.Unlock()
+
+	if proto, ok := protocolNames.byName[name]; ok {
+		return proto
+	}
+	proto := Protocol(len(protocolNames.byID))
+	protocolNames.byID = append(protocolNames.byID, name)
+	protocolNames.byName[name] = proto
+	return proto
+}
+
+// Registry holds the matchers used for protocol detection
+type Registry struct {
+	mutex    sync.RWMutex
+	matchers []Matcher
+}
+
+// NewRegistry creates a registry with the given matchers
+func NewRegistry(matchers ...Matcher) (*Registry, error) {
+	r := &Registry{}
+	for _, m := range matchers {
+		if err := r.Register(m); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// DefaultRegistry returns a registry with the built-in HTTP, TLS and Jabber
+// matchers
+func DefaultRegistry() *Registry {
+	r, _ := NewRegistry(TLSMatcher(), HTTPMatcher(), JabberMatcher())
+	return r
+}
+
+// Register adds a matcher to the registry
+func (r *Registry) Register(m Matcher) error {
+	if m.Name() == "" {
+		return fmt.Errorf("matcher name cannot be empty")
+	}
+	if m.MinBytes() < 1 {
+		return fmt.Errorf("matcher %s must require at least 1 byte, got %d", m.Name(), m.MinBytes())
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existing := range r.matchers {
+		if existing.Name() == m.Name() {
+			return fmt.Errorf("matcher %s is already registered", m.Name())
+		}
+	}
+	r.matchers = append(r.matchers, m)
+	sort.SliceStable(r.matchers, func(i, j int) bool {
+		return r.matchers[i].Priority() > r.matchers[j].Priority()
+	})
+
+	ProtocolFor(m.Name())
+	return nil
+}
+
+// Matchers returns the registered matchers in priority order
+func (r *Registry) Matchers() []Matcher {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]Matcher(nil), r.matchers...)
+}
+
+// Match runs the matchers over data in priority order
+// A matcher that needs more bytes blocks lower-priority matches, so the
+// result is NeedMore until it decides. When final is set no more bytes will
+// arrive and undecided matchers count as no match.
+func (r *Registry) Match(data []byte, final bool) (Protocol, MatchResult) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, m := range r.matchers {
+		result := NeedMore
+		if len(data) >= m.MinBytes() {
+			result = m.Match(data)
+		}
+
+		switch {
+		case result == Match:
+			return ProtocolFor(m.Name()), Match
+		case result == NeedMore && !final:
+			return ProtocolUnknown, NeedMore
+		}
+	}
+	return ProtocolUnknown, NoMatch
+}
+
+// minBytes returns the fewest bytes any registered matcher needs
+func (r *Registry) minBytes() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	min := 1
+	for i, m := range r.matchers {
+		if i == 0 || m.MinBytes() < min {
+			min = m.MinBytes()
+		}
+	}
+	return min
+}
+
+// prefixMatcher matches connections starting with one of a set of prefixes
+type prefixMatcher struct {
+	name     string
+	priority int
+	prefixes [][]byte
+}
+
+// NewPrefixMatcher creates a matcher for connections that start with one of
+// prefixes
+func NewPrefixMatcher(name string, priority int, prefixes ...string) Matcher {
+	m := &prefixMatcher{name: name, priority: priority}
+	for _, prefix := range prefixes {
+		m.prefixes = append(m.prefixes, []byte(prefix))
+	}
+	return m
+}
+
+func (m *prefixMatcher) Name() string  { return m.name }
+func (m *prefixMatcher) Priority() int { return m.priority }
+func (m *prefixMatcher) MinBytes() int { return 1 }
+
+func (m *prefixMatcher) Match(data []byte) MatchResult {
+	result := NoMatch
+	for _, prefix := range m.prefixes {
+		if bytes.HasPrefix(data, prefix) {
+			return Match
+		}
+		// The data so far could still become this prefix
+		if bytes.HasPrefix(prefix, data) {
+			result = NeedMore
+		}
+	}
+	return result
+}
+
+// HTTPMatcher matches HTTP/1.x requests by their method
+func HTTPMatcher() Matcher {
+	return NewPrefixMatcher("HTTP", 20,
+		"GET ", "POST ", "PUT ", "DELETE ", "HEAD ",
+		"OPTIONS ", "CONNECT ", "PATCH ", "TRACE ",
+	)
+}
+
+// JabberMatcher matches XMPP streams by their XML declaration or stream
+// header
+func JabberMatcher() Matcher {
+	return NewPrefixMatcher("Jabber", 10, "<?xml", "<stream")
+}
+
+// tlsMatcher matches TLS handshake records
+type tlsMatcher struct{}
+
+// TLSMatcher matches connections starting with a TLS handshake record
+func TLSMatcher() Matcher {
+	return tlsMatcher{}
+}
+
+func (tlsMatcher) Name() string  { return "HTTPS" }
+func (tlsMatcher) Priority() int { return 30 }
+func (tlsMatcher) MinBytes() int { return 2 }
+
+func (tlsMatcher) Match(data []byte) MatchResult {
+	// Handshake record with an SSL 3.0 or TLS version (0x03 0x01 = TLS 1.0,
+	// 0x03 0x03 = TLS 1.2, etc.)
+	if data[0] == recordTypeHandshake && data[1] == 0x03 {
+		return Match
+	}
+	return NoMatch
+}
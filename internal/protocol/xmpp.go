@@ -0,0 +1,220 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// XMPP namespaces
+const (
+	NamespaceStreams      = "http://etherx.jabber.org/streams"
+	NamespaceStreamErrors = "urn:ietf:params:xml:ns:xmpp-streams"
+	NamespaceClient       = "jabber:client"
+	NamespaceServer       = "jabber:server"
+)
+
+// Stream error conditions from RFC 6120 section 4.9.3
+const (
+	StreamErrorBadFormat          = "bad-format"
+	StreamErrorHostUnknown        = "host-unknown"
+	StreamErrorInvalidNamespace   = "invalid-namespace"
+	StreamErrorNotWellFormed      = "not-well-formed"
+	StreamErrorPolicyViolation    = "policy-violation"
+	StreamErrorRemoteConnection   = "remote-connection-failed"
+	StreamErrorUnsupportedVersion = "unsupported-version"
+)
+
+// StreamHeader holds the attributes of an XMPP <stream:stream> opening
+type StreamHeader struct {
+	// To is the domain the client wants to reach, empty if not sent
+	To   string
+	From string
+
+	// Version is the stream version, such as 1.0; empty for pre-RFC
+	// streams
+	Version string
+
+	// XMLNS is the content namespace, jabber:client or jabber:server
+	XMLNS string
+}
+
+// StreamError is an XMPP stream-level error
+type StreamError struct {
+	Condition string
+	Text      string
+}
+
+func (e *StreamError) Error() string {
+	if e.Text == "" {
+		return "XMPP stream error: " + e.Condition
+	}
+	return fmt.Sprintf("XMPP stream error: %s: %s", e.Condition, e.Text)
+}
+
+// Stanza returns the error as sent to a client before closing the stream
+// The error is preceded by a response stream header, since a client whose
+// header was rejected has not received one yet
+func (e *StreamError) Stanza() []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xml version='1.0'?>")
+	fmt.Fprintf(&b, "<stream:stream xmlns='%s' xmlns:stream='%s' version='1.0'>", NamespaceClient, NamespaceStreams)
+	fmt.Fprintf(&b, "<stream:error><%s xmlns='%s'/>", e.Condition, NamespaceStreamErrors)
+	if e.Text != "" {
+		fmt.Fprintf(&b, "<text xmlns='%s'>", NamespaceStreamErrors)
+		xml.EscapeText(&b, []byte(e.Text))
+		b.WriteString("</text>")
+	}
+	b.WriteString("</stream:error></stream:stream>")
+	return b.Bytes()
+}
+
+// errIncompleteHeader means more bytes are needed to parse a stream header
+var errIncompleteHeader = errors.New("incomplete XMPP stream header")
+
+// streamVersion matches major.minor version numbers
+var streamVersion = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// PeekStreamHeader parses the XMPP stream header at the start of reader
+// without consuming it, peeking incrementally up to limit bytes
+// Malformed headers return a *StreamError.
+func PeekStreamHeader(reader *bufio.Reader, limit int) (*StreamHeader, error) {
+	if limit <= 0 || limit > reader.Size() {
+		limit = reader.Size()
+	}
+
+	want := 1
+	for {
+		data, err := reader.Peek(want)
+		if buffered := reader.Buffered(); err == nil && buffered > len(data) {
+			data, _ = reader.Peek(min(buffered, limit))
+		}
+
+		header, parseErr := ParseStreamHeader(data)
+		if parseErr != errIncompleteHeader {
+			return header, parseErr
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, &StreamError{Condition: StreamErrorBadFormat, Text: "stream header is incomplete"}
+			}
+			return nil, fmt.Errorf("failed to peek XMPP stream header: %w", err)
+		}
+		if len(data) >= limit {
+			return nil, &StreamError{Condition: StreamErrorPolicyViolation, Text: fmt.Sprintf("stream header exceeds %d bytes", limit)}
+		}
+		want = len(data) + 1
+	}
+}
+
+// ParseStreamHeader parses an XMPP stream header, optionally preceded by an
+// XML declaration
+// It returns errIncompleteHeader if data ends before the header does, and a
+// *StreamError if the header is malformed.
+func ParseStreamHeader(data []byte) (*StreamHeader, error) {
+	end, err := startTagEnd(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data[:end]))
+	var start xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, &StreamError{Condition: StreamErrorNotWellFormed, Text: err.Error()}
+		}
+		if element, ok := token.(xml.StartElement); ok {
+			start = element
+			break
+		}
+	}
+
+	if start.Name.Local != "stream" || start.Name.Space != NamespaceStreams {
+		return nil, &StreamError{Condition: StreamErrorInvalidNamespace, Text: "expected a stream element in the " + NamespaceStreams + " namespace"}
+	}
+
+	header := &StreamHeader{}
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "to":
+			header.To = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "from":
+			header.From = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "version":
+			header.Version = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			header.XMLNS = attr.Value
+		}
+	}
+
+	if header.XMLNS != NamespaceClient && header.XMLNS != NamespaceServer {
+		return nil, &StreamError{Condition: StreamErrorInvalidNamespace, Text: fmt.Sprintf("unsupported content namespace %q", header.XMLNS)}
+	}
+	if header.Version != "" && !streamVersion.MatchString(header.Version) {
+		return nil, &StreamError{Condition: StreamErrorUnsupportedVersion, Text: fmt.Sprintf("invalid version %q", header.Version)}
+	}
+
+	return header, nil
+}
+
+// startTagEnd returns the offset just past the first start tag in data,
+// skipping an XML declaration, comments and whitespace before it
+func startTagEnd(data []byte) (int, error) {
+	i := 0
+	for {
+		// Skip whitespace between prolog items
+		for i < len(data) && isXMLSpace(data[i]) {
+			i++
+		}
+		if i == len(data) {
+			return 0, errIncompleteHeader
+		}
+		if data[i] != '<' {
+			return 0, &StreamError{Condition: StreamErrorNotWellFormed, Text: "expected a stream header"}
+		}
+
+		rest := data[i:]
+		switch {
+		case len(rest) < 4 && (bytes.HasPrefix([]byte("<?"), rest) || bytes.HasPrefix([]byte("<!--"), rest)):
+			return 0, errIncompleteHeader
+		case bytes.HasPrefix(rest, []byte("<?")):
+			n := bytes.Index(rest, []byte("?>"))
+			if n < 0 {
+				return 0, errIncompleteHeader
+			}
+			i += n + 2
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			n := bytes.Index(rest, []byte("-->"))
+			if n < 0 {
+				return 0, errIncompleteHeader
+			}
+			i += n + 3
+		default:
+			// Find the closing '>' outside attribute values
+			var quote byte
+			for j := 1; j < len(rest); j++ {
+				switch c := rest[j]; {
+				case quote != 0:
+					if c == quote {
+						quote = 0
+					}
+				case c == '"' || c == '\'':
+					quote = c
+				case c == '>':
+					return i + j + 1, nil
+				}
+			}
+			return 0, errIncompleteHeader
+		}
+	}
+}
+
+// isXMLSpace reports whether c is XML whitespace
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const streamOpen = "<stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'"
+
+func TestParseStreamHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		want          StreamHeader
+		wantCondition string
+		wantNeedMore  bool
+	}{
+		{
+			name: "with XML declaration",
+			data: "<?xml version='1.0'?>\n" + streamOpen + " to='s.whatsapp.net' version='1.0'>",
+			want: StreamHeader{To: "s.whatsapp.net", Version: "1.0", XMLNS: NamespaceClient},
+		},
+		{
+			name: "server namespace with escaped attribute",
+			data: `<stream:stream xmlns="jabber:server" xmlns:stream="http://etherx.jabber.org/streams" from="a&amp;b" to='x.example'>`,
+			want: StreamHeader{To: "x.example", From: "a&b", XMLNS: NamespaceServer},
+		},
+		{
+			name: "quoted greater-than in attribute",
+			data: streamOpen + " to='a>b'>",
+			want: StreamHeader{To: "a>b", XMLNS: NamespaceClient},
+		},
+		{name: "incomplete declaration", data: "<?xml vers", wantNeedMore: true},
+		{name: "incomplete start tag", data: streamOpen + " to='s.what", wantNeedMore: true},
+		{name: "only whitespace", data: "\n ", wantNeedMore: true},
+		{name: "text before header", data: "hello", wantCondition: StreamErrorNotWellFormed},
+		{name: "undeclared stream prefix", data: "<stream:stream xmlns='jabber:client' to='x'>", wantCondition: StreamErrorInvalidNamespace},
+		{name: "wrong element", data: "<foo xmlns='jabber:client'>", wantCondition: StreamErrorInvalidNamespace},
+		{name: "missing content namespace", data: "<stream:stream xmlns:stream='http://etherx.jabber.org/streams'>", wantCondition: StreamErrorInvalidNamespace},
+		{name: "bad version", data: streamOpen + " version='one'>", wantCondition: StreamErrorUnsupportedVersion},
+		{name: "malformed attribute", data: streamOpen + " to=x>", wantCondition: StreamErrorNotWellFormed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := ParseStreamHeader([]byte(tt.data))
+			if tt.wantNeedMore {
+				if err != errIncompleteHeader {
+					t.Fatalf("ParseStreamHeader() error = %v, want incomplete", err)
+				}
+				return
+			}
+
+			var streamErr *StreamError
+			if tt.wantCondition != "" {
+				if !errors.As(err, &streamErr) || streamErr.Condition != tt.wantCondition {
+					t.Fatalf("ParseStreamHeader() error = %v, want %s", err, tt.wantCondition)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseStreamHeader() error = %v", err)
+			}
+			if *header != tt.want {
+				t.Errorf("ParseStreamHeader() = %+v, want %+v", *header, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekStreamHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		limit         int
+		wantTo        string
+		wantCondition string
+	}{
+		{"split across writes", []string{"<?xml version='1.0'?>", streamOpen, " to='s.whatsapp.net'>"}, 0, "s.whatsapp.net", ""},
+		{"header exceeds limit", []string{streamOpen + " to='" + strings.Repeat("a", 200) + "'>"}, 64, "", StreamErrorPolicyViolation},
+		{"connection closed mid-header", []string{streamOpen}, 0, "", StreamErrorBadFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go func() {
+				for _, chunk := range tt.chunks {
+					client.Write([]byte(chunk))
+					time.Sleep(5 * time.Millisecond)
+				}
+				client.Close()
+			}()
+
+			reader := bufio.NewReader(server)
+			header, err := PeekStreamHeader(reader, tt.limit)
+			if tt.wantCondition != "" {
+				var streamErr *StreamError
+				if !errors.As(err, &streamErr) || streamErr.Condition != tt.wantCondition {
+					t.Fatalf("PeekStreamHeader() error = %v, want %s", err, tt.wantCondition)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PeekStreamHeader() error = %v", err)
+			}
+			if header.To != tt.wantTo {
+				t.Errorf("To = %q, want %q", header.To, tt.wantTo)
+			}
+			if reader.Buffered() == 0 {
+				t.Error("PeekStreamHeader() consumed the header")
+			}
+		})
+	}
+}
+
+func TestStreamErrorStanza(t *testing.T) {
+	stanza := string((&StreamError{Condition: StreamErrorHostUnknown, Text: "a < b"}).Stanza())
+	for _, want := range []string{
+		"<stream:stream xmlns='jabber:client'",
+		"<host-unknown xmlns='urn:ietf:params:xml:ns:xmpp-streams'/>",
+		"a &lt; b",
+		"</stream:error></stream:stream>",
+	} {
+		if !strings.Contains(stanza, want) {
+			t.Errorf("Stanza() = %s, missing %s", stanza, want)
+		}
+	}
+}
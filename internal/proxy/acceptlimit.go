@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// acceptLimiter is a token bucket shared by the accept loops
+// Tokens may go negative: each loop reserves a token and waits until the
+// bucket has refilled, so concurrent loops queue up instead of bursting.
+type acceptLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token at now and returns how long to wait before
+// accepting; a rate of 0 or less never waits
+func (l *acceptLimiter) reserve(now time.Time, rate float64, burst int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	capacity := float64(max(burst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last.IsZero() {
+		l.tokens = capacity
+	} else if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = min(capacity, l.tokens+elapsed.Seconds()*rate)
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / rate * float64(time.Second))
+}
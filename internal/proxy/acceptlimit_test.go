@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcceptLimiter(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		at    []time.Duration
+		want  []time.Duration
+	}{
+		{
+			name:  "unlimited",
+			rate:  0,
+			burst: 1,
+			at:    []time.Duration{0, 0, 0},
+			want:  []time.Duration{0, 0, 0},
+		},
+		{
+			name:  "burst then rate",
+			rate:  10,
+			burst: 3,
+			at:    []time.Duration{0, 0, 0, 0, 0},
+			want:  []time.Duration{0, 0, 0, 100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:  "refills over time",
+			rate:  10,
+			burst: 2,
+			at:    []time.Duration{0, 0, 0, 300 * time.Millisecond, 300 * time.Millisecond},
+			want:  []time.Duration{0, 0, 100 * time.Millisecond, 0, 0},
+		},
+		{
+			name:  "refill capped at burst",
+			rate:  100,
+			burst: 1,
+			at:    []time.Duration{0, time.Minute, time.Minute},
+			want:  []time.Duration{0, 0, 10 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l acceptLimiter
+			for i, at := range tt.at {
+				got := l.reserve(start.Add(at), tt.rate, tt.burst)
+				if diff := got - tt.want[i]; diff < -time.Microsecond || diff > time.Microsecond {
+					t.Errorf("reserve #%d at %s = %s, want %s", i, at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/protocol"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/ssl"
+)
+
+// acmeChallengeTimeout bounds a TLS-ALPN-01 validation handshake
+const acmeChallengeTimeout = 10 * time.Second
+
+// serveHTTPChallenge answers ACME HTTP-01 validation requests
+// It reports whether the request was a challenge request and was handled.
+// Only origin-form requests are considered, so proxied requests for the same
+// path on other hosts are relayed as usual.
+func (s *Server) serveHTTPChallenge(conn net.Conn, req *http.Request) bool {
+	if req.URL.Host != "" || !strings.HasPrefix(req.URL.Path, ssl.HTTPChallengePrefix) {
+		return false
+	}
+
+	// Answer from one manager even if a reload swaps it meanwhile
+	mgr := s.state().sslManager
+	token := strings.TrimPrefix(req.URL.Path, ssl.HTTPChallengePrefix)
+	response, ok := mgr.HTTPChallengeResponse(token)
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Close:      true,
+	}
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+	}
+	resp.Body = io.NopCloser(strings.NewReader(response))
+	resp.ContentLength = int64(len(response))
+
+	s.logInfo(fmt.Sprintf("ACME HTTP-01 challenge %s from %s: %d", token, conn.RemoteAddr(), resp.StatusCode))
+	resp.Write(conn)
+	return true
+}
+
+// serveTLSALPNChallenge answers ACME TLS-ALPN-01 validation handshakes
+// It reports whether the connection was a challenge and was handled
+func (s *Server) serveTLSALPNChallenge(tc *trackedConn, reader *bufio.Reader) bool {
+	// Check and answer the challenge with one manager even if a reload swaps
+	// it meanwhile
+	mgr := s.state().sslManager
+	if !mgr.ACMEEnabled() {
+		return false
+	}
+
+	tc.conn.SetReadDeadline(time.Now().Add(acmeChallengeTimeout))
+	hello, err := protocol.PeekClientHello(reader)
+	tc.conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return false
+	}
+
+	if len(hello.ALPNProtocols) != 1 || hello.ALPNProtocols[0] != ssl.ACMETLSALPNProtocol ||
+		!mgr.HasTLSALPNChallenge(hello.ServerName) {
+		return false
+	}
+
+	s.logInfo(fmt.Sprintf("ACME TLS-ALPN-01 challenge for %s from %s", hello.ServerName, tc.conn.RemoteAddr()))
+
+	conn := tls.Server(&bufferedConn{Conn: tc.conn, reader: reader}, mgr.ChallengeTLSConfig())
+	conn.SetDeadline(time.Now().Add(acmeChallengeTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.logError("ACME TLS-ALPN-01 handshake failed", err)
+	}
+	conn.Close()
+	return true
+}
+
+// bufferedConn is a net.Conn whose reads are served from reader first
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/socks5"
+)
+
+// adminHandler returns the HTTP handler for the admin API
+// All endpoints require a bearer token and every action is audit-logged
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/connections", s.adminConnections)
+	mux.HandleFunc("/admin/connections/kill", s.adminKill)
+	mux.HandleFunc("/admin/drain", s.adminDrain)
+	mux.HandleFunc("/admin/resume", s.adminResume)
+	mux.HandleFunc("/admin/log-level", s.adminLogLevel)
+	mux.HandleFunc("/admin/certificates/rotate", s.adminRotateCertificates)
+	mux.HandleFunc("/admin/upstream", s.adminUpstream)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.adminAuthorized(r) {
+			s.audit(r, "auth", "denied", "invalid or missing token")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="whatsapp-proxy-admin"`)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// adminAuthorized checks the bearer token of an admin request
+func (s *Server) adminAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" || s.Config().Admin.Token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Config().Admin.Token)) == 1
+}
+
+// adminConnections lists active connections
+func (s *Server) adminConnections(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	conns := s.Connections()
+	s.audit(r, "connections.list", "ok", fmt.Sprintf("count=%d", len(conns)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"draining":    s.IsDraining(),
+		"connections": conns,
+	})
+}
+
+// adminKill closes connections by ID or client IP
+func (s *Server) adminKill(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	idParam := r.URL.Query().Get("id")
+	ip := r.URL.Query().Get("ip")
+
+	switch {
+	case idParam != "":
+		id, err := strconv.ParseUint(idParam, 10, 64)
+		if err != nil {
+			s.audit(r, "connections.kill", "error", "invalid id "+idParam)
+			writeJSONError(w, http.StatusBadRequest, "invalid connection id")
+			return
+		}
+		if err := s.KillConnection(id); err != nil {
+			s.audit(r, "connections.kill", "error", err.Error())
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.audit(r, "connections.kill", "ok", "id="+idParam)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"killed": 1})
+	case ip != "":
+		killed := s.KillConnectionsFromIP(ip)
+		s.audit(r, "connections.kill", "ok", fmt.Sprintf("ip=%s killed=%d", ip, killed))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"killed": killed})
+	default:
+		s.audit(r, "connections.kill", "error", "missing id or ip")
+		writeJSONError(w, http.StatusBadRequest, "id or ip query parameter required")
+	}
+}
+
+// adminDrain puts the server into drain mode
+func (s *Server) adminDrain(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if err := s.Drain(); err != nil {
+		s.audit(r, "drain", "error", err.Error())
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	s.audit(r, "drain", "ok", "")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"draining": true})
+}
+
+// adminResume takes the server out of drain mode
+func (s *Server) adminResume(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if err := s.Resume(); err != nil {
+		s.audit(r, "resume", "error", err.Error())
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	s.audit(r, "resume", "ok", "")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"draining": false})
+}
+
+// adminLogLevel shows or changes the log level
+func (s *Server) adminLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.audit(r, "log_level.get", "ok", "")
+		writeJSON(w, http.StatusOK, map[string]string{"level": s.LogLevel()})
+	case http.MethodPost, http.MethodPut:
+		level := r.URL.Query().Get("level")
+		previous := s.LogLevel()
+		if err := s.SetLogLevel(level); err != nil {
+			s.audit(r, "log_level.set", "error", err.Error())
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.audit(r, "log_level.set", "ok", fmt.Sprintf("from=%s to=%s", previous, s.LogLevel()))
+		writeJSON(w, http.StatusOK, map[string]string{"level": s.LogLevel()})
+	default:
+		requireMethod(w, r, http.MethodGet, http.MethodPost, http.MethodPut)
+	}
+}
+
+// adminRotateCertificates triggers certificate rotation
+func (s *Server) adminRotateCertificates(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// Rotate and report the same manager even if a reload swaps it meanwhile
+	mgr := s.state().sslManager
+	if mgr == nil {
+		s.audit(r, "certificates.rotate", "error", "ssl manager not available")
+		writeJSONError(w, http.StatusServiceUnavailable, "ssl manager not available")
+		return
+	}
+
+	if err := mgr.RotateCertificates(); err != nil {
+		s.audit(r, "certificates.rotate", "error", err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	info := mgr.GetCertificateInfo()
+	detail := ""
+	if info != nil {
+		detail = "not_after=" + info.NotAfter.Format(time.RFC3339)
+	}
+	s.audit(r, "certificates.rotate", "ok", detail)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rotated": true, "certificate": info})
+}
+
+// upstreamRequest is the body of an upstream change request
+type upstreamRequest struct {
+	// URL is the new SOCKS5 proxy (socks5://[user:pass@]host:port)
+	// An empty URL switches to direct connections
+	URL string `json:"url"`
+
+	// Test verifies the new proxy before swapping it in
+	Test bool `json:"test"`
+}
+
+// adminUpstream shows or swaps the upstream proxy
+func (s *Server) adminUpstream(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.audit(r, "upstream.get", "ok", "")
+		writeJSON(w, http.StatusOK, map[string]string{"upstream": s.Upstream()})
+		return
+	case http.MethodPost, http.MethodPut:
+	default:
+		requireMethod(w, r, http.MethodGet, http.MethodPost, http.MethodPut)
+		return
+	}
+
+	var req upstreamRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		s.audit(r, "upstream.set", "error", "invalid request body")
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	previous := s.Upstream()
+
+	if req.URL == "" {
+		s.SetUpstream(nil)
+		s.audit(r, "upstream.set", "ok", fmt.Sprintf("from=%s to=direct", previous))
+		writeJSON(w, http.StatusOK, map[string]string{"upstream": s.Upstream()})
+		return
+	}
+
+	var client *socks5.Client
+	cfg, err := socks5.ConfigFromURL(req.URL, s.Config().SOCKS5.Timeout)
+	if err == nil {
+		client, err = socks5.NewClient(s.socks5Config(cfg, &s.Config().Upstream.TCP))
+	}
+	if err != nil {
+		s.audit(r, "upstream.set", "error", err.Error())
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Test {
+		if err := client.Test(); err != nil {
+			s.audit(r, "upstream.set", "error", fmt.Sprintf("to=%s test failed: %v", client.GetProxyAddr(), err))
+			writeJSONError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	s.SetUpstream(client)
+	s.audit(r, "upstream.set", "ok", fmt.Sprintf("from=%s to=%s auth=%v", previous, client.GetProxyAddr(), client.HasAuth()))
+	writeJSON(w, http.StatusOK, map[string]string{"upstream": s.Upstream()})
+}
+
+// audit writes an audit log entry for an admin action
+func (s *Server) audit(r *http.Request, action, result, detail string) {
+	msg := fmt.Sprintf("[AUDIT] admin action=%s result=%s remote=%s", action, result, r.RemoteAddr)
+	if detail != "" {
+		msg += " " + detail
+	}
+	s.logger.Printf("%s", msg)
+}
+
+// requireMethod writes a 405 response if the request method is not allowed
+func requireMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
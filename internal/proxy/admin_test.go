@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+const testAdminToken = "test-admin-token-0123456789"
+
+func newAdminTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = t.TempDir()
+	cfg.Admin.Enabled = true
+	cfg.Admin.Token = testAdminToken
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return server
+}
+
+func adminRequest(t *testing.T, h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAuth(t *testing.T) {
+	server := newAdminTestServer(t)
+	h := server.adminHandler()
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{name: "missing token", header: "", status: http.StatusUnauthorized},
+		{name: "empty bearer", header: "Bearer ", status: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer wrong-token-0123456789", status: http.StatusUnauthorized},
+		{name: "bare token", header: testAdminToken, status: http.StatusUnauthorized},
+		{name: "other scheme", header: "Basic " + testAdminToken, status: http.StatusUnauthorized},
+		{name: "valid token", header: "Bearer " + testAdminToken, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/connections", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAdminListAndKillConnections(t *testing.T) {
+	server := newAdminTestServer(t)
+	h := server.adminHandler()
+
+	client, peer := net.Pipe()
+	defer peer.Close()
+	tc := server.conns.add(client)
+	tc.bytesReceived.Add(42)
+
+	rec := adminRequest(t, h, http.MethodGet, "/admin/connections", testAdminToken)
+	var body struct {
+		Connections []ConnInfo `json:"connections"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Connections) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(body.Connections))
+	}
+	if body.Connections[0].BytesReceived != 42 {
+		t.Errorf("BytesReceived = %d, want 42", body.Connections[0].BytesReceived)
+	}
+
+	rec = adminRequest(t, h, http.MethodPost, "/admin/connections/kill?id=999", testAdminToken)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("kill unknown id status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = adminRequest(t, h, http.MethodPost, "/admin/connections/kill?id=1", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("kill status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// Killed connection must be closed
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Error("expected write on killed connection to fail")
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	server := newAdminTestServer(t)
+	h := server.adminHandler()
+
+	rec := adminRequest(t, h, http.MethodPost, "/admin/log-level?level=debug", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if server.LogLevel() != "debug" {
+		t.Errorf("LogLevel() = %s, want debug", server.LogLevel())
+	}
+
+	rec = adminRequest(t, h, http.MethodPost, "/admin/log-level?level=verbose", testAdminToken)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid level status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if server.LogLevel() != "debug" {
+		t.Errorf("LogLevel() changed on invalid level: %s", server.LogLevel())
+	}
+}
+
+func TestAdminDrainResume(t *testing.T) {
+	server := newAdminTestServer(t)
+	h := server.adminHandler()
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	rec := adminRequest(t, h, http.MethodPost, "/admin/drain", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("drain status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !server.IsDraining() {
+		t.Error("expected server to be draining")
+	}
+
+	rec = adminRequest(t, h, http.MethodPost, "/admin/drain", testAdminToken)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second drain status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = adminRequest(t, h, http.MethodPost, "/admin/resume", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resume status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if server.IsDraining() {
+		t.Error("expected server to accept connections after resume")
+	}
+}
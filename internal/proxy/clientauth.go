@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// chatTarget is the WhatsApp chat server that Jabber connections and
+// terminated TLS connections are relayed to
+const chatTarget = "e1.whatsapp.net:5222"
+
+// tlsHandshakeTimeout bounds the handshake of terminated TLS connections
+const tlsHandshakeTimeout = 10 * time.Second
+
+// handleTerminatedTLS terminates TLS with client certificate verification
+// and relays the decrypted stream to the chat server, like the official
+// WhatsApp proxy does for TLS-wrapped chat connections
+func (s *Server) handleTerminatedTLS(tc *trackedConn, reader *bufio.Reader) {
+	conn := tls.Server(&bufferedConn{Conn: tc.conn, reader: reader}, s.state().tlsConfig)
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.metrics.IncrementTLSHandshakeFailures()
+		s.metrics.IncrementErrors()
+		s.logWarn(fmt.Sprintf("TLS handshake with %s failed: %v", tc.conn.RemoteAddr(), err))
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	identity := s.state().sslManager.ClientIdentity(conn.ConnectionState())
+	tc.setIdentity(identity)
+	s.metrics.IncrementClientIdentity(identity)
+
+	// The identity is recorded before connecting, so the upstream hooks and
+	// the admin API see it
+	target := s.clientAuthRoute(identity)
+	s.logInfo(fmt.Sprintf("TLS client %s authenticated as %s, relaying to %s", tc.conn.RemoteAddr(), identityLabel(identity), target))
+
+	upstreamConn, err := s.connectUpstream(tc, target)
+	if err != nil {
+		s.logError(fmt.Sprintf("failed to connect to %s", target), err)
+		s.metrics.IncrementErrors()
+		return
+	}
+	defer upstreamConn.Close()
+
+	s.relay(tc, conn, upstreamConn)
+}
+
+// clientAuthRoute returns the upstream for a client identity: the target
+// of the first matching route, else the chat server
+func (s *Server) clientAuthRoute(identity string) string {
+	if identity != "" {
+		for _, route := range s.Config().SSL.ClientAuth.Routes {
+			if route.Identity == identity {
+				return route.Target
+			}
+		}
+	}
+	return chatTarget
+}
+
+// identityLabel returns how a client identity is shown in logs and metrics
+func identityLabel(identity string) string {
+	if identity == "" {
+		return "anonymous"
+	}
+	return identity
+}
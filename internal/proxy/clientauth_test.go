@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+// testClientCA creates a CA, writes its certificate to dir and returns a
+// function issuing client certificates for a common name
+func testClientCA(t *testing.T, dir string) (string, func(commonName string) tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "clients-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	serial := int64(1)
+	issue := func(commonName string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial++
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return caFile, issue
+}
+
+func TestClientAuthRouting(t *testing.T) {
+	targetA, receivedA := startRecordingUpstream(t)
+	targetB, receivedB := startRecordingUpstream(t)
+	dir := t.TempDir()
+	caFile, issue := testClientCA(t, dir)
+
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Server.BindAddr = "127.0.0.1"
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = dir
+	cfg.SSL.ClientAuth = config.ClientAuthConfig{
+		Mode:    "require",
+		CAFiles: []string{caFile},
+		Routes: []config.ClientAuthRoute{
+			{Identity: "device-a", Target: targetA},
+			{Identity: "device-b", Target: targetB},
+		},
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Shutdown(context.Background())
+	addr := server.listener.Addr().String()
+
+	tests := []struct {
+		identity string
+		received <-chan string
+	}{
+		{identity: "device-a", received: receivedA},
+		{identity: "device-b", received: receivedB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identity, func(t *testing.T) {
+			conn, err := tls.Dial("tcp", addr, &tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       []tls.Certificate{issue(tt.identity)},
+			})
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+
+			message := "hello from " + tt.identity
+			if _, err := conn.Write([]byte(message)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			select {
+			case got := <-tt.received:
+				if got != message {
+					t.Errorf("upstream received %q, want %q", got, message)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s was not routed to its target", tt.identity)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/protocol"
+)
+
+// ConnInfo is a snapshot of a tracked client connection
+type ConnInfo struct {
+	ID            uint64    `json:"id"`
+	ClientAddr    string    `json:"client_addr"`
+	ClientIP      string    `json:"client_ip"`
+	Protocol      string    `json:"protocol"`
+	Target        string    `json:"target,omitempty"`
+	ServerName    string    `json:"server_name,omitempty"`
+	Identity      string    `json:"identity,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	DurationSec   float64   `json:"duration_seconds"`
+	BytesReceived uint64    `json:"bytes_received"`
+	BytesSent     uint64    `json:"bytes_sent"`
+}
+
+// trackedConn holds a client connection and its per-connection stats
+type trackedConn struct {
+	id       uint64
+	conn     net.Conn
+	clientIP string
+	started  time.Time
+
+	mutex        sync.Mutex
+	protocol     protocol.Protocol
+	target       string
+	serverName   string
+	identity     string
+	upstream     net.Conn
+	shutdownHook func()
+
+	bytesReceived atomic.Uint64
+	bytesSent     atomic.Uint64
+}
+
+// setProtocol records the detected protocol
+func (c *trackedConn) setProtocol(proto protocol.Protocol) {
+	c.mutex.Lock()
+	c.protocol = proto
+	c.mutex.Unlock()
+}
+
+// setTarget records the upstream target
+func (c *trackedConn) setTarget(target string) {
+	c.mutex.Lock()
+	c.target = target
+	c.mutex.Unlock()
+}
+
+// setServerName records the host name the client asked for
+func (c *trackedConn) setServerName(name string) {
+	c.mutex.Lock()
+	c.serverName = name
+	c.mutex.Unlock()
+}
+
+// setIdentity records the verified client certificate identity
+func (c *trackedConn) setIdentity(identity string) {
+	c.mutex.Lock()
+	c.identity = identity
+	c.mutex.Unlock()
+}
+
+// setUpstream records the upstream connection
+func (c *trackedConn) setUpstream(conn net.Conn) {
+	c.mutex.Lock()
+	c.upstream = conn
+	c.mutex.Unlock()
+}
+
+// setShutdownHook registers a function called when server shutdown starts
+// Protocol handlers use it to wind down the connection gracefully
+func (c *trackedConn) setShutdownHook(hook func()) {
+	c.mutex.Lock()
+	c.shutdownHook = hook
+	c.mutex.Unlock()
+}
+
+// forceClose closes the client and upstream connections
+// It returns true if an upstream connection was closed
+func (c *trackedConn) forceClose() bool {
+	c.mutex.Lock()
+	upstream := c.upstream
+	c.mutex.Unlock()
+
+	c.conn.Close()
+	if upstream != nil {
+		upstream.Close()
+		return true
+	}
+	return false
+}
+
+// info returns a snapshot of the connection
+func (c *trackedConn) info() ConnInfo {
+	c.mutex.Lock()
+	proto, target, serverName, identity := c.protocol, c.target, c.serverName, c.identity
+	c.mutex.Unlock()
+
+	return ConnInfo{
+		ID:            c.id,
+		ClientAddr:    c.conn.RemoteAddr().String(),
+		ClientIP:      c.clientIP,
+		Protocol:      proto.String(),
+		Target:        target,
+		ServerName:    serverName,
+		Identity:      identity,
+		StartedAt:     c.started,
+		DurationSec:   time.Since(c.started).Seconds(),
+		BytesReceived: c.bytesReceived.Load(),
+		BytesSent:     c.bytesSent.Load(),
+	}
+}
+
+// connRegistry tracks active client connections
+type connRegistry struct {
+	mutex  sync.RWMutex
+	conns  map[uint64]*trackedConn
+	nextID atomic.Uint64
+}
+
+// newConnRegistry creates an empty connection registry
+func newConnRegistry() *connRegistry {
+	return &connRegistry{
+		conns: make(map[uint64]*trackedConn),
+	}
+}
+
+// add registers a new client connection
+func (r *connRegistry) add(conn net.Conn) *trackedConn {
+	tc := &trackedConn{
+		id:       r.nextID.Add(1),
+		conn:     conn,
+		clientIP: hostOf(conn.RemoteAddr()),
+		started:  time.Now(),
+	}
+
+	r.mutex.Lock()
+	r.conns[tc.id] = tc
+	r.mutex.Unlock()
+
+	return tc
+}
+
+// remove unregisters a client connection
+func (r *connRegistry) remove(id uint64) {
+	r.mutex.Lock()
+	delete(r.conns, id)
+	r.mutex.Unlock()
+}
+
+// get returns the connection with the given ID
+func (r *connRegistry) get(id uint64) (*trackedConn, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	tc, ok := r.conns[id]
+	return tc, ok
+}
+
+// byIP returns all connections from the given client IP
+func (r *connRegistry) byIP(ip string) []*trackedConn {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var result []*trackedConn
+	for _, tc := range r.conns {
+		if tc.clientIP == ip {
+			result = append(result, tc)
+		}
+	}
+	return result
+}
+
+// snapshot returns info for all connections ordered by ID
+func (r *connRegistry) snapshot() []ConnInfo {
+	r.mutex.RLock()
+	infos := make([]ConnInfo, 0, len(r.conns))
+	for _, tc := range r.conns {
+		infos = append(infos, tc.info())
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// notifyShutdown calls the shutdown hook of every connection
+func (r *connRegistry) notifyShutdown() {
+	r.mutex.RLock()
+	var hooks []func()
+	for _, tc := range r.conns {
+		tc.mutex.Lock()
+		if tc.shutdownHook != nil {
+			hooks = append(hooks, tc.shutdownHook)
+		}
+		tc.mutex.Unlock()
+	}
+	r.mutex.RUnlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// closeAll force-closes every tracked connection and returns a summary
+func (r *connRegistry) closeAll() *ShutdownError {
+	r.mutex.RLock()
+	conns := make([]*trackedConn, 0, len(r.conns))
+	for _, tc := range r.conns {
+		conns = append(conns, tc)
+	}
+	r.mutex.RUnlock()
+
+	summary := &ShutdownError{ByProtocol: make(map[string]int)}
+	for _, tc := range conns {
+		tc.mutex.Lock()
+		proto := tc.protocol
+		tc.mutex.Unlock()
+
+		summary.Clients++
+		summary.ByProtocol[proto.String()]++
+		if tc.forceClose() {
+			summary.Upstreams++
+		}
+	}
+	return summary
+}
+
+// count returns the number of tracked connections
+func (r *connRegistry) count() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.conns)
+}
+
+// countingWriter counts bytes written into an atomic counter
+// If active is set, it records the time of the last write in Unix
+// nanoseconds.
+type countingWriter struct {
+	w       io.Writer
+	counter *atomic.Uint64
+	active  *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.counter.Add(uint64(n))
+	if cw.active != nil && n > 0 {
+		cw.active.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// hostOf returns the host part of a network address
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Fallback actions for connections with an unrecognized protocol
+const (
+	fallbackClose   = "close"
+	fallbackForward = "forward"
+	fallbackHold    = "hold"
+	fallbackReset   = "reset"
+)
+
+// fallbackDialTimeout bounds connecting to the fallback target
+const fallbackDialTimeout = 10 * time.Second
+
+// handleUnknown applies the listener's fallback action to a connection whose
+// protocol was not recognized
+func (s *Server) handleUnknown(tc *trackedConn, reader *bufio.Reader) {
+	fallback := s.Config().Server.Fallback
+	s.sampleUnknown(tc, reader)
+
+	action := fallback.Action
+	if action == "" {
+		action = fallbackClose
+	}
+	s.metrics.IncrementFallback(action)
+
+	switch action {
+	case fallbackForward:
+		s.forwardUnknown(tc, reader, fallback.Target)
+	case fallbackHold:
+		delay := fallback.HoldMin
+		if spread := fallback.HoldMax - fallback.HoldMin; spread > 0 {
+			delay += time.Duration(rand.Int63n(int64(spread) + 1))
+		}
+		s.holdUnknown(tc, reader, delay)
+	case fallbackReset:
+		s.logInfo(fmt.Sprintf("resetting connection from %s with unrecognized protocol", tc.conn.RemoteAddr()))
+		resetConn(tc.conn)
+	default:
+		s.logInfo(fmt.Sprintf("closing connection from %s with unrecognized protocol", tc.conn.RemoteAddr()))
+	}
+}
+
+// forwardUnknown relays the connection, including the bytes peeked during
+// detection, to the fallback target
+// The target is dialed directly, never through SOCKS5, since it is
+// typically a local decoy web server; an injected dialer is still used
+func (s *Server) forwardUnknown(tc *trackedConn, reader *bufio.Reader, target string) {
+	tc.setTarget(target)
+	if err := s.checkUpstream(tc, target); err != nil {
+		s.logInfo(fmt.Sprintf("not forwarding unrecognized traffic from %s: %v", tc.conn.RemoteAddr(), err))
+		return
+	}
+	upstreamConn, err := s.dialDirect("tcp", target, fallbackDialTimeout)
+	if err != nil {
+		s.logError(fmt.Sprintf("failed to connect to fallback target %s", target), err)
+		s.metrics.IncrementErrors()
+		return
+	}
+	tc.setUpstream(upstreamConn)
+	defer upstreamConn.Close()
+
+	s.logInfo(fmt.Sprintf("forwarding unrecognized traffic from %s to %s", tc.conn.RemoteAddr(), target))
+	s.relay(tc, &bufferedConn{Conn: tc.conn, reader: reader}, upstreamConn)
+}
+
+// holdUnknown keeps the connection open, discarding what the client sends,
+// and closes it after delay or when shutdown starts
+func (s *Server) holdUnknown(tc *trackedConn, reader *bufio.Reader, delay time.Duration) {
+	s.logInfo(fmt.Sprintf("holding connection from %s with unrecognized protocol for %s", tc.conn.RemoteAddr(), delay.Round(time.Millisecond)))
+
+	tc.setShutdownHook(func() {
+		tc.conn.SetReadDeadline(time.Now())
+	})
+	tc.conn.SetReadDeadline(time.Now().Add(delay))
+	io.Copy(&countingWriter{w: io.Discard, counter: &tc.bytesReceived}, reader)
+}
+
+// resetConn closes conn with a TCP reset instead of an orderly shutdown
+// where the connection supports it
+func resetConn(conn net.Conn) {
+	if lingerer, ok := conn.(interface{ SetLinger(int) error }); ok {
+		lingerer.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// sampleUnknown logs the first bytes of an unrecognized connection at debug
+// level, rate limited so scanners cannot flood the log
+func (s *Server) sampleUnknown(tc *trackedConn, reader *bufio.Reader) {
+	n := s.Config().Server.Fallback.SampleBytes
+	if n == 0 || !s.logLevelEnabled(levelDebug) {
+		return
+	}
+
+	allowed, suppressed := s.state().unknownSamples.allow(time.Now())
+	if !allowed {
+		return
+	}
+
+	// Only bytes already read during detection are sampled, so sampling
+	// never waits for the client
+	if buffered := reader.Buffered(); buffered < n {
+		n = buffered
+	}
+	sample, _ := reader.Peek(n)
+
+	msg := fmt.Sprintf("unrecognized protocol from %s, first %d bytes: %q", tc.conn.RemoteAddr(), len(sample), sample)
+	if suppressed > 0 {
+		msg += fmt.Sprintf(" (%d samples suppressed)", suppressed)
+	}
+	s.logDebug(msg)
+}
+
+// sampleLimiter allows at most limit events per window
+type sampleLimiter struct {
+	mutex      sync.Mutex
+	limit      int
+	window     time.Duration
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// newSampleLimiter creates a limiter allowing limit events per window
+func newSampleLimiter(limit int, window time.Duration) *sampleLimiter {
+	return &sampleLimiter{limit: limit, window: window}
+}
+
+// allow reports whether an event at now is allowed, and how many events were
+// suppressed since the last allowed one
+func (l *sampleLimiter) allow(now time.Time) (bool, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		l.count = 0
+	}
+	if l.count >= l.limit {
+		l.suppressed++
+		return false, 0
+	}
+
+	l.count++
+	suppressed := l.suppressed
+	l.suppressed = 0
+	return true, suppressed
+}
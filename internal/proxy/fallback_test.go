@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+func TestFallbackActions(t *testing.T) {
+	// Decoy server answering every connection with a fixed page
+	decoy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoy.Close()
+	go func() {
+		for {
+			c, err := decoy.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 5)
+			io.ReadFull(c, buf)
+			c.Write(append([]byte("decoy:"), buf...))
+			c.Close()
+		}
+	}()
+
+	tests := []struct {
+		name      string
+		fallback  config.FallbackConfig
+		wantReply string
+		wantReset bool
+		minHeld   time.Duration
+	}{
+		{"close", config.FallbackConfig{Action: fallbackClose}, "", false, 0},
+		{"forward", config.FallbackConfig{Action: fallbackForward, Target: decoy.Addr().String()}, "decoy:hello", false, 0},
+		{"hold", config.FallbackConfig{Action: fallbackHold, HoldMin: 300 * time.Millisecond, HoldMax: 400 * time.Millisecond}, "", false, 300 * time.Millisecond},
+		{"reset", config.FallbackConfig{Action: fallbackReset}, "", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Server.Port = 0
+			cfg.Server.BindAddr = "127.0.0.1"
+			cfg.Server.Fallback = tt.fallback
+			cfg.Metrics.Enabled = false
+			cfg.SSL.CacheDir = t.TempDir()
+
+			server, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := server.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer server.Shutdown(context.Background())
+
+			conn, err := net.Dial("tcp", server.listener.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+
+			start := time.Now()
+			conn.Write([]byte("hello"))
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			reply, err := io.ReadAll(conn)
+			held := time.Since(start)
+
+			if string(reply) != tt.wantReply {
+				t.Errorf("reply = %q, want %q", reply, tt.wantReply)
+			}
+			if tt.wantReset {
+				if err == nil || !strings.Contains(err.Error(), "reset") {
+					t.Errorf("read error = %v, want connection reset", err)
+				}
+			} else if err != nil {
+				t.Errorf("read error = %v, want orderly close", err)
+			}
+			if held < tt.minHeld {
+				t.Errorf("connection closed after %v, want at least %v", held, tt.minHeld)
+			}
+
+			rec := httptest.NewRecorder()
+			server.metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			if want := `whatsapp_proxy_fallback_connections_total{action="` + tt.name + `"} 1`; !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("metrics missing %s", want)
+			}
+		})
+	}
+}
+
+func TestSampleLimiter(t *testing.T) {
+	limiter := newSampleLimiter(2, time.Minute)
+	start := time.Now()
+
+	for i, want := range []bool{true, true, false, false} {
+		if allowed, _ := limiter.allow(start); allowed != want {
+			t.Errorf("event %d allowed = %v, want %v", i, allowed, want)
+		}
+	}
+
+	allowed, suppressed := limiter.allow(start.Add(time.Minute))
+	if !allowed || suppressed != 2 {
+		t.Errorf("allow() after window = %v, %d suppressed, want true, 2", allowed, suppressed)
+	}
+}
@@ -2,17 +2,21 @@ package proxy
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/RevEngine3r/whatsapp-proxy-go/internal/protocol"
 )
 
+// defaultReaderSize is the minimum client read buffer size
+const defaultReaderSize = 4096
+
 // handleConnection handles an incoming connection
 func (s *Server) handleConnection(clientConn net.Conn) {
 	defer clientConn.Close()
@@ -20,14 +24,34 @@ func (s *Server) handleConnection(clientConn net.Conn) {
 	s.metrics.IncrementConnections()
 	defer s.metrics.DecrementConnections()
 
-	// Set read deadline for protocol detection
-	clientConn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	// Track connection for the admin API
+	tc := s.conns.add(clientConn)
+	defer func() {
+		s.conns.remove(tc.id)
+		s.metrics.AddBytesReceived(tc.bytesReceived.Load())
+		s.metrics.AddBytesSent(tc.bytesSent.Load())
+		s.notifyClose(tc)
+	}()
+
+	// The limit is read per connection, so a reload changes it live
+	if limit := s.Config().Server.MaxConnections; limit > 0 && s.conns.count() > limit {
+		s.logWarn(fmt.Sprintf("closing connection from %s: server.max_connections (%d) reached", clientConn.RemoteAddr(), limit))
+		s.metrics.IncrementConnectionsFailed()
+		return
+	}
+
+	if err := s.checkAccept(tc); err != nil {
+		s.logInfo(fmt.Sprintf("closing connection from %s: %v", clientConn.RemoteAddr(), err))
+		s.metrics.IncrementConnectionsFailed()
+		return
+	}
 
-	// Wrap connection in buffered reader for protocol detection
-	reader := bufio.NewReader(clientConn)
+	// Wrap connection in buffered reader for protocol detection; the buffer
+	// must hold everything the detector may peek
+	reader := bufio.NewReaderSize(clientConn, max(s.Config().Server.DetectPeekLimit, defaultReaderSize))
 
-	// Detect protocol
-	proto, err := protocol.Detect(reader)
+	// Detect protocol within the detection timeout
+	proto, err := s.state().detector.DetectConn(clientConn, reader)
 	if err != nil {
 		s.logError("protocol detection failed", err)
 		s.metrics.IncrementErrors()
@@ -36,26 +60,28 @@ func (s *Server) handleConnection(clientConn net.Conn) {
 	}
 
 	s.metrics.IncrementProtocol(proto)
+	tc.setProtocol(proto)
 	s.logInfo(fmt.Sprintf("detected protocol: %s from %s", proto, clientConn.RemoteAddr()))
 
-	// Remove read deadline for actual data transfer
-	clientConn.SetReadDeadline(time.Time{})
-
 	// Route to appropriate handler
 	switch proto {
 	case protocol.ProtocolHTTP:
-		s.handleHTTP(clientConn, reader)
+		s.handleHTTP(tc, reader)
 	case protocol.ProtocolHTTPS:
-		s.handleHTTPS(clientConn, reader)
+		s.handleHTTPS(tc, reader)
 	case protocol.ProtocolJabber:
-		s.handleJabber(clientConn, reader)
+		s.handleJabber(tc, reader)
 	default:
-		s.handleUnknown(clientConn, reader)
+		s.handleUnknown(tc, reader)
 	}
 }
 
 // handleHTTP handles HTTP protocol connections
-func (s *Server) handleHTTP(clientConn net.Conn, reader *bufio.Reader) {
+// Plain HTTP requests are relayed one at a time so that keep-alive
+// connections can be closed cleanly with "Connection: close" on shutdown
+func (s *Server) handleHTTP(tc *trackedConn, reader *bufio.Reader) {
+	clientConn := tc.conn
+
 	// Parse HTTP request
 	req, err := http.ReadRequest(reader)
 	if err != nil {
@@ -64,15 +90,134 @@ func (s *Server) handleHTTP(clientConn net.Conn, reader *bufio.Reader) {
 		return
 	}
 
-	s.logInfo(fmt.Sprintf("HTTP %s %s", req.Method, req.RequestURI))
-
-	// Handle CONNECT method (for HTTPS tunneling)
-	if req.Method == http.MethodConnect {
-		s.handleHTTPConnect(clientConn, req)
+	if s.serveHTTPChallenge(clientConn, req) {
 		return
 	}
 
-	// For other HTTP methods, establish connection to target
+	// Wake up an idle keep-alive connection when shutdown starts
+	var idle atomic.Bool
+	tc.setShutdownHook(func() {
+		if idle.Load() {
+			clientConn.SetReadDeadline(time.Now())
+		}
+	})
+
+	var upstreamConn net.Conn
+	var upstreamReader *bufio.Reader
+	var currentTarget string
+	defer func() {
+		if upstreamConn != nil {
+			upstreamConn.Close()
+		}
+	}()
+
+	clientWriter := &countingWriter{w: clientConn, counter: &tc.bytesSent}
+
+	for {
+		s.logInfo(fmt.Sprintf("HTTP %s %s", req.Method, req.RequestURI))
+
+		// Handle CONNECT method (for HTTPS tunneling)
+		if req.Method == http.MethodConnect {
+			if upstreamConn != nil {
+				upstreamConn.Close()
+				upstreamConn = nil
+			}
+			s.handleHTTPConnect(tc, req)
+			return
+		}
+
+		// For other HTTP methods, establish connection to target
+		target := httpTarget(req)
+		if upstreamConn == nil || target != currentTarget {
+			if upstreamConn != nil {
+				upstreamConn.Close()
+			}
+
+			upstreamConn, err = s.connectUpstream(tc, target)
+			if err != nil {
+				upstreamConn = nil
+				s.logError(fmt.Sprintf("failed to connect to %s", target), err)
+				s.metrics.IncrementErrors()
+				clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nConnection: close\r\n\r\n"))
+				return
+			}
+			upstreamReader = bufio.NewReader(upstreamConn)
+			currentTarget = target
+		}
+
+		// Write request to upstream
+		if err := req.Write(&countingWriter{w: upstreamConn, counter: &tc.bytesReceived}); err != nil {
+			s.logError("failed to write request to upstream", err)
+			s.metrics.IncrementErrors()
+			return
+		}
+
+		resp, err := http.ReadResponse(upstreamReader, req)
+		if err != nil {
+			s.logError("failed to read HTTP response from upstream", err)
+			s.metrics.IncrementErrors()
+			clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nConnection: close\r\n\r\n"))
+			return
+		}
+
+		// Protocol upgrades (e.g. WebSocket) become an opaque tunnel
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			err := resp.Write(clientWriter)
+			resp.Body.Close()
+			if err != nil {
+				return
+			}
+			if err := flushBuffered(upstreamReader, clientWriter); err != nil {
+				return
+			}
+			if err := flushBuffered(reader, &countingWriter{w: upstreamConn, counter: &tc.bytesReceived}); err != nil {
+				return
+			}
+			s.bidirectionalCopy(tc, upstreamConn)
+			return
+		}
+
+		// Ask the client to close the connection once shutdown has started
+		shuttingDown := s.isShuttingDown()
+		if shuttingDown {
+			resp.Header.Set("Connection", "close")
+			resp.Close = true
+		}
+
+		err = resp.Write(clientWriter)
+		resp.Body.Close()
+		if err != nil {
+			s.logError("failed to write HTTP response to client", err)
+			return
+		}
+
+		if shuttingDown || resp.Close || req.Close {
+			return
+		}
+
+		// Wait for the next request on the keep-alive connection, at most
+		// for the idle timeout
+		idleTimeout := s.Config().Server.IdleTimeout
+		if idleTimeout > 0 {
+			clientConn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+		idle.Store(true)
+		if s.isShuttingDown() {
+			return
+		}
+		req, err = http.ReadRequest(reader)
+		idle.Store(false)
+		if err != nil {
+			return
+		}
+		if idleTimeout > 0 {
+			clientConn.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// httpTarget returns the host:port an HTTP request is addressed to
+func httpTarget(req *http.Request) string {
 	target := req.Host
 	if target == "" {
 		target = req.URL.Host
@@ -80,30 +225,26 @@ func (s *Server) handleHTTP(clientConn net.Conn, reader *bufio.Reader) {
 	if !strings.Contains(target, ":") {
 		target += ":80"
 	}
+	return target
+}
 
-	// Connect to upstream
-	upstreamConn, err := s.dialUpstream("tcp", target)
-	if err != nil {
-		s.logError(fmt.Sprintf("failed to connect to %s", target), err)
-		s.metrics.IncrementErrors()
-		http.Error(clientConn.(*net.TCPConn), "Bad Gateway", http.StatusBadGateway)
-		return
+// flushBuffered writes any data buffered in the reader to w
+func flushBuffered(reader *bufio.Reader, w io.Writer) error {
+	if reader.Buffered() == 0 {
+		return nil
 	}
-	defer upstreamConn.Close()
-
-	// Write request to upstream
-	if err := req.Write(upstreamConn); err != nil {
-		s.logError("failed to write request to upstream", err)
-		s.metrics.IncrementErrors()
-		return
+	buffered := make([]byte, reader.Buffered())
+	if _, err := io.ReadFull(reader, buffered); err != nil {
+		return err
 	}
-
-	// Bidirectional copy
-	s.bidirectionalCopy(clientConn, upstreamConn)
+	_, err := w.Write(buffered)
+	return err
 }
 
 // handleHTTPConnect handles HTTP CONNECT method (HTTPS tunneling)
-func (s *Server) handleHTTPConnect(clientConn net.Conn, req *http.Request) {
+func (s *Server) handleHTTPConnect(tc *trackedConn, req *http.Request) {
+	clientConn := tc.conn
+
 	target := req.Host
 	if !strings.Contains(target, ":") {
 		target += ":443"
@@ -112,7 +253,7 @@ func (s *Server) handleHTTPConnect(clientConn net.Conn, req *http.Request) {
 	s.logInfo(fmt.Sprintf("CONNECT tunnel to %s", target))
 
 	// Connect to upstream
-	upstreamConn, err := s.dialUpstream("tcp", target)
+	upstreamConn, err := s.connectUpstream(tc, target)
 	if err != nil {
 		s.logError(fmt.Sprintf("failed to connect to %s", target), err)
 		s.metrics.IncrementErrors()
@@ -125,11 +266,19 @@ func (s *Server) handleHTTPConnect(clientConn net.Conn, req *http.Request) {
 	clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
 
 	// Bidirectional copy
-	s.bidirectionalCopy(clientConn, upstreamConn)
+	s.bidirectionalCopy(tc, upstreamConn)
 }
 
 // handleHTTPS handles HTTPS/TLS protocol connections
-func (s *Server) handleHTTPS(clientConn net.Conn, reader *bufio.Reader) {
+func (s *Server) handleHTTPS(tc *trackedConn, reader *bufio.Reader) {
+	if s.serveTLSALPNChallenge(tc, reader) {
+		return
+	}
+	if s.state().tlsConfig != nil {
+		s.handleTerminatedTLS(tc, reader)
+		return
+	}
+
 	// For HTTPS, we need SNI (Server Name Indication) from TLS ClientHello
 	// For now, we'll just proxy the TLS handshake through
 	// In a full implementation, you'd extract SNI from the ClientHello
@@ -147,7 +296,7 @@ func (s *Server) handleHTTPS(clientConn net.Conn, reader *bufio.Reader) {
 	// For now, proxy to a default WhatsApp endpoint
 	target := "web.whatsapp.com:443"
 
-	upstreamConn, err := s.dialUpstream("tcp", target)
+	upstreamConn, err := s.connectUpstream(tc, target)
 	if err != nil {
 		s.logError(fmt.Sprintf("failed to connect to %s", target), err)
 		s.metrics.IncrementErrors()
@@ -163,97 +312,141 @@ func (s *Server) handleHTTPS(clientConn net.Conn, reader *bufio.Reader) {
 	}
 
 	// Bidirectional copy
-	s.bidirectionalCopy(clientConn, upstreamConn)
+	s.bidirectionalCopy(tc, upstreamConn)
 }
 
-// handleJabber handles Jabber/XMPP protocol connections
-func (s *Server) handleJabber(clientConn net.Conn, reader *bufio.Reader) {
-	s.logInfo("Jabber/XMPP connection")
-
-	// WhatsApp uses Jabber protocol on port 5222
-	// Connect to WhatsApp's Jabber server
-	target := "e1.whatsapp.net:5222"
-
-	upstreamConn, err := s.dialUpstream("tcp", target)
-	if err != nil {
-		s.logError(fmt.Sprintf("failed to connect to %s", target), err)
-		s.metrics.IncrementErrors()
-		return
-	}
-	defer upstreamConn.Close()
-
-	// Copy any buffered data first
-	if reader.Buffered() > 0 {
-		buffered := make([]byte, reader.Buffered())
-		reader.Read(buffered)
-		upstreamConn.Write(buffered)
-	}
-
-	// Bidirectional copy
-	s.bidirectionalCopy(clientConn, upstreamConn)
+// bidirectionalCopy copies data bidirectionally between the client and upstream
+func (s *Server) bidirectionalCopy(tc *trackedConn, upstreamConn net.Conn) {
+	s.relay(tc, tc.conn, upstreamConn)
 }
 
-// handleUnknown handles unknown protocol connections
-func (s *Server) handleUnknown(clientConn net.Conn, reader *bufio.Reader) {
-	s.logInfo("unknown protocol - attempting transparent proxy")
-
-	// For unknown protocols, we can't determine the destination
-	// This would need additional configuration or rules
-	s.metrics.IncrementErrors()
-	s.logError("cannot proxy unknown protocol without destination", nil)
-}
-
-// bidirectionalCopy copies data bidirectionally between two connections
-func (s *Server) bidirectionalCopy(conn1, conn2 net.Conn) {
+// relay copies data bidirectionally between clientConn, which reads and
+// writes tc's client connection, and upstream
+func (s *Server) relay(tc *trackedConn, clientConn, upstreamConn net.Conn) {
+	conn1, conn2 := clientConn, upstreamConn
 	done := make(chan struct{}, 2)
 
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	defer s.closeWhenIdle(tc, &lastActive, conn1, conn2)()
+
 	// Copy from conn1 to conn2
 	go func() {
 		defer func() { done <- struct{}{} }()
-		n, err := io.Copy(conn2, conn1)
-		if err != nil && err != io.EOF {
+		_, err := io.Copy(&countingWriter{w: conn2, counter: &tc.bytesReceived, active: &lastActive}, conn1)
+		if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
 			s.logError("copy error (client->upstream)", err)
 		}
-		s.metrics.AddBytesReceived(uint64(n))
 	}()
 
 	// Copy from conn2 to conn1
 	go func() {
 		defer func() { done <- struct{}{} }()
-		n, err := io.Copy(conn1, conn2)
-		if err != nil && err != io.EOF {
+		_, err := io.Copy(&countingWriter{w: conn1, counter: &tc.bytesSent, active: &lastActive}, conn2)
+		if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
 			s.logError("copy error (upstream->client)", err)
 		}
-		s.metrics.AddBytesSent(uint64(n))
 	}()
 
-	// Wait for both directions to complete
+	// Wait for one direction to complete, then close both connections
+	// so the other direction unblocks (also used to kill connections)
 	<-done
+	conn1.Close()
+	conn2.Close()
 	<-done
 }
 
+// closeWhenIdle closes conns once no data has been relayed since lastActive
+// for the idle timeout, and returns a function that stops watching
+// The timeout is read when the relay starts, so a reload applies to new
+// connections.
+func (s *Server) closeWhenIdle(tc *trackedConn, lastActive *atomic.Int64, conns ...net.Conn) (stop func()) {
+	timeout := s.Config().Server.IdleTimeout
+	if timeout <= 0 {
+		return func() {}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-timer.C:
+			}
+
+			idle := time.Since(time.Unix(0, lastActive.Load()))
+			if idle < timeout {
+				timer.Reset(timeout - idle)
+				continue
+			}
+			s.logInfo(fmt.Sprintf("closing connection from %s: idle for %s", tc.conn.RemoteAddr(), timeout))
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+// connectUpstream dials the target for a client connection and tracks the
+// upstream connection so it can be force-closed on shutdown
+func (s *Server) connectUpstream(tc *trackedConn, target string) (net.Conn, error) {
+	tc.setTarget(target)
+	if err := s.checkUpstream(tc, target); err != nil {
+		return nil, err
+	}
+
+	upstreamConn, err := s.dialUpstream("tcp", target)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.setUpstream(upstreamConn)
+	return upstreamConn, nil
+}
+
 // dialUpstream dials the upstream server, optionally through SOCKS5
 func (s *Server) dialUpstream(network, address string) (net.Conn, error) {
-	if s.socks5Client != nil {
+	s.upstreamMu.RLock()
+	client := s.socks5Client
+	s.upstreamMu.RUnlock()
+
+	if client != nil {
 		// Dial through SOCKS5 proxy
-		return s.socks5Client.DialTimeout(network, address, 30*time.Second)
+		return client.DialTimeout(network, address, upstreamDialTimeout)
 	}
 
 	// Direct connection
-	return net.DialTimeout(network, address, 30*time.Second)
+	return s.dialDirect(network, address, upstreamDialTimeout)
 }
 
 // Logging helpers
+func (s *Server) logDebug(msg string) {
+	if s.logLevelEnabled(levelDebug) {
+		s.logger.Printf("[DEBUG] %s", msg)
+	}
+}
+
 func (s *Server) logInfo(msg string) {
-	if s.config.Logging.Level == "debug" || s.config.Logging.Level == "info" {
-		log.Printf("[INFO] %s", msg)
+	if s.logLevelEnabled(levelInfo) {
+		s.logger.Printf("[INFO] %s", msg)
+	}
+}
+
+func (s *Server) logWarn(msg string) {
+	if s.logLevelEnabled(levelWarn) {
+		s.logger.Printf("[WARN] %s", msg)
 	}
 }
 
 func (s *Server) logError(msg string, err error) {
 	if err != nil {
-		log.Printf("[ERROR] %s: %v", msg, err)
+		s.logger.Printf("[ERROR] %s: %v", msg, err)
 	} else {
-		log.Printf("[ERROR] %s", msg)
+		s.logger.Printf("[ERROR] %s", msg)
 	}
 }
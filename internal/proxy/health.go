@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/ssl"
+)
+
+// Health states reported by /health
+const (
+	healthOK       = "OK"
+	healthDegraded = "DEGRADED"
+	healthDraining = "DRAINING"
+)
+
+// isExpiring reports whether a certificate expires within the configured
+// warning window
+func (s *Server) isExpiring(info ssl.CertificateInfo) bool {
+	days := s.Config().SSL.ExpiryWarningDays
+	return days > 0 && time.Until(info.NotAfter) < time.Duration(days)*24*time.Hour
+}
+
+// health returns the health state and the reasons for a degraded state
+// Draining takes precedence; expiring certificates degrade the proxy but it
+// keeps serving
+func (s *Server) health() (string, []string) {
+	if s.IsDraining() {
+		return healthDraining, nil
+	}
+	if s.state().sslManager == nil {
+		return healthOK, nil
+	}
+
+	var reasons []string
+	for _, info := range s.state().sslManager.Certificates() {
+		if !s.isExpiring(info) {
+			continue
+		}
+		remaining := time.Until(info.NotAfter)
+		if remaining <= 0 {
+			reasons = append(reasons, fmt.Sprintf("certificate %s expired on %s", info.Name, info.NotAfter.Format(time.RFC3339)))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("certificate %s expires in %.1f days", info.Name, remaining.Hours()/24))
+		}
+	}
+	if len(reasons) > 0 {
+		return healthDegraded, reasons
+	}
+	return healthOK, nil
+}
+
+// serveHealth reports the health state for load balancers and monitoring
+// Only draining returns 503; a degraded proxy still answers 200 so it stays
+// in rotation, with the reasons in the body
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	state, reasons := s.health()
+	if state == healthDraining {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.Write([]byte(state))
+	if len(reasons) > 0 {
+		w.Write([]byte("\n" + strings.Join(reasons, "\n") + "\n"))
+	}
+}
+
+// serveCertificates lists the served certificates as JSON
+func (s *Server) serveCertificates(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	certificates := []ssl.CertificateInfo{}
+	if s.state().sslManager != nil {
+		certificates = s.state().sslManager.Certificates()
+	}
+
+	type certificateStatus struct {
+		ssl.CertificateInfo
+		DaysRemaining float64 `json:"days_remaining"`
+		Expiring      bool    `json:"expiring"`
+	}
+	statuses := make([]certificateStatus, len(certificates))
+	for i, info := range certificates {
+		statuses[i] = certificateStatus{
+			CertificateInfo: info,
+			DaysRemaining:   time.Until(info.NotAfter).Hours() / 24,
+			Expiring:        s.isExpiring(info),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"expiry_warning_days": s.Config().SSL.ExpiryWarningDays,
+		"certificates":        statuses,
+	})
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/protocol"
+)
+
+// streamErrorWriteTimeout bounds sending a stream error to a client
+const streamErrorWriteTimeout = 5 * time.Second
+
+// handleJabber handles Jabber/XMPP protocol connections
+// The stream header is parsed without consuming it; its to attribute selects
+// the upstream and is checked against the allowed domains
+func (s *Server) handleJabber(tc *trackedConn, reader *bufio.Reader) {
+	clientConn := tc.conn
+
+	// The header may not have arrived completely during detection
+	if timeout := s.Config().Server.DetectTimeout; timeout > 0 {
+		clientConn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	header, err := protocol.PeekStreamHeader(reader, s.state().detector.PeekLimit())
+	clientConn.SetReadDeadline(time.Time{})
+	if err != nil {
+		s.rejectStream(tc, err)
+		return
+	}
+	tc.setServerName(header.To)
+
+	target, err := s.jabberRoute(header.To)
+	if err != nil {
+		s.rejectStream(tc, err)
+		return
+	}
+	s.logInfo(fmt.Sprintf("Jabber stream from %s: to=%q version=%q xmlns=%q, routing to %s",
+		clientConn.RemoteAddr(), header.To, header.Version, header.XMLNS, target))
+
+	upstreamConn, err := s.connectUpstream(tc, target)
+	if err != nil {
+		s.logError(fmt.Sprintf("failed to connect to %s", target), err)
+		s.metrics.IncrementErrors()
+		s.rejectStream(tc, &protocol.StreamError{Condition: protocol.StreamErrorRemoteConnection})
+		return
+	}
+	defer upstreamConn.Close()
+
+	// The peeked header is relayed along with the rest of the stream
+	s.relay(tc, &bufferedConn{Conn: clientConn, reader: reader}, upstreamConn)
+}
+
+// jabberRoute returns the upstream for a stream addressed to domain
+// Domains outside the allowed domains are rejected with host-unknown.
+func (s *Server) jabberRoute(domain string) (string, error) {
+	cfg := s.Config().Jabber
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	if len(cfg.AllowedDomains) > 0 && !matchesAnyDomain(cfg.AllowedDomains, domain) {
+		return "", &protocol.StreamError{
+			Condition: protocol.StreamErrorHostUnknown,
+			Text:      fmt.Sprintf("domain %q is not served by this proxy", domain),
+		}
+	}
+
+	for _, route := range cfg.Routes {
+		if matchDomain(route.Domain, domain) {
+			return route.Target, nil
+		}
+	}
+	if cfg.DefaultTarget != "" {
+		return cfg.DefaultTarget, nil
+	}
+	return chatTarget, nil
+}
+
+// rejectStream sends a stream error to the client before the connection is
+// closed; errors other than stream errors are only logged
+func (s *Server) rejectStream(tc *trackedConn, err error) {
+	var streamErr *protocol.StreamError
+	if !errors.As(err, &streamErr) {
+		s.logError(fmt.Sprintf("failed to read Jabber stream header from %s", tc.conn.RemoteAddr()), err)
+		s.metrics.IncrementErrors()
+		return
+	}
+
+	s.logWarn(fmt.Sprintf("rejecting Jabber stream from %s: %v", tc.conn.RemoteAddr(), streamErr))
+	s.metrics.IncrementStreamError(streamErr.Condition)
+
+	tc.conn.SetWriteDeadline(time.Now().Add(streamErrorWriteTimeout))
+	n, _ := tc.conn.Write(streamErr.Stanza())
+	tc.bytesSent.Add(uint64(n))
+}
+
+// matchesAnyDomain reports whether domain matches one of patterns
+func matchesAnyDomain(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		if matchDomain(pattern, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain reports whether domain matches pattern, an exact domain or a
+// wildcard such as *.whatsapp.net covering exactly one leftmost label, like
+// certificate names
+func matchDomain(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if domain == "" {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		label, found := strings.CutSuffix(domain, suffix)
+		return found && label != "" && !strings.Contains(label, ".")
+	}
+	return pattern == domain
+}
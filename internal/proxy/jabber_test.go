@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+// startRecordingUpstream accepts connections and sends what each one sent
+// first to the returned channel
+func startRecordingUpstream(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 4)
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4096)
+			c.SetReadDeadline(time.Now().Add(2 * time.Second))
+			n, _ := c.Read(buf)
+			received <- string(buf[:n])
+			c.Close()
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestJabberRouting(t *testing.T) {
+	routed, routedReceived := startRecordingUpstream(t)
+	fallback, fallbackReceived := startRecordingUpstream(t)
+
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Server.BindAddr = "127.0.0.1"
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = t.TempDir()
+	cfg.Jabber = config.JabberConfig{
+		DefaultTarget:  fallback,
+		Routes:         []config.JabberRoute{{Domain: "chat.example", Target: routed}},
+		AllowedDomains: []string{"chat.example", "*.example.net"},
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Shutdown(context.Background())
+
+	header := func(to string) string {
+		return "<?xml version='1.0'?><stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' to='" + to + "' version='1.0'>"
+	}
+
+	tests := []struct {
+		name       string
+		data       string
+		upstream   <-chan string
+		wantReject string
+	}{
+		{"routed domain", header("CHAT.example"), routedReceived, ""},
+		{"default target", header("eu.example.net"), fallbackReceived, ""},
+		{"domain not allowed", header("other.example"), nil, "host-unknown"},
+		{"malformed header", "<stream:stream xmlns='jabber:client' to='chat.example'>", nil, "invalid-namespace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", server.listener.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			conn.Write([]byte(tt.data))
+
+			if tt.wantReject != "" {
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				reply, _ := io.ReadAll(conn)
+				if !strings.Contains(string(reply), "<"+tt.wantReject+" ") {
+					t.Errorf("reply = %s, want stream error %s", reply, tt.wantReject)
+				}
+				return
+			}
+
+			select {
+			case got := <-tt.upstream:
+				if got != tt.data {
+					t.Errorf("upstream received %q, want %q", got, tt.data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("stream was not routed to the expected upstream")
+			}
+		})
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		pattern string
+		domain  string
+		want    bool
+	}{
+		{"s.whatsapp.net", "s.whatsapp.net", true},
+		{"S.WhatsApp.net.", "s.whatsapp.net", true},
+		{"*.whatsapp.net", "g.whatsapp.net", true},
+		{"*.whatsapp.net", "whatsapp.net", false},
+		{"*.whatsapp.net", "a.g.whatsapp.net", false},
+		{"s.whatsapp.net", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchDomain(tt.pattern, tt.domain); got != tt.want {
+			t.Errorf("matchDomain(%q, %q) = %v, want %v", tt.pattern, tt.domain, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/sockopt"
+)
+
+// listenConfigured opens the proxy listener configured in cfg: the Unix
+// socket if unix_socket.path is set, else the TCP address with the socket
+// options of cfg.TCP, refused ones passed to report
+// A stale socket file left by a process that exited is replaced; the mode
+// and ownership are applied before it returns. Closing the listener
+// leaves the socket file in place, so it can be handed over to a restarted
+// process; the server removes it at shutdown.
+func listenConfigured(cfg *config.ServerConfig, report func(error)) (net.Listener, error) {
+	network, address := cfg.Listener()
+	if network != "unix" {
+		lc := net.ListenConfig{
+			KeepAlive: cfg.TCP.KeepAlive,
+			Control:   sockopt.Control(cfg.TCP.SocketOptions(), true, report),
+		}
+		return lc.Listen(context.Background(), network, address)
+	}
+
+	sock := &cfg.UnixSocket
+	mode, err := sock.FileMode()
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(sock.Path); err != nil {
+		return nil, err
+	}
+
+	// Never let more users connect than configured, not even before the
+	// permissions below are applied: until the ownership is changed only
+	// the owner may connect
+	initial := mode
+	if sock.Owner != "" || sock.Group != "" {
+		initial &= 0o700
+	}
+	listener, err := listenUnix(sock.Path, initial)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := setSocketPermissions(sock, mode); err != nil {
+		listener.Close()
+		os.Remove(sock.Path)
+		return nil, err
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes a socket file nobody listens on any more
+// A live socket or a file that is not a socket is left alone and reported.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// setSocketPermissions applies the configured ownership, then the mode
+func setSocketPermissions(sock *config.UnixSocketConfig, mode os.FileMode) error {
+	if err := setSocketOwnership(sock); err != nil {
+		return err
+	}
+	if mode != 0 {
+		if err := os.Chmod(sock.Path, mode); err != nil {
+			return fmt.Errorf("failed to set socket mode: %w", err)
+		}
+	}
+	return nil
+}
+
+// setSocketOwnership applies the configured owner and group
+func setSocketOwnership(sock *config.UnixSocketConfig) error {
+	if sock.Owner == "" && sock.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if sock.Owner != "" {
+		u, err := lookupID(sock.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unknown socket owner %q: %w", sock.Owner, err)
+		}
+		uid = u
+	}
+	if sock.Group != "" {
+		g, err := lookupID(sock.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unknown socket group %q: %w", sock.Group, err)
+		}
+		gid = g
+	}
+	if err := os.Chown(sock.Path, uid, gid); err != nil {
+		return fmt.Errorf("failed to set socket ownership: %w", err)
+	}
+	return nil
+}
+
+// lookupID resolves a user or group given by name or numeric ID
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// tuneConn applies the per-connection options of tcp that Go overrides
+// after the socket is connected
+func tuneConn(conn net.Conn, tcp *config.TCPConfig) {
+	if c, ok := conn.(*net.TCPConn); ok && !tcp.NoDelay {
+		c.SetNoDelay(false)
+	}
+}
+
+// warnSocketOption logs a socket option the system refused, once per
+// option and error
+func (s *Server) warnSocketOption(err error) {
+	if _, logged := s.socketOptionWarnings.LoadOrStore(err.Error(), true); !logged {
+		s.logger.Printf("[WARN] Socket option ignored: %v", err)
+	}
+}
@@ -0,0 +1,451 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+// connectThrough sends a CONNECT request for target over conn and returns
+// the response status code
+func connectThrough(t *testing.T, conn net.Conn, target string) int {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix socket file modes are not supported on Windows")
+	}
+	target, _ := startRecordingUpstream(t)
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, path string)
+		wantErr string
+	}{
+		{
+			name: "new socket",
+		},
+		{
+			name: "stale socket replaced",
+			setup: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				l.(*net.UnixListener).SetUnlinkOnClose(false)
+				l.Close()
+			},
+		},
+		{
+			name: "socket in use",
+			setup: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { l.Close() })
+			},
+			wantErr: "in use by another process",
+		},
+		{
+			name: "regular file",
+			setup: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "is not a socket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "proxy.sock")
+			if tt.setup != nil {
+				tt.setup(t, path)
+			}
+
+			cfg := config.Default()
+			cfg.Server.UnixSocket.Path = path
+			cfg.Server.UnixSocket.Mode = "0600"
+			cfg.Metrics.Enabled = false
+			cfg.SSL.CacheDir = t.TempDir()
+
+			server, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			err = server.Start()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Start() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != 0o600 {
+				t.Errorf("socket mode = %o, want 600", mode)
+			}
+
+			conn, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			if code := connectThrough(t, conn, target); code != http.StatusOK {
+				t.Errorf("CONNECT status = %d, want 200", code)
+			}
+			conn.Close()
+
+			if err := server.Shutdown(context.Background()); err != nil {
+				t.Errorf("Shutdown() error = %v", err)
+			}
+			if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("socket file left after shutdown: %v", err)
+			}
+		})
+	}
+}
+
+func TestListenUnixInitialMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix socket file modes are not supported on Windows")
+	}
+
+	for _, perm := range []os.FileMode{0o600, 0o660} {
+		path := filepath.Join(t.TempDir(), "proxy.sock")
+		l, err := listenUnix(path, perm)
+		if err != nil {
+			t.Fatalf("listenUnix() error = %v", err)
+		}
+		info, err := os.Stat(path)
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != perm {
+			t.Errorf("socket mode right after bind = %o, want %o", got, perm)
+		}
+	}
+}
+
+// flakyListener fails the first accepts and has no deadlines
+type flakyListener struct {
+	net.Listener
+	failures atomic.Int32
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures.Add(-1) >= 0 {
+		return nil, errors.New("too many open files")
+	}
+	return l.Listener.Accept()
+}
+
+func TestAcceptLoopCustomListener(t *testing.T) {
+	target, _ := startRecordingUpstream(t)
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := &flakyListener{Listener: tcp}
+	listener.failures.Store(3)
+
+	cfg := config.Default()
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = t.TempDir()
+	server, err := New(cfg, WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := server.StartWithListeners(listener, nil); err != nil {
+		t.Fatalf("StartWithListeners() error = %v", err)
+	}
+
+	conn, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	if code := connectThrough(t, conn, target); code != http.StatusOK {
+		t.Errorf("CONNECT status = %d, want 200 after accept errors", code)
+	}
+	conn.Close()
+
+	if err := server.CheckLiveness(); err != nil {
+		t.Errorf("CheckLiveness() error = %v", err)
+	}
+
+	// Closing the listener must stop the blocked Accept
+	done := make(chan error, 1)
+	go func() { done <- server.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown() did not stop the accept loop")
+	}
+	if n := server.acceptLoops.Load(); n != 0 {
+		t.Errorf("%d accept loops still running", n)
+	}
+}
+
+// startAcceptorServer starts a server on 127.0.0.1 whose connections are
+// refused right after accept
+func startAcceptorServer(tb testing.TB, accepted *atomic.Int64, edit func(*config.ServerConfig)) *Server {
+	tb.Helper()
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Server.BindAddr = "127.0.0.1"
+	edit(&cfg.Server)
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = tb.TempDir()
+
+	server, err := New(cfg,
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithConnHook(ConnHookFuncs{Accept: func(ConnInfo) error {
+			accepted.Add(1)
+			return errors.New("accept path only")
+		}}),
+	)
+	if err != nil {
+		tb.Fatalf("New() error = %v", err)
+	}
+	if err := server.Start(); err != nil {
+		tb.Fatalf("Start() error = %v", err)
+	}
+	tb.Cleanup(func() { server.Shutdown(context.Background()) })
+	return server
+}
+
+// dialAndWait connects to addr and waits for the server to close
+func dialAndWait(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read = %v, want EOF", err)
+	}
+	return nil
+}
+
+func TestAcceptors(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT balancing is Linux only")
+	}
+
+	var accepted atomic.Int64
+	server := startAcceptorServer(t, &accepted, func(cfg *config.ServerConfig) {
+		cfg.Acceptors = 4
+	})
+	if n := server.acceptLoops.Load(); n != 4 {
+		t.Fatalf("%d accept loops, want 4", n)
+	}
+
+	addr := server.listener.Addr().String()
+	for i := 0; i < 50; i++ {
+		if err := dialAndWait(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := accepted.Load(); n != 50 {
+		t.Errorf("accepted %d connections, want 50", n)
+	}
+
+	if err := server.Drain(); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for server.acceptLoops.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.acceptLoops.Load(); n != 0 {
+		t.Errorf("%d accept loops running after drain", n)
+	}
+
+	if err := server.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if n := server.acceptLoops.Load(); n != 4 {
+		t.Errorf("%d accept loops after resume, want 4", n)
+	}
+}
+
+// handOver duplicates listener as upgrade.Restart passes it to a child
+func handOver(t *testing.T, listener net.Listener) net.Listener {
+	t.Helper()
+	f, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestAcceptorsHandoff(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT balancing is Linux only")
+	}
+
+	var parentAccepted, childAccepted atomic.Int64
+	acceptors := func(cfg *config.ServerConfig) { cfg.Acceptors = 4 }
+	parent := startAcceptorServer(t, &parentAccepted, acceptors)
+	addr := parent.listener.Addr().String()
+
+	proxyListener, _ := parent.Listeners()
+	inheritedProxy := handOver(t, proxyListener)
+	var inherited []net.Listener
+	for _, l := range parent.Acceptors() {
+		inherited = append(inherited, handOver(t, l))
+	}
+	if len(inherited) != 3 {
+		t.Fatalf("Acceptors() returned %d listeners, want 3", len(inherited))
+	}
+	if err := parent.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	// Connections queue up on all four sockets between the parent closing
+	// its copies and the child accepting
+	var conns []net.Conn
+	for i := 0; i < 40; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() during handoff error = %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Server.BindAddr = "127.0.0.1"
+	acceptors(&cfg.Server)
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = t.TempDir()
+	child, err := New(cfg,
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithConnHook(ConnHookFuncs{Accept: func(ConnInfo) error {
+			childAccepted.Add(1)
+			return errors.New("accept path only")
+		}}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := child.StartWithListeners(inheritedProxy, nil, inherited...); err != nil {
+		t.Fatalf("StartWithListeners() error = %v", err)
+	}
+	defer child.Shutdown(context.Background())
+
+	if n := child.acceptLoops.Load(); n != 4 {
+		t.Errorf("%d accept loops in the child, want 4", n)
+	}
+	for i, l := range child.Acceptors() {
+		if l != inherited[i] {
+			t.Errorf("acceptor %d was bound anew instead of adopted", i)
+		}
+	}
+
+	// Every queued connection is served by the child, none is reset
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("connection %d: read = %v, want EOF", i, err)
+		}
+	}
+	if n := childAccepted.Load(); n != 40 {
+		t.Errorf("child accepted %d connections, want 40", n)
+	}
+}
+
+func TestAcceptRateLimit(t *testing.T) {
+	var accepted atomic.Int64
+	server := startAcceptorServer(t, &accepted, func(cfg *config.ServerConfig) {
+		cfg.AcceptRate = 20
+		cfg.AcceptBurst = 5
+	})
+
+	// Beyond the burst, 10 connections take about half a second
+	addr := server.listener.Addr().String()
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		if err := dialAndWait(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("15 connections took %s, want at least 400ms", elapsed)
+	}
+	if server.metrics.acceptsThrottled.Load() == 0 {
+		t.Error("no throttled accepts counted")
+	}
+}
+
+// BenchmarkAccept measures connections per second through the accept path
+// with one and several SO_REUSEPORT acceptors; run with -cpu to compare,
+// e.g. go test -run ^$ -bench Accept -cpu 1,4,8 ./internal/proxy
+func BenchmarkAccept(b *testing.B) {
+	for _, acceptors := range []int{1, 2, 4, 8} {
+		if acceptors > 1 && runtime.GOOS != "linux" {
+			continue
+		}
+		b.Run(fmt.Sprintf("acceptors=%d", acceptors), func(b *testing.B) {
+			var accepted atomic.Int64
+			server := startAcceptorServer(b, &accepted, func(cfg *config.ServerConfig) {
+				cfg.Acceptors = acceptors
+			})
+			addr := server.listener.Addr().String()
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := dialAndWait(addr); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			b.ReportMetric(float64(accepted.Load())/b.Elapsed().Seconds(), "conns/s")
+		})
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenUnix creates a Unix socket whose file mode is at most perm from the
+// moment it exists; a perm of 0 leaves the mode to the umask
+// The umask is process-wide, so it is only narrowed for the bind itself.
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if perm != 0 {
+		old := syscall.Umask(int(0o777 &^ perm))
+		defer syscall.Umask(old)
+	}
+	return net.Listen("unix", path)
+}
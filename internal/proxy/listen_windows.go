@@ -0,0 +1,13 @@
+//go:build windows
+
+package proxy
+
+import (
+	"net"
+	"os"
+)
+
+// listenUnix creates a Unix socket; Windows has no file modes to apply
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
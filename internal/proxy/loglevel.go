@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// logLevel is the verbosity of server logging
+type logLevel int32
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// String returns the config name of the log level
+func (l logLevel) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelInfo:
+		return "info"
+	case levelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// parseLogLevel parses a log level name
+func parseLogLevel(name string) (logLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn":
+		return levelWarn, nil
+	case "error":
+		return levelError, nil
+	default:
+		return levelInfo, fmt.Errorf("invalid log level: %s (must be debug, info, warn, or error)", name)
+	}
+}
+
+// SetLogLevel changes the server log level at runtime
+func (s *Server) SetLogLevel(name string) error {
+	level, err := parseLogLevel(name)
+	if err != nil {
+		return err
+	}
+	s.logLevel.Store(int32(level))
+	return nil
+}
+
+// LogLevel returns the current server log level
+func (s *Server) LogLevel() string {
+	return logLevel(s.logLevel.Load()).String()
+}
+
+// logLevelEnabled reports whether messages at the given level are logged
+func (s *Server) logLevelEnabled(level logLevel) bool {
+	return level >= logLevel(s.logLevel.Load())
+}
@@ -3,86 +3,209 @@ package proxy
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/RevEngine3r/whatsapp-proxy-go/internal/protocol"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/ssl"
 )
 
 // Metrics holds proxy server metrics
 type Metrics struct {
 	// Connection counters
-	connectionsTotal    atomic.Uint64
-	connectionsActive   atomic.Int64
-	connectionsFailed   atomic.Uint64
+	connectionsTotal  atomic.Uint64
+	connectionsActive atomic.Int64
+	connectionsFailed atomic.Uint64
 
-	// Protocol-specific counters
-	httpConnections     atomic.Uint64
-	httpsConnections    atomic.Uint64
-	jabberConnections   atomic.Uint64
-	unknownConnections  atomic.Uint64
+	// Accepts delayed by the accept rate limit
+	acceptsThrottled atomic.Uint64
+
+	// Protocol-specific counters, keyed by protocol so matchers added to
+	// the detector are counted too
+	protocolMutex sync.Mutex
+	protocols     map[protocol.Protocol]uint64
+
+	// Fallback actions applied to unrecognized connections
+	fallbackMutex sync.Mutex
+	fallbacks     map[string]uint64
+
+	// Jabber stream errors sent to clients, by condition
+	streamErrorMutex sync.Mutex
+	streamErrors     map[string]uint64
+
+	// Configuration reloads
+	configReloadSuccess atomic.Uint64
+	configReloadFailure atomic.Uint64
+	configReloadTime    atomic.Int64
 
 	// Data transfer counters
-	bytesSent           atomic.Uint64
-	bytesReceived       atomic.Uint64
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
 
 	// Error counters
-	errorsTotal         atomic.Uint64
+	errorsTotal atomic.Uint64
+
+	// TLS termination counters
+	tlsHandshakeFailures atomic.Uint64
+	identityMutex        sync.Mutex
+	identities           map[string]uint64
 
 	// Server start time
-	startTime           time.Time
+	startTime time.Time
+
+	// certificates reports the active certificate, if set
+	certificates func() ssl.Status
+
+	// sinks receive every update; set before the server starts
+	sinks []MetricsSink
 }
 
+// maxIdentityLabels caps the distinct client identities exported as
+// metric labels; further identities are counted as "other"
+const maxIdentityLabels = 1000
+
 // NewMetrics creates a new Metrics instance
 func NewMetrics() *Metrics {
 	return &Metrics{
 		startTime: time.Now(),
+		protocols: map[protocol.Protocol]uint64{
+			protocol.ProtocolHTTP:    0,
+			protocol.ProtocolHTTPS:   0,
+			protocol.ProtocolJabber:  0,
+			protocol.ProtocolUnknown: 0,
+		},
+		fallbacks: map[string]uint64{
+			fallbackClose:   0,
+			fallbackForward: 0,
+			fallbackHold:    0,
+			fallbackReset:   0,
+		},
+		streamErrors: make(map[string]uint64),
+		identities:   make(map[string]uint64),
 	}
 }
 
+// SetCertificateSource sets where certificate metrics are read from
+func (m *Metrics) SetCertificateSource(source func() ssl.Status) {
+	m.certificates = source
+}
+
 // IncrementConnections increments active connections
 func (m *Metrics) IncrementConnections() {
 	m.connectionsTotal.Add(1)
 	m.connectionsActive.Add(1)
+	m.addCounter("whatsapp_proxy_connections_total", nil, 1)
+	m.addGauge("whatsapp_proxy_connections_active", 1)
 }
 
 // DecrementConnections decrements active connections
 func (m *Metrics) DecrementConnections() {
 	m.connectionsActive.Add(-1)
+	m.addGauge("whatsapp_proxy_connections_active", -1)
 }
 
 // IncrementConnectionsFailed increments failed connection counter
 func (m *Metrics) IncrementConnectionsFailed() {
 	m.connectionsFailed.Add(1)
+	m.addCounter("whatsapp_proxy_connections_failed", nil, 1)
+}
+
+// IncrementAcceptsThrottled counts an accept delayed by the rate limit
+func (m *Metrics) IncrementAcceptsThrottled() {
+	m.acceptsThrottled.Add(1)
+	m.addCounter("whatsapp_proxy_accepts_throttled_total", nil, 1)
 }
 
 // IncrementProtocol increments the counter for a specific protocol
 func (m *Metrics) IncrementProtocol(proto protocol.Protocol) {
-	switch proto {
-	case protocol.ProtocolHTTP:
-		m.httpConnections.Add(1)
-	case protocol.ProtocolHTTPS:
-		m.httpsConnections.Add(1)
-	case protocol.ProtocolJabber:
-		m.jabberConnections.Add(1)
-	default:
-		m.unknownConnections.Add(1)
+	m.protocolMutex.Lock()
+	m.protocols[proto]++
+	m.protocolMutex.Unlock()
+	m.addCounter("whatsapp_proxy_protocol_connections", map[string]string{"protocol": strings.ToLower(proto.String())}, 1)
+}
+
+// IncrementFallback counts a fallback action applied to an unrecognized
+// connection
+func (m *Metrics) IncrementFallback(action string) {
+	m.fallbackMutex.Lock()
+	m.fallbacks[action]++
+	m.fallbackMutex.Unlock()
+	m.addCounter("whatsapp_proxy_fallback_connections_total", map[string]string{"action": action}, 1)
+}
+
+// IncrementStreamError counts a Jabber stream error sent to a client
+func (m *Metrics) IncrementStreamError(condition string) {
+	m.streamErrorMutex.Lock()
+	m.streamErrors[condition]++
+	m.streamErrorMutex.Unlock()
+	m.addCounter("whatsapp_proxy_jabber_stream_errors_total", map[string]string{"condition": condition}, 1)
+}
+
+// IncrementConfigReloads counts a configuration reload attempt
+func (m *Metrics) IncrementConfigReloads(ok bool) {
+	result := "success"
+	if ok {
+		m.configReloadSuccess.Add(1)
+		m.configReloadTime.Store(time.Now().Unix())
+	} else {
+		m.configReloadFailure.Add(1)
+		result = "failure"
 	}
+	m.addCounter("whatsapp_proxy_config_reloads_total", map[string]string{"result": result}, 1)
 }
 
 // AddBytesSent adds to bytes sent counter
 func (m *Metrics) AddBytesSent(bytes uint64) {
 	m.bytesSent.Add(bytes)
+	m.addCounter("whatsapp_proxy_bytes_sent_total", nil, float64(bytes))
 }
 
 // AddBytesReceived adds to bytes received counter
 func (m *Metrics) AddBytesReceived(bytes uint64) {
 	m.bytesReceived.Add(bytes)
+	m.addCounter("whatsapp_proxy_bytes_received_total", nil, float64(bytes))
 }
 
 // IncrementErrors increments error counter
 func (m *Metrics) IncrementErrors() {
 	m.errorsTotal.Add(1)
+	m.addCounter("whatsapp_proxy_errors_total", nil, 1)
+}
+
+// IncrementTLSHandshakeFailures increments the failed TLS handshake counter
+func (m *Metrics) IncrementTLSHandshakeFailures() {
+	m.tlsHandshakeFailures.Add(1)
+	m.addCounter("whatsapp_proxy_tls_handshake_failures_total", nil, 1)
+}
+
+// IncrementClientIdentity counts a connection authenticated as identity
+func (m *Metrics) IncrementClientIdentity(identity string) {
+	label := identityLabel(identity)
+
+	m.identityMutex.Lock()
+	if _, ok := m.identities[label]; !ok && len(m.identities) >= maxIdentityLabels {
+		label = "other"
+	}
+	m.identities[label]++
+	m.identityMutex.Unlock()
+	m.addCounter("whatsapp_proxy_client_identity_connections_total", map[string]string{"identity": label}, 1)
+}
+
+// addCounter passes a counter update to the sinks
+func (m *Metrics) addCounter(name string, labels map[string]string, delta float64) {
+	for _, sink := range m.sinks {
+		sink.AddCounter(name, labels, delta)
+	}
+}
+
+// addGauge passes a gauge update to the sinks
+func (m *Metrics) addGauge(name string, delta float64) {
+	for _, sink := range m.sinks {
+		sink.AddGauge(name, nil, delta)
+	}
 }
 
 // GetConnectionsTotal returns total connections count
@@ -120,14 +243,59 @@ func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "whatsapp_proxy_connections_failed %d\n", m.connectionsFailed.Load())
 	fmt.Fprintf(w, "\n")
 
+	fmt.Fprintf(w, "# HELP whatsapp_proxy_accepts_throttled_total Accepts delayed by the accept rate limit\n")
+	fmt.Fprintf(w, "# TYPE whatsapp_proxy_accepts_throttled_total counter\n")
+	fmt.Fprintf(w, "whatsapp_proxy_accepts_throttled_total %d\n", m.acceptsThrottled.Load())
+	fmt.Fprintf(w, "\n")
+
 	fmt.Fprintf(w, "# HELP whatsapp_proxy_protocol_connections Connections by protocol\n")
 	fmt.Fprintf(w, "# TYPE whatsapp_proxy_protocol_connections counter\n")
-	fmt.Fprintf(w, "whatsapp_proxy_protocol_connections{protocol=\"http\"} %d\n", m.httpConnections.Load())
-	fmt.Fprintf(w, "whatsapp_proxy_protocol_connections{protocol=\"https\"} %d\n", m.httpsConnections.Load())
-	fmt.Fprintf(w, "whatsapp_proxy_protocol_connections{protocol=\"jabber\"} %d\n", m.jabberConnections.Load())
-	fmt.Fprintf(w, "whatsapp_proxy_protocol_connections{protocol=\"unknown\"} %d\n", m.unknownConnections.Load())
+	m.protocolMutex.Lock()
+	protocols := make(map[string]uint64, len(m.protocols))
+	for proto, count := range m.protocols {
+		protocols[strings.ToLower(proto.String())] += count
+	}
+	m.protocolMutex.Unlock()
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "whatsapp_proxy_protocol_connections{protocol=%q} %d\n", name, protocols[name])
+	}
+	fmt.Fprintf(w, "\n")
+
+	fmt.Fprintf(w, "# HELP whatsapp_proxy_fallback_connections_total Unrecognized connections by fallback action\n")
+	fmt.Fprintf(w, "# TYPE whatsapp_proxy_fallback_connections_total counter\n")
+	m.fallbackMutex.Lock()
+	actions := make([]string, 0, len(m.fallbacks))
+	for action := range m.fallbacks {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		fmt.Fprintf(w, "whatsapp_proxy_fallback_connections_total{action=%q} %d\n", action, m.fallbacks[action])
+	}
+	m.fallbackMutex.Unlock()
 	fmt.Fprintf(w, "\n")
 
+	m.streamErrorMutex.Lock()
+	conditions := make([]string, 0, len(m.streamErrors))
+	for condition := range m.streamErrors {
+		conditions = append(conditions, condition)
+	}
+	sort.Strings(conditions)
+	if len(conditions) > 0 {
+		fmt.Fprintf(w, "# HELP whatsapp_proxy_jabber_stream_errors_total Jabber stream errors sent to clients by condition\n")
+		fmt.Fprintf(w, "# TYPE whatsapp_proxy_jabber_stream_errors_total counter\n")
+		for _, condition := range conditions {
+			fmt.Fprintf(w, "whatsapp_proxy_jabber_stream_errors_total{condition=%q} %d\n", condition, m.streamErrors[condition])
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	m.streamErrorMutex.Unlock()
+
 	fmt.Fprintf(w, "# HELP whatsapp_proxy_bytes_sent_total Total bytes sent\n")
 	fmt.Fprintf(w, "# TYPE whatsapp_proxy_bytes_sent_total counter\n")
 	fmt.Fprintf(w, "whatsapp_proxy_bytes_sent_total %d\n", m.bytesSent.Load())
@@ -143,6 +311,102 @@ func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "whatsapp_proxy_errors_total %d\n", m.errorsTotal.Load())
 	fmt.Fprintf(w, "\n")
 
+	fmt.Fprintf(w, "# HELP whatsapp_proxy_tls_handshake_failures_total Failed handshakes of terminated TLS connections\n")
+	fmt.Fprintf(w, "# TYPE whatsapp_proxy_tls_handshake_failures_total counter\n")
+	fmt.Fprintf(w, "whatsapp_proxy_tls_handshake_failures_total %d\n", m.tlsHandshakeFailures.Load())
+	fmt.Fprintf(w, "\n")
+
+	m.identityMutex.Lock()
+	identities := make([]string, 0, len(m.identities))
+	for identity := range m.identities {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+	if len(identities) > 0 {
+		fmt.Fprintf(w, "# HELP whatsapp_proxy_client_identity_connections_total Terminated TLS connections by client certificate identity\n")
+		fmt.Fprintf(w, "# TYPE whatsapp_proxy_client_identity_connections_total counter\n")
+		for _, identity := range identities {
+			fmt.Fprintf(w, "whatsapp_proxy_client_identity_connections_total{identity=%q} %d\n", identity, m.identities[identity])
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	m.identityMutex.Unlock()
+
+	if m.certificates != nil {
+		status := m.certificates()
+		lastOK := 0
+		if status.LastLoadOK {
+			lastOK = 1
+		}
+
+		if !status.NotAfter.IsZero() {
+			fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_expiry_timestamp_seconds Expiry of the active certificate\n")
+			fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_expiry_timestamp_seconds gauge\n")
+			fmt.Fprintf(w, "whatsapp_proxy_certificate_expiry_timestamp_seconds %d\n", status.NotAfter.Unix())
+			fmt.Fprintf(w, "\n")
+		}
+
+		if len(status.Certificates) > 0 {
+			fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_not_after_timestamp_seconds Expiry of each served certificate\n")
+			fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_not_after_timestamp_seconds gauge\n")
+			for _, info := range status.Certificates {
+				fmt.Fprintf(w, "whatsapp_proxy_certificate_not_after_timestamp_seconds{certificate=%q,source=%q} %d\n", info.Name, info.Source, info.NotAfter.Unix())
+			}
+			fmt.Fprintf(w, "\n")
+
+			fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_days_remaining Days until each served certificate expires\n")
+			fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_days_remaining gauge\n")
+			for _, info := range status.Certificates {
+				fmt.Fprintf(w, "whatsapp_proxy_certificate_days_remaining{certificate=%q,source=%q} %.2f\n", info.Name, info.Source, time.Until(info.NotAfter).Hours()/24)
+			}
+			fmt.Fprintf(w, "\n")
+		}
+
+		fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_rotations_total Certificate rotations by result\n")
+		fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_rotations_total counter\n")
+		fmt.Fprintf(w, "whatsapp_proxy_certificate_rotations_total{result=\"success\"} %d\n", status.RotationSuccess)
+		fmt.Fprintf(w, "whatsapp_proxy_certificate_rotations_total{result=\"failure\"} %d\n", status.RotationFailure)
+		fmt.Fprintf(w, "\n")
+
+		fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_selections_total TLS certificate selections by result\n")
+		fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_selections_total counter\n")
+		for _, result := range []string{ssl.SelectionExact, ssl.SelectionWildcard, ssl.SelectionOnDemand, ssl.SelectionDefault} {
+			fmt.Fprintf(w, "whatsapp_proxy_certificate_selections_total{result=%q} %d\n", result, status.Selections[result])
+		}
+		fmt.Fprintf(w, "\n")
+
+		fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_loads_total Certificate file loads by result\n")
+		fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_loads_total counter\n")
+		fmt.Fprintf(w, "whatsapp_proxy_certificate_loads_total{result=\"success\"} %d\n", status.LoadSuccess)
+		fmt.Fprintf(w, "whatsapp_proxy_certificate_loads_total{result=\"failure\"} %d\n", status.LoadFailure)
+		fmt.Fprintf(w, "\n")
+
+		if !status.LastLoad.IsZero() {
+			fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_last_load_success Whether the last certificate file load succeeded\n")
+			fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_last_load_success gauge\n")
+			fmt.Fprintf(w, "whatsapp_proxy_certificate_last_load_success %d\n", lastOK)
+			fmt.Fprintf(w, "\n")
+
+			fmt.Fprintf(w, "# HELP whatsapp_proxy_certificate_last_load_timestamp_seconds Time of the last certificate file load\n")
+			fmt.Fprintf(w, "# TYPE whatsapp_proxy_certificate_last_load_timestamp_seconds gauge\n")
+			fmt.Fprintf(w, "whatsapp_proxy_certificate_last_load_timestamp_seconds %d\n", status.LastLoad.Unix())
+			fmt.Fprintf(w, "\n")
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP whatsapp_proxy_config_reloads_total Configuration reloads by result\n")
+	fmt.Fprintf(w, "# TYPE whatsapp_proxy_config_reloads_total counter\n")
+	fmt.Fprintf(w, "whatsapp_proxy_config_reloads_total{result=\"success\"} %d\n", m.configReloadSuccess.Load())
+	fmt.Fprintf(w, "whatsapp_proxy_config_reloads_total{result=\"failure\"} %d\n", m.configReloadFailure.Load())
+	fmt.Fprintf(w, "\n")
+
+	if last := m.configReloadTime.Load(); last > 0 {
+		fmt.Fprintf(w, "# HELP whatsapp_proxy_config_last_reload_success_timestamp_seconds Time of the last successful configuration reload\n")
+		fmt.Fprintf(w, "# TYPE whatsapp_proxy_config_last_reload_success_timestamp_seconds gauge\n")
+		fmt.Fprintf(w, "whatsapp_proxy_config_last_reload_success_timestamp_seconds %d\n", last)
+		fmt.Fprintf(w, "\n")
+	}
+
 	fmt.Fprintf(w, "# HELP whatsapp_proxy_uptime_seconds Server uptime in seconds\n")
 	fmt.Fprintf(w, "# TYPE whatsapp_proxy_uptime_seconds gauge\n")
 	fmt.Fprintf(w, "whatsapp_proxy_uptime_seconds %.0f\n", m.GetUptime().Seconds())
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/sockopt"
+)
+
+// Option configures a Server beyond its config file settings
+type Option func(*Server)
+
+// Dialer opens upstream connections
+// *net.Dialer implements it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Logger receives the server's log lines, each starting with a level such
+// as "[INFO]"
+// *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ConnHook observes client connections and may refuse them
+// Hooks are called from the connection's goroutine and must be safe for
+// concurrent use.
+type ConnHook interface {
+	// OnAccept is called for every accepted connection before its protocol
+	// is detected; an error closes the connection
+	OnAccept(info ConnInfo) error
+
+	// OnUpstream is called before the upstream target is dialed; an error
+	// refuses the connection as if the target were unreachable
+	OnUpstream(info ConnInfo, target string) error
+
+	// OnClose is called when the connection has ended, with its final
+	// byte counts
+	OnClose(info ConnInfo)
+}
+
+// ConnHookFuncs implements ConnHook with optional functions; a nil function
+// accepts or ignores the event
+type ConnHookFuncs struct {
+	Accept   func(info ConnInfo) error
+	Upstream func(info ConnInfo, target string) error
+	Close    func(info ConnInfo)
+}
+
+// OnAccept calls Accept if set
+func (h ConnHookFuncs) OnAccept(info ConnInfo) error {
+	if h.Accept == nil {
+		return nil
+	}
+	return h.Accept(info)
+}
+
+// OnUpstream calls Upstream if set
+func (h ConnHookFuncs) OnUpstream(info ConnInfo, target string) error {
+	if h.Upstream == nil {
+		return nil
+	}
+	return h.Upstream(info, target)
+}
+
+// OnClose calls Close if set
+func (h ConnHookFuncs) OnClose(info ConnInfo) {
+	if h.Close != nil {
+		h.Close(info)
+	}
+}
+
+// MetricsSink receives metric updates as they happen, for export to a
+// monitoring system other than the built-in metrics endpoint
+// Names and labels are those of the metrics endpoint, e.g.
+// "whatsapp_proxy_protocol_connections" with label protocol="http". Sinks
+// are called on the hot path and must be fast and safe for concurrent use.
+type MetricsSink interface {
+	// AddCounter adds delta to a counter
+	AddCounter(name string, labels map[string]string, delta float64)
+
+	// AddGauge adds delta, which may be negative, to a gauge
+	AddGauge(name string, labels map[string]string, delta float64)
+}
+
+// WithDialer makes the server open upstream connections with dialer: direct
+// connections, connections to the SOCKS5 proxy and to the fallback target
+func WithDialer(dialer Dialer) Option {
+	return func(s *Server) {
+		s.dialer = dialer
+	}
+}
+
+// WithLogger sends the server's log lines to logger instead of the standard
+// logger
+func WithLogger(logger Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithConnHook adds a connection hook; hooks run in the order added and
+// the first error refuses the connection
+func WithConnHook(hook ConnHook) Option {
+	return func(s *Server) {
+		s.hooks = append(s.hooks, hook)
+	}
+}
+
+// WithMetricsSink adds a sink receiving every metric update
+func WithMetricsSink(sink MetricsSink) Option {
+	return func(s *Server) {
+		s.metrics.sinks = append(s.metrics.sinks, sink)
+	}
+}
+
+// upstreamDialTimeout bounds connecting to an upstream target
+const upstreamDialTimeout = 30 * time.Second
+
+// dialDirect connects to address without SOCKS5
+func (s *Server) dialDirect(network, address string, timeout time.Duration) (net.Conn, error) {
+	return dialTCP(s.dialer, &s.Config().Upstream.TCP, s.warnSocketOption, network, address, timeout)
+}
+
+// dialTCP connects to address with dialer or, if it is nil, with the socket
+// options of tcp; report receives the options the system refuses
+func dialTCP(dialer Dialer, tcp *config.TCPConfig, report func(error), network, address string, timeout time.Duration) (net.Conn, error) {
+	if dialer == nil {
+		d := net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: tcp.KeepAlive,
+			Control:   sockopt.Control(tcp.SocketOptions(), false, report),
+		}
+		conn, err := d.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		tuneConn(conn, tcp)
+		return conn, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dialer.DialContext(ctx, network, address)
+}
+
+// forwardDialer connects the SOCKS5 client to its proxy like dialDirect
+type forwardDialer struct {
+	dialer  Dialer
+	report  func(error)
+	timeout time.Duration
+	tcp     *config.TCPConfig
+}
+
+// Dial implements proxy.Dialer
+func (d forwardDialer) Dial(network, address string) (net.Conn, error) {
+	return dialTCP(d.dialer, d.tcp, d.report, network, address, d.timeout)
+}
+
+// checkAccept runs the accept hooks for a new connection
+func (s *Server) checkAccept(tc *trackedConn) error {
+	for _, hook := range s.hooks {
+		if err := hook.OnAccept(tc.info()); err != nil {
+			return fmt.Errorf("connection refused by hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkUpstream runs the upstream hooks before target is dialed
+func (s *Server) checkUpstream(tc *trackedConn, target string) error {
+	for _, hook := range s.hooks {
+		if err := hook.OnUpstream(tc.info(), target); err != nil {
+			return fmt.Errorf("connection to %s refused by hook: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// notifyClose runs the close hooks for an ended connection
+func (s *Server) notifyClose(tc *trackedConn) {
+	if len(s.hooks) == 0 {
+		return
+	}
+	info := tc.info()
+	for _, hook := range s.hooks {
+		hook.OnClose(info)
+	}
+}
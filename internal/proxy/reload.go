@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/socks5"
+)
+
+// restartKeys are settings that only take effect after a restart, since
+// they describe sockets that are already open
+var restartKeys = []string{"server.port", "server.bind_addr", "server.unix_socket", "server.tcp", "server.acceptors", "metrics", "admin.enabled"}
+
+// ReloadResult describes the outcome of a configuration reload
+type ReloadResult struct {
+	// Applied changes took effect immediately
+	Applied []config.Change
+
+	// Pending changes need a restart to take effect; their running values
+	// are kept until then
+	Pending []config.Change
+}
+
+// Reload applies a new configuration to the running server
+// Upstreams, routing and policy, log level, limits and certificates change
+// live; listener addresses are reported as pending. If cfg is invalid or any
+// part of it cannot be set up, the running configuration is left untouched.
+func (s *Server) Reload(cfg *config.Config) (*ReloadResult, error) {
+	result, err := s.reload(cfg)
+	s.metrics.IncrementConfigReloads(err == nil)
+	return result, err
+}
+
+func (s *Server) reload(cfg *config.Config) (*ReloadResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.state()
+	result := &ReloadResult{}
+	for _, change := range config.Diff(current.config, cfg) {
+		if changeUnder(change, restartKeys...) {
+			result.Pending = append(result.Pending, change)
+		} else {
+			result.Applied = append(result.Applied, change)
+		}
+	}
+	for _, change := range result.Pending {
+		s.logger.Printf("[WARN] Config reload: %s requires a restart to take effect", change)
+	}
+	if len(result.Applied) == 0 {
+		s.logger.Printf("[INFO] Config reload: no changes to apply")
+		return result, nil
+	}
+
+	// Settings that need a restart keep their running values
+	next := *cfg
+	next.Server.Port = current.config.Server.Port
+	next.Server.BindAddr = current.config.Server.BindAddr
+	next.Server.UnixSocket = current.config.Server.UnixSocket
+	next.Server.TCP = current.config.Server.TCP
+	next.Server.Acceptors = current.config.Server.Acceptors
+	next.Metrics = current.config.Metrics
+	next.Admin.Enabled = current.config.Admin.Enabled
+
+	// Certificate settings take effect with a new certificate manager; the
+	// running one is kept if the new one cannot be set up. Client routes
+	// are read per connection.
+	sslManager := current.sslManager
+	for _, change := range result.Applied {
+		if changeUnder(change, "ssl") && change.Key != "ssl.expiry_warning_days" && !changeUnder(change, "ssl.client_auth.routes") {
+			sslManager = nil
+			break
+		}
+	}
+	st, err := newState(&next, sslManager)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamChanged := false
+	var upstream *socks5.Client
+	for _, change := range result.Applied {
+		upstreamChanged = upstreamChanged || changeUnder(change, "socks5", "upstream")
+	}
+	if upstreamChanged && next.SOCKS5.Enabled {
+		upstream, err = s.newSOCKS5Client(&next)
+		if err != nil {
+			if st.sslManager != current.sslManager {
+				st.sslManager.Close()
+			}
+			return nil, err
+		}
+	}
+
+	// Everything is set up; switch over
+	for _, change := range result.Applied {
+		if change.Key == "logging.level" {
+			s.SetLogLevel(next.Logging.Level)
+		}
+	}
+	if upstreamChanged {
+		s.SetUpstream(upstream)
+	}
+	s.current.Store(st)
+	if st.sslManager != current.sslManager {
+		current.sslManager.Close()
+	}
+
+	for _, change := range result.Applied {
+		s.logger.Printf("[INFO] Config reload: applied %s", change)
+	}
+	return result, nil
+}
+
+// changeUnder reports whether change is to one of keys or a setting below
+// one of them
+func changeUnder(change config.Change, keys ...string) bool {
+	for _, key := range keys {
+		if change.Key == key || strings.HasPrefix(change.Key, key+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+func TestReload(t *testing.T) {
+	cfg := config.Default()
+	cfg.SSL.CacheDir = t.TempDir()
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { server.state().sslManager.Close() }()
+
+	// Live changes apply, listener changes are reported and kept
+	next := *cfg
+	next.Logging.Level = "debug"
+	next.Jabber.DefaultTarget = "chat.example.com:5222"
+	next.Server.Port = cfg.Server.Port + 1
+
+	result, err := server.Reload(&next)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(result.Applied) != 2 || len(result.Pending) != 1 || result.Pending[0].Key != "server.port" {
+		t.Errorf("Reload() applied %v, pending %v", result.Applied, result.Pending)
+	}
+	if got := server.Config(); got.Jabber.DefaultTarget != next.Jabber.DefaultTarget || got.Server.Port != cfg.Server.Port {
+		t.Errorf("Config() = target %q port %d after reload", got.Jabber.DefaultTarget, got.Server.Port)
+	}
+	if !server.logLevelEnabled(levelDebug) {
+		t.Error("log level not applied")
+	}
+
+	// An invalid configuration leaves the running one untouched
+	running := server.Config()
+	invalid := *server.Config()
+	invalid.Jabber.DefaultTarget = "not a target"
+	if _, err := server.Reload(&invalid); err == nil {
+		t.Error("Reload() accepted an invalid configuration")
+	}
+	if server.Config() != running {
+		t.Error("invalid reload replaced the running configuration")
+	}
+
+	// Certificate changes take effect with a new certificate manager
+	manager := server.state().sslManager
+	certs := *server.Config()
+	certs.SSL.ValidityDays = 30
+	if _, err := server.Reload(&certs); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if server.state().sslManager == manager {
+		t.Error("certificate manager not replaced after ssl change")
+	}
+
+	if got := server.metrics.configReloadSuccess.Load(); got != 2 {
+		t.Errorf("successful reloads = %d, want 2", got)
+	}
+	if got := server.metrics.configReloadFailure.Load(); got != 1 {
+		t.Errorf("failed reloads = %d, want 1", got)
+	}
+}
+
+func TestReloadConnectionLimits(t *testing.T) {
+	// Echo target reached through the fallback
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	// Reload validates the port, so the server gets its listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Server.Fallback = config.FallbackConfig{Action: fallbackForward, Target: echo.Addr().String()}
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = t.TempDir()
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := server.StartWithListeners(listener, nil); err != nil {
+		t.Fatalf("StartWithListeners() error = %v", err)
+	}
+	defer server.Shutdown(context.Background())
+
+	next := *cfg
+	next.Server.MaxConnections = 1
+	next.Server.IdleTimeout = 300 * time.Millisecond
+	result, err := server.Reload(&next)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(result.Applied) != 2 || len(result.Pending) != 0 {
+		t.Errorf("Reload() applied %v, pending %v", result.Applied, result.Pending)
+	}
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("hello"))
+		return conn
+	}
+
+	first := dial()
+	defer first.Close()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(first, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("relayed reply = %q, %v", buf, err)
+	}
+
+	// A second connection is over the new limit
+	second := dial()
+	defer second.Close()
+	if reply, _ := io.ReadAll(second); len(reply) != 0 {
+		t.Errorf("connection over the limit was relayed: %q", reply)
+	}
+
+	// The first one is closed once idle for the new timeout
+	start := time.Now()
+	if _, err := first.Read(buf); err != io.EOF {
+		t.Errorf("idle connection read error = %v, want EOF", err)
+	}
+	if idle := time.Since(start); idle < 200*time.Millisecond {
+		t.Errorf("connection closed after %v idle, want about 300ms", idle)
+	}
+}
@@ -2,189 +2,746 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/sockopt"
 	"github.com/RevEngine3r/whatsapp-proxy-go/internal/socks5"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/ssl"
 )
 
 // Server represents the proxy server
 type Server struct {
-	config       *config.Config
-	listener     net.Listener
-	socks5Client *socks5.Client
-	metrics      *Metrics
-	metricsServer *http.Server
-	wg           sync.WaitGroup
-	shutdown     chan struct{}
+	current         atomic.Pointer[state]
+	reloadMu        sync.Mutex
+	listener        net.Listener
+	listenerMu      sync.Mutex
+	metricsListener net.Listener
+	socks5Client    *socks5.Client
+	upstreamMu      sync.RWMutex
+	metrics         *Metrics
+	metricsServer   *http.Server
+	conns           *connRegistry
+	logLevel        atomic.Int32
+	draining        atomic.Bool
+	wg              sync.WaitGroup
+	shutdown        chan struct{}
+	shutdownOnce    sync.Once
+
+	// external is set when serving a listener passed to Serve, which
+	// cannot be reopened after a drain
+	external atomic.Bool
+
+	// extraListeners are the additional SO_REUSEPORT listeners opened for
+	// server.acceptors, each with its own accept loop; guarded by listenerMu
+	extraListeners []net.Listener
+
+	// acceptLimiter enforces server.accept_rate across the accept loops
+	acceptLimiter acceptLimiter
+
+	// socketPath is the Unix socket file this server created, removed at
+	// shutdown unless the listener was handed over; guarded by listenerMu
+	socketPath string
+
+	// acceptLoops counts running accept loops; acceptFailingSince is when
+	// the current streak of accept errors began, zero if there is none
+	acceptLoops        atomic.Int32
+	acceptFailingSince atomic.Int64
+
+	// socketOptionWarnings holds refused socket options already logged
+	socketOptionWarnings sync.Map
+
+	// Injected by options
+	dialer Dialer
+	logger Logger
+	hooks  []ConnHook
 }
 
 // New creates a new proxy server
-func New(cfg *config.Config) (*Server, error) {
+func New(cfg *config.Config, opts ...Option) (*Server, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
 	s := &Server{
-		config:   cfg,
 		metrics:  NewMetrics(),
+		conns:    newConnRegistry(),
 		shutdown: make(chan struct{}),
+		logger:   log.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.SetLogLevel(cfg.Logging.Level); err != nil {
+		return nil, err
 	}
 
 	// Create SOCKS5 client if enabled
 	if cfg.SOCKS5.Enabled {
-		socks5Cfg := &socks5.Config{
-			ProxyAddr: cfg.SOCKS5.GetAddress(),
-			Username:  cfg.SOCKS5.Username,
-			Password:  cfg.SOCKS5.Password,
-			Timeout:   cfg.SOCKS5.Timeout,
-		}
-
-		client, err := socks5.NewClient(socks5Cfg)
+		client, err := s.newSOCKS5Client(cfg)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create SOCKS5 client: %w", err)
+			return nil, err
 		}
 
 		s.socks5Client = client
-		log.Printf("[INFO] SOCKS5 proxy enabled: %s", cfg.SOCKS5.GetAddress())
+		s.logger.Printf("[INFO] SOCKS5 proxy enabled: %s", cfg.SOCKS5.GetAddress())
 
 		// Test SOCKS5 connection
 		if err := client.Test(); err != nil {
-			log.Printf("[WARN] SOCKS5 proxy test failed: %v", err)
+			s.logger.Printf("[WARN] SOCKS5 proxy test failed: %v", err)
 		}
 	}
 
+	st, err := newState(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(st)
+	s.metrics.SetCertificateSource(func() ssl.Status {
+		return s.state().sslManager.Status()
+	})
+	if st.tlsConfig != nil {
+		s.logger.Printf("[INFO] TLS client authentication enabled (%s)", cfg.SSL.ClientAuth.Mode)
+	}
+
 	return s, nil
 }
 
+// SSLConfig returns the certificate manager configuration for cfg
+func SSLConfig(cfg *config.Config) *ssl.Config {
+	certificates := make([]ssl.CertificateEntry, len(cfg.SSL.Certificates))
+	for i, entry := range cfg.SSL.Certificates {
+		certificates[i] = ssl.CertificateEntry{
+			Names:        entry.Names,
+			CertFile:     entry.CertFile,
+			KeyFile:      entry.KeyFile,
+			AutoGenerate: entry.AutoGenerate,
+		}
+	}
+
+	return &ssl.Config{
+		AutoGenerate:  cfg.SSL.AutoGenerate,
+		CertFile:      cfg.SSL.CertFile,
+		KeyFile:       cfg.SSL.KeyFile,
+		DNSNames:      cfg.SSL.DNSNames,
+		IPAddresses:   cfg.SSL.GetIPAddresses(),
+		ValidityDays:  cfg.SSL.ValidityDays,
+		CacheDir:      cfg.SSL.CacheDir,
+		WatchInterval: cfg.SSL.WatchInterval,
+		Certificates:  certificates,
+		CA: ssl.CAConfig{
+			Enabled:          cfg.SSL.CA.Enabled,
+			Dir:              cfg.SSL.CA.Dir,
+			Passphrase:       cfg.SSL.CA.Passphrase,
+			ValidityDays:     cfg.SSL.CA.ValidityDays,
+			LeafValidityDays: cfg.SSL.CA.LeafValidityDays,
+			OnDemand:         cfg.SSL.CA.OnDemand,
+		},
+		ACME: ssl.ACMEConfig{
+			Enabled:         cfg.SSL.ACME.Enabled,
+			DirectoryURL:    cfg.SSL.ACME.DirectoryURL,
+			Email:           cfg.SSL.ACME.Email,
+			Domains:         cfg.SSL.ACME.Domains,
+			AcceptTOS:       cfg.SSL.ACME.AcceptTOS,
+			Challenges:      cfg.SSL.ACME.Challenges,
+			RenewBeforeDays: cfg.SSL.ACME.RenewBeforeDays,
+			DirectoryCAFile: cfg.SSL.ACME.DirectoryCAFile,
+		},
+		KeyType: cfg.SSL.KeyType,
+		TLS: ssl.TLSPolicy{
+			MinVersion:   cfg.SSL.TLS.MinVersion,
+			MaxVersion:   cfg.SSL.TLS.MaxVersion,
+			CipherSuites: cfg.SSL.TLS.CipherSuites,
+			Curves:       cfg.SSL.TLS.Curves,
+			ALPN:         cfg.SSL.TLS.ALPN,
+			SessionTickets: ssl.SessionTicketConfig{
+				Disabled:         !cfg.SSL.TLS.SessionTickets.Enabled,
+				RotationInterval: cfg.SSL.TLS.SessionTickets.RotationInterval,
+				KeyFile:          cfg.SSL.TLS.SessionTickets.KeyFile,
+			},
+		},
+		ClientAuth: ssl.ClientAuthConfig{
+			Mode:     cfg.SSL.ClientAuth.Mode,
+			CAFiles:  cfg.SSL.ClientAuth.CAFiles,
+			CRLFiles: cfg.SSL.ClientAuth.CRLFiles,
+			Identity: cfg.SSL.ClientAuth.Identity,
+		},
+	}
+}
+
 // Start starts the proxy server
 func (s *Server) Start() error {
-	// Create TCP listener
-	listener, err := net.Listen("tcp", s.config.Server.GetAddress())
-	if err != nil {
-		return fmt.Errorf("failed to create listener: %w", err)
+	return s.StartWithListeners(nil, nil)
+}
+
+// StartWithListeners starts the proxy server on pre-opened listeners, for
+// example sockets inherited from a parent process during a restart
+// A nil listener is opened from the configured address instead. acceptors
+// are additional SO_REUSEPORT listeners on the proxy address, as returned
+// by Acceptors; they are used for server.acceptors before binding new ones.
+func (s *Server) StartWithListeners(proxyListener, metricsListener net.Listener, acceptors ...net.Listener) error {
+	if proxyListener == nil {
+		listener, err := s.openListener()
+		if err != nil {
+			return err
+		}
+		proxyListener = listener
 	}
-	s.listener = listener
+	s.serve(proxyListener, acceptors)
 
-	log.Printf("[INFO] Proxy server listening on %s", s.config.Server.GetAddress())
+	s.logger.Printf("[INFO] Proxy server listening on %s", proxyListener.Addr())
 
 	// Start metrics server if enabled
-	if s.config.Metrics.Enabled {
-		if err := s.startMetricsServer(); err != nil {
-			log.Printf("[WARN] Failed to start metrics server: %v", err)
+	if s.Config().Metrics.Enabled {
+		if err := s.startMetricsServer(metricsListener); err != nil {
+			s.logger.Printf("[WARN] Failed to start metrics server: %v", err)
 		}
+	} else if metricsListener != nil {
+		metricsListener.Close()
 	}
 
-	// Accept connections
-	s.wg.Add(1)
-	go s.acceptLoop()
+	return nil
+}
+
+// Serve accepts connections on listener until ctx is canceled, then shuts
+// down gracefully within the configured shutdown timeout
+// Any net.Listener works, e.g. TCP or Unix sockets or an in-memory
+// listener. The metrics endpoint and additional acceptors are not opened;
+// mount Handler where needed.
+// It returns nil once Shutdown has been called from elsewhere.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if s.isShuttingDown() {
+		return fmt.Errorf("server is shut down")
+	}
+	s.external.Store(true)
+	return s.serveUntil(ctx, listener)
+}
+
+// ListenAndServe opens the configured listener, a TCP address or Unix
+// socket, and serves it like Serve
+// Unlike with Serve, drain mode can be left with Resume.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.isShuttingDown() {
+		return fmt.Errorf("server is shut down")
+	}
+	listener, err := s.openListener()
+	if err != nil {
+		return err
+	}
+	return s.serveUntil(ctx, listener)
+}
+
+// serveUntil serves listener until ctx is canceled or Shutdown is called
+func (s *Server) serveUntil(ctx context.Context, listener net.Listener) error {
+	s.serve(listener, nil)
+	s.logger.Printf("[INFO] Proxy server listening on %s", listener.Addr())
+
+	select {
+	case <-ctx.Done():
+	case <-s.shutdown:
+		return nil
+	}
+
+	shutdownCtx := context.Background()
+	if timeout := s.Config().Server.ShutdownTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+		defer cancel()
+	}
+	return s.Shutdown(shutdownCtx)
+}
 
+// Listeners returns the active proxy and metrics listeners
+// Either may be nil (draining, or metrics disabled)
+func (s *Server) Listeners() (proxyListener, metricsListener net.Listener) {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	return s.listener, s.metricsListener
+}
+
+// Acceptors returns the additional SO_REUSEPORT listeners opened for
+// server.acceptors, to be handed over along with the proxy listener
+func (s *Server) Acceptors() []net.Listener {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	return append([]net.Listener(nil), s.extraListeners...)
+}
+
+// openListener opens the configured proxy listener, remembering a Unix
+// socket file to remove at shutdown
+func (s *Server) openListener() (net.Listener, error) {
+	cfg := s.Config().Server
+	if cfg.Acceptors > 1 {
+		// The other acceptors can only bind next to a SO_REUSEPORT socket
+		cfg.TCP.ReusePort = true
+	}
+	listener, err := listenConfigured(&cfg, s.warnSocketOption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create listener: %w", err)
+	}
+
+	s.listenerMu.Lock()
+	s.socketPath = cfg.UnixSocket.Path
+	s.listenerMu.Unlock()
+	return listener, nil
+}
+
+// listen opens the proxy listener and starts accepting connections
+func (s *Server) listen() error {
+	listener, err := s.openListener()
+	if err != nil {
+		return err
+	}
+
+	s.serve(listener, nil)
 	return nil
 }
 
-// acceptLoop accepts incoming connections
-func (s *Server) acceptLoop() {
+// ReleaseSocket keeps the Unix socket file at shutdown, once the listener
+// has been handed over to another process
+func (s *Server) ReleaseSocket() {
+	s.listenerMu.Lock()
+	s.socketPath = ""
+	s.listenerMu.Unlock()
+}
+
+// serve starts accepting connections on the listener and, unless it was
+// passed to Serve, on the additional acceptors, adopting inherited ones
+func (s *Server) serve(listener net.Listener, inherited []net.Listener) {
+	s.listenerMu.Lock()
+	s.listener = listener
+	s.listenerMu.Unlock()
+
+	s.startAcceptLoop(listener)
+	if !s.external.Load() {
+		s.openAcceptors(listener, inherited)
+	}
+}
+
+// startAcceptLoop accepts connections on listener in a new goroutine
+func (s *Server) startAcceptLoop(listener net.Listener) {
+	s.acceptLoops.Add(1)
+	s.wg.Add(1)
+	go s.acceptLoop(listener)
+}
+
+// openAcceptors adds server.acceptors - 1 more listeners on the address of
+// listener with SO_REUSEPORT, so the kernel spreads new connections over
+// several accept loops
+// The inherited listeners are used first, keeping the connections queued on
+// them during a restart; the rest are bound. listener must have SO_REUSEPORT
+// set; if binding fails, the acceptors opened so far are kept.
+func (s *Server) openAcceptors(listener net.Listener, inherited []net.Listener) {
+	cfg := s.Config().Server
+	acceptors := max(cfg.Acceptors, 1)
+	addr, ok := listener.Addr().(*net.TCPAddr)
+	if acceptors > 1 && !ok {
+		s.logger.Printf("[WARN] Acceptors need a TCP listener, accepting on %s only", listener.Addr())
+		acceptors = 1
+	}
+
+	// Inherited listeners beyond the configured number are closed
+	adopt := min(len(inherited), acceptors-1)
+	for _, l := range inherited[adopt:] {
+		l.Close()
+	}
+	if acceptors == 1 {
+		return
+	}
+
+	for _, l := range inherited[:adopt] {
+		s.listenerMu.Lock()
+		s.extraListeners = append(s.extraListeners, l)
+		s.listenerMu.Unlock()
+		s.startAcceptLoop(l)
+	}
+
+	tcp := cfg.TCP
+	tcp.ReusePort = true
+	lc := net.ListenConfig{
+		KeepAlive: tcp.KeepAlive,
+		Control:   sockopt.Control(tcp.SocketOptions(), true, s.warnSocketOption),
+	}
+
+	opened := 1 + adopt
+	for ; opened < acceptors; opened++ {
+		l, err := lc.Listen(context.Background(), "tcp", addr.String())
+		if err != nil {
+			s.logger.Printf("[WARN] Cannot open more acceptors on %s: %v", addr, err)
+			break
+		}
+		s.listenerMu.Lock()
+		s.extraListeners = append(s.extraListeners, l)
+		s.listenerMu.Unlock()
+		s.startAcceptLoop(l)
+	}
+	s.logger.Printf("[INFO] Accepting on %s with %d SO_REUSEPORT listeners, %d inherited", addr, opened, adopt)
+}
+
+// closeListeners closes the proxy listeners; listenerMu must be held
+func (s *Server) closeListeners() {
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	for _, l := range s.extraListeners {
+		l.Close()
+	}
+	s.extraListeners = nil
+}
+
+// Accept error backoff bounds, as in net/http
+const (
+	acceptRetryMin = 5 * time.Millisecond
+	acceptRetryMax = time.Second
+)
+
+// acceptLoop accepts incoming connections until the listener is closed by
+// a drain or shutdown
+// Accept blocks without deadlines, so any net.Listener works. Other errors,
+// such as running out of file descriptors, are retried with backoff.
+func (s *Server) acceptLoop(listener net.Listener) {
 	defer s.wg.Done()
+	defer s.acceptLoops.Add(-1)
 
+	var delay time.Duration
 	for {
-		select {
-		case <-s.shutdown:
-			return
-		default:
-			// Set accept deadline to allow checking shutdown signal
-			s.listener.(*net.TCPListener).SetDeadline(time.Now().Add(1 * time.Second))
-
-			conn, err := s.listener.Accept()
-			if err != nil {
-				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-					// Timeout is expected, continue
-					continue
-				}
-				select {
-				case <-s.shutdown:
-					return
-				default:
-					log.Printf("[ERROR] Accept error: %v", err)
-					continue
-				}
+		cfg := &s.Config().Server
+		if wait := s.acceptLimiter.reserve(time.Now(), cfg.AcceptRate, cfg.AcceptBurst); wait > 0 {
+			// Leave connections in the kernel backlog until a token is free
+			s.metrics.IncrementAcceptsThrottled()
+			select {
+			case <-s.shutdown:
+				return
+			case <-time.After(wait):
 			}
+		}
 
-			// Handle connection in goroutine
-			s.wg.Add(1)
-			go func() {
-				defer s.wg.Done()
-				s.handleConnection(conn)
-			}()
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || s.isShuttingDown() || !s.isListener(listener) {
+				// Listener closed by drain or shutdown
+				s.acceptFailingSince.Store(0)
+				return
+			}
+
+			s.acceptFailingSince.CompareAndSwap(0, time.Now().UnixNano())
+			delay = min(max(2*delay, acceptRetryMin), acceptRetryMax)
+			s.logger.Printf("[ERROR] Accept error: %v; retrying in %s", err, delay)
+
+			select {
+			case <-s.shutdown:
+				return
+			case <-time.After(delay):
+			}
+			continue
 		}
+		delay = 0
+		s.acceptFailingSince.Store(0)
+		tuneConn(conn, &cfg.TCP)
+
+		// Handle connection in goroutine
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConnection(conn)
+		}()
 	}
 }
 
-// startMetricsServer starts the metrics HTTP server
-func (s *Server) startMetricsServer() error {
+// isListener reports whether listener is an active proxy listener
+func (s *Server) isListener(listener net.Listener) bool {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	if s.listener == listener {
+		return true
+	}
+	for _, l := range s.extraListeners {
+		if l == listener {
+			return true
+		}
+	}
+	return false
+}
+
+// Drain stops accepting new connections while keeping existing ones open
+func (s *Server) Drain() error {
+	if !s.draining.CompareAndSwap(false, true) {
+		return fmt.Errorf("server is already draining")
+	}
+
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	s.closeListeners()
+
+	s.logger.Printf("[INFO] Drain mode enabled, %d connections remain active", s.conns.count())
+	return nil
+}
+
+// Resume leaves drain mode and starts accepting connections again
+func (s *Server) Resume() error {
+	if s.isShuttingDown() {
+		return fmt.Errorf("server is shutting down")
+	}
+	if !s.draining.Load() {
+		return fmt.Errorf("server is not draining")
+	}
+	if s.external.Load() {
+		return fmt.Errorf("cannot resume: the listener passed to Serve was closed by the drain")
+	}
+
+	if err := s.listen(); err != nil {
+		return err
+	}
+	s.draining.Store(false)
+
+	proxyListener, _ := s.Listeners()
+	s.logger.Printf("[INFO] Drain mode disabled, accepting connections on %s", proxyListener.Addr())
+	return nil
+}
+
+// acceptLivenessTimeout is how long accepting may keep failing before the
+// server is considered unresponsive
+const acceptLivenessTimeout = 10 * time.Second
+
+// CheckLiveness reports whether the accept loop is still running and able
+// to accept connections
+// A draining or stopping server is considered alive.
+func (s *Server) CheckLiveness() error {
+	if s.isShuttingDown() || s.IsDraining() {
+		return nil
+	}
+
+	if s.acceptLoops.Load() == 0 {
+		return fmt.Errorf("accept loop not running")
+	}
+
+	if since := s.acceptFailingSince.Load(); since != 0 {
+		if d := time.Since(time.Unix(0, since)); d > acceptLivenessTimeout {
+			return fmt.Errorf("accept failing for %s", d.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// IsDraining returns true if the server is in drain mode
+func (s *Server) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// SetUpstream replaces the upstream SOCKS5 client for new connections
+// A nil client switches to direct connections
+func (s *Server) SetUpstream(client *socks5.Client) {
+	s.upstreamMu.Lock()
+	s.socks5Client = client
+	s.upstreamMu.Unlock()
+}
+
+// Upstream returns the upstream SOCKS5 proxy address, or "direct"
+func (s *Server) Upstream() string {
+	s.upstreamMu.RLock()
+	defer s.upstreamMu.RUnlock()
+
+	if s.socks5Client == nil {
+		return "direct"
+	}
+	return s.socks5Client.GetProxyAddr()
+}
+
+// Handler returns the handler of the metrics endpoint: /metrics, /health,
+// /certificates and, if enabled, /admin/
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", s.metrics)
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	mux.HandleFunc("/health", s.serveHealth)
+	mux.HandleFunc("/certificates", s.serveCertificates)
+
+	if s.Config().Admin.Enabled {
+		mux.Handle("/admin/", s.adminHandler())
+	}
+	return mux
+}
+
+// startMetricsServer starts the metrics HTTP server
+// If listener is nil, the configured metrics address is opened
+func (s *Server) startMetricsServer(listener net.Listener) error {
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", s.Config().Metrics.GetAddress())
+		if err != nil {
+			return fmt.Errorf("failed to create metrics listener: %w", err)
+		}
+	}
+
+	s.listenerMu.Lock()
+	s.metricsListener = listener
+	s.listenerMu.Unlock()
 
 	s.metricsServer = &http.Server{
-		Addr:    s.config.Metrics.GetAddress(),
-		Handler: mux,
+		Addr:    s.Config().Metrics.GetAddress(),
+		Handler: s.Handler(),
 	}
 
 	go func() {
-		log.Printf("[INFO] Metrics server listening on http://%s/metrics", s.config.Metrics.GetAddress())
-		if err := s.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("[ERROR] Metrics server error: %v", err)
+		s.logger.Printf("[INFO] Metrics server listening on http://%s/metrics", listener.Addr())
+		if err := s.metricsServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Printf("[ERROR] Metrics server error: %v", err)
 		}
 	}()
 
 	return nil
 }
 
-// Shutdown gracefully shuts down the server
-func (s *Server) Shutdown(ctx context.Context) error {
-	log.Println("[INFO] Shutting down proxy server...")
+// ShutdownError reports connections that were forcibly terminated because
+// they did not finish within the drain period
+type ShutdownError struct {
+	Clients    int
+	Upstreams  int
+	ByProtocol map[string]int
+}
 
-	// Signal shutdown
-	close(s.shutdown)
+// Error implements the error interface
+func (e *ShutdownError) Error() string {
+	protocols := make([]string, 0, len(e.ByProtocol))
+	for proto, count := range e.ByProtocol {
+		protocols = append(protocols, fmt.Sprintf("%s=%d", proto, count))
+	}
+	sort.Strings(protocols)
 
-	// Close listener
-	if s.listener != nil {
-		s.listener.Close()
+	return fmt.Sprintf("forcibly closed %d client and %d upstream connections after drain period (%s)",
+		e.Clients, e.Upstreams, strings.Join(protocols, ", "))
+}
+
+// Shutdown gracefully shuts down the server in phases:
+//  1. stop accepting new connections
+//  2. notify protocol handlers (HTTP responses get "Connection: close")
+//  3. wait for connections to finish within the drain period
+//  4. force-close every remaining client and upstream connection
+//
+// The drain period ends at the configured drain timeout or when ctx expires,
+// whichever comes first. If connections had to be terminated, a
+// *ShutdownError summarizing them is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	first := false
+	s.shutdownOnce.Do(func() { first = true })
+	if !first {
+		return fmt.Errorf("server is already shutting down")
 	}
+	s.logger.Printf("[INFO] Shutting down proxy server...")
 
-	// Shutdown metrics server
-	if s.metricsServer != nil {
-		if err := s.metricsServer.Shutdown(ctx); err != nil {
-			log.Printf("[WARN] Metrics server shutdown error: %v", err)
+	// Phase 1: stop accepting
+	close(s.shutdown)
+	s.draining.Store(true)
+
+	s.listenerMu.Lock()
+	s.closeListeners()
+	if s.socketPath != "" {
+		if err := os.Remove(s.socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Printf("[WARN] Failed to remove socket %s: %v", s.socketPath, err)
 		}
+		s.socketPath = ""
 	}
+	s.listenerMu.Unlock()
+
+	// Phase 2: notify protocol handlers
+	active := s.conns.count()
+	s.logger.Printf("[INFO] Stopped accepting connections, notifying %d active connections", active)
+	s.conns.notifyShutdown()
 
-	// Wait for all connections to finish with timeout
+	// Phase 3: wait for drain period
 	done := make(chan struct{})
 	go func() {
 		s.wg.Wait()
 		close(done)
 	}()
 
+	drainCtx := ctx
+	if s.Config().Server.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(ctx, s.Config().Server.DrainTimeout)
+		defer cancel()
+	}
+
+	var forced *ShutdownError
 	select {
 	case <-done:
-		log.Println("[INFO] All connections closed gracefully")
-	case <-ctx.Done():
-		log.Println("[WARN] Shutdown timeout, forcing close")
+		s.logger.Printf("[INFO] All connections closed gracefully")
+	case <-drainCtx.Done():
+		// Phase 4: force-close remaining connections
+		forced = s.conns.closeAll()
+		s.logger.Printf("[WARN] Drain period expired, %s", forced.Error())
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.logger.Printf("[WARN] Shutdown deadline reached before all handlers exited")
+		}
+	}
+
+	// Shutdown metrics server
+	if s.metricsServer != nil {
+		if err := s.metricsServer.Shutdown(ctx); err != nil {
+			s.logger.Printf("[WARN] Metrics server shutdown error: %v", err)
+			s.metricsServer.Close()
+		}
 	}
 
+	s.state().sslManager.Close()
+
+	if forced != nil && forced.Clients > 0 {
+		return forced
+	}
 	return nil
 }
 
+// isShuttingDown returns true once Shutdown has been called
+func (s *Server) isShuttingDown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
 // GetMetrics returns the server metrics
 func (s *Server) GetMetrics() *Metrics {
 	return s.metrics
 }
+
+// Connections returns a snapshot of all active client connections
+func (s *Server) Connections() []ConnInfo {
+	return s.conns.snapshot()
+}
+
+// KillConnection closes the client connection with the given ID
+func (s *Server) KillConnection(id uint64) error {
+	tc, ok := s.conns.get(id)
+	if !ok {
+		return fmt.Errorf("connection %d not found", id)
+	}
+	tc.forceClose()
+	return nil
+}
+
+// KillConnectionsFromIP closes all client connections from the given IP
+// and returns the number of connections closed
+func (s *Server) KillConnectionsFromIP(ip string) int {
+	conns := s.conns.byIP(ip)
+	for _, tc := range conns {
+		tc.forceClose()
+	}
+	return len(conns)
+}
@@ -1,7 +1,15 @@
 package proxy
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,4 +119,249 @@ func TestGetMetrics(t *testing.T) {
 	if metrics.GetConnectionsActive() != 0 {
 		t.Error("Initial active connections should be 0")
 	}
+
+	// Certificate expiry is reported from the SSL manager
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		"whatsapp_proxy_certificate_expiry_timestamp_seconds ",
+		`whatsapp_proxy_certificate_days_remaining{certificate="default",source="default"} `,
+		`whatsapp_proxy_certificate_rotations_total{result="success"} 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics do not include %s", want)
+		}
+	}
+}
+
+func TestClientIdentityMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.IncrementClientIdentity("device-1")
+	metrics.IncrementClientIdentity("device-1")
+	metrics.IncrementClientIdentity("")
+	metrics.IncrementTLSHandshakeFailures()
+
+	// Identities beyond the label limit are counted as "other"
+	for i := 0; i < maxIdentityLabels; i++ {
+		metrics.IncrementClientIdentity(fmt.Sprintf("bulk-%d", i))
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`whatsapp_proxy_client_identity_connections_total{identity="device-1"} 2`,
+		`whatsapp_proxy_client_identity_connections_total{identity="anonymous"} 1`,
+		`whatsapp_proxy_client_identity_connections_total{identity="other"} 2`,
+		"whatsapp_proxy_tls_handshake_failures_total 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not include %s", want)
+		}
+	}
+}
+
+func TestHealthCertificateExpiry(t *testing.T) {
+	tests := []struct {
+		name         string
+		validityDays int
+		warningDays  int
+		drain        bool
+		wantCode     int
+		wantState    string
+		wantExpiring bool
+	}{
+		{"healthy", 365, 7, false, http.StatusOK, "OK", false},
+		{"expiring", 5, 7, false, http.StatusOK, "DEGRADED", true},
+		{"warning disabled", 5, 0, false, http.StatusOK, "OK", false},
+		{"draining wins", 5, 7, true, http.StatusServiceUnavailable, "DRAINING", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.SSL.CacheDir = t.TempDir()
+			cfg.SSL.ValidityDays = tt.validityDays
+			cfg.SSL.ExpiryWarningDays = tt.warningDays
+			server, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer server.state().sslManager.Close()
+			if tt.drain {
+				server.draining.Store(true)
+			}
+
+			rec := httptest.NewRecorder()
+			server.serveHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != tt.wantCode || !strings.HasPrefix(rec.Body.String(), tt.wantState) {
+				t.Errorf("/health = %d %q, want %d %s", rec.Code, rec.Body.String(), tt.wantCode, tt.wantState)
+			}
+			if tt.wantState == "DEGRADED" && !strings.Contains(rec.Body.String(), "certificate default expires in") {
+				t.Errorf("/health does not name the expiring certificate: %q", rec.Body.String())
+			}
+
+			rec = httptest.NewRecorder()
+			server.serveCertificates(rec, httptest.NewRequest(http.MethodGet, "/certificates", nil))
+			var body struct {
+				Certificates []struct {
+					Name              string   `json:"name"`
+					Issuer            string   `json:"issuer"`
+					DNSNames          []string `json:"dns_names"`
+					SHA256Fingerprint string   `json:"sha256_fingerprint"`
+					Expiring          bool     `json:"expiring"`
+				} `json:"certificates"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("/certificates: %v", err)
+			}
+			if len(body.Certificates) != 1 {
+				t.Fatalf("/certificates listed %d certificates, want 1", len(body.Certificates))
+			}
+			cert := body.Certificates[0]
+			if cert.Name != "default" || cert.Issuer == "" || len(cert.DNSNames) == 0 || len(cert.SHA256Fingerprint) != 64 {
+				t.Errorf("unexpected certificate %+v", cert)
+			}
+			if cert.Expiring != tt.wantExpiring {
+				t.Errorf("expiring = %v, want %v", cert.Expiring, tt.wantExpiring)
+			}
+		})
+	}
+}
+
+func startTestServer(t *testing.T, drainTimeout time.Duration) *Server {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Server.BindAddr = "127.0.0.1"
+	cfg.Server.DrainTimeout = drainTimeout
+	cfg.Metrics.Enabled = false
+	cfg.SSL.CacheDir = t.TempDir()
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return server
+}
+
+func TestShutdownClosesIdleHTTPKeepAlive(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	server := startTestServer(t, 5*time.Second)
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	host := upstream.Listener.Addr().String()
+	fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n\r\n", host, host)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	resp.Body.Close()
+
+	// Connection is now an idle keep-alive; shutdown must close it gracefully
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown() waited %v for an idle keep-alive connection", elapsed)
+	}
+}
+
+func TestShutdownForceClosesLingeringConnections(t *testing.T) {
+	// Upstream that accepts and never closes
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			c, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	server := startTestServer(t, 200*time.Millisecond)
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	target := upstream.Addr().String()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT status = %d, want 200", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+	var forced *ShutdownError
+	if !errors.As(err, &forced) {
+		t.Fatalf("Shutdown() error = %v, want *ShutdownError", err)
+	}
+	if forced.Clients != 1 || forced.Upstreams != 1 {
+		t.Errorf("forced = %d clients, %d upstreams, want 1 and 1", forced.Clients, forced.Upstreams)
+	}
+
+	// The client side must observe the close
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("expected client connection to be closed")
+	}
+}
+
+func TestCheckLiveness(t *testing.T) {
+	cfg := config.Default()
+	cfg.SSL.CacheDir = t.TempDir()
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := server.CheckLiveness(); err == nil {
+		t.Error("CheckLiveness() should fail before the server is started")
+	}
+
+	server = startTestServer(t, time.Second)
+	defer server.Shutdown(context.Background())
+
+	if err := server.CheckLiveness(); err != nil {
+		t.Errorf("CheckLiveness() error = %v", err)
+	}
+
+	// Accept errors for longer than the timeout mean the server is stuck
+	server.acceptFailingSince.Store(time.Now().Add(-time.Minute).UnixNano())
+	if err := server.CheckLiveness(); err == nil {
+		t.Error("CheckLiveness() should fail while accepting keeps failing")
+	}
 }
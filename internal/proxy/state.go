@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/protocol"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/socks5"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/ssl"
+)
+
+// state is the running configuration and everything derived from it
+// It is replaced as a whole on reload, so each lookup sees either the old or
+// the new settings, never a mix
+type state struct {
+	config         *config.Config
+	sslManager     *ssl.Manager
+	tlsConfig      *tls.Config
+	detector       *protocol.Detector
+	unknownSamples *sampleLimiter
+}
+
+// newState builds the state for cfg, reusing sslManager if it is not nil
+func newState(cfg *config.Config, sslManager *ssl.Manager) (*state, error) {
+	if sslManager == nil {
+		var err error
+		sslManager, err = ssl.NewManager(SSLConfig(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SSL manager: %w", err)
+		}
+	}
+
+	st := &state{
+		config:         cfg,
+		sslManager:     sslManager,
+		detector:       protocol.NewDetector(protocol.DefaultRegistry(), cfg.Server.DetectPeekLimit, cfg.Server.DetectTimeout),
+		unknownSamples: newSampleLimiter(cfg.Server.Fallback.SampleRate, time.Minute),
+	}
+
+	// Client certificate authentication requires terminating TLS
+	if sslManager.ClientAuthEnabled() {
+		st.tlsConfig = sslManager.GetTLSConfig()
+	}
+	return st, nil
+}
+
+// state returns the current state
+func (s *Server) state() *state {
+	return s.current.Load()
+}
+
+// Config returns the running configuration
+func (s *Server) Config() *config.Config {
+	return s.state().config
+}
+
+// NewSOCKS5Client creates the upstream SOCKS5 client configured in cfg the
+// way the server does: the proxy is reached with the upstream.tcp socket
+// options, and report receives the options the system refuses
+func NewSOCKS5Client(cfg *config.Config, report func(error)) (*socks5.Client, error) {
+	return newSOCKS5Client(cfg, nil, report)
+}
+
+// newSOCKS5Client creates the upstream SOCKS5 client configured in cfg
+func (s *Server) newSOCKS5Client(cfg *config.Config) (*socks5.Client, error) {
+	return newSOCKS5Client(cfg, s.dialer, s.warnSocketOption)
+}
+
+// newSOCKS5Client creates the SOCKS5 client configured in cfg, reaching the
+// proxy through dialer if it is not nil
+func newSOCKS5Client(cfg *config.Config, dialer Dialer, report func(error)) (*socks5.Client, error) {
+	client, err := socks5.NewClient(socks5Config(&socks5.Config{
+		ProxyAddr: cfg.SOCKS5.GetAddress(),
+		Username:  cfg.SOCKS5.Username,
+		Password:  cfg.SOCKS5.Password,
+		Timeout:   cfg.SOCKS5.Timeout,
+	}, &cfg.Upstream.TCP, dialer, report))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOCKS5 client: %w", err)
+	}
+	return client, nil
+}
+
+// socks5Config makes the server's SOCKS5 clients reach their proxy like
+// direct upstream connections
+func (s *Server) socks5Config(cfg *socks5.Config, tcp *config.TCPConfig) *socks5.Config {
+	return socks5Config(cfg, tcp, s.dialer, s.warnSocketOption)
+}
+
+// socks5Config makes a SOCKS5 client reach its proxy through dialer or with
+// the upstream socket options
+func socks5Config(cfg *socks5.Config, tcp *config.TCPConfig, dialer Dialer, report func(error)) *socks5.Config {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = upstreamDialTimeout
+	}
+	cfg.ForwardDialer = forwardDialer{dialer: dialer, report: report, timeout: timeout, tcp: tcp}
+	return cfg
+}
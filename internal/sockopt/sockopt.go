@@ -0,0 +1,152 @@
+// Package sockopt applies socket options to listeners and outgoing
+// connections through net.ListenConfig.Control and net.Dialer.Control
+package sockopt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+// errUnsupported is returned for options the platform does not have
+var errUnsupported = fmt.Errorf("not supported on %s", runtime.GOOS)
+
+// OptionError is an option the system refused
+type OptionError struct {
+	// Option is the config key of the option, e.g. "fast_open"
+	Option string
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return e.Option + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// Options are raw socket options; zero values leave the system default
+type Options struct {
+	// ReadBuffer and WriteBuffer set SO_RCVBUF and SO_SNDBUF in bytes
+	ReadBuffer  int
+	WriteBuffer int
+
+	// ReusePort sets SO_REUSEPORT on listeners
+	ReusePort bool
+
+	// FastOpen enables TCP Fast Open: TCP_FASTOPEN on listeners,
+	// TCP_FASTOPEN_CONNECT on outgoing connections
+	FastOpen bool
+
+	// Mark sets SO_MARK, the fwmark used by policy routing
+	Mark int
+
+	// TOS sets IP_TOS, or IPV6_TCLASS on IPv6 sockets
+	TOS int
+}
+
+// option identifies a socket option
+type option int
+
+const (
+	optReadBuffer option = iota
+	optWriteBuffer
+	optReusePort
+	optFastOpen
+	optMark
+	optTOS
+)
+
+// optionNames are the config keys of the options
+var optionNames = [...]string{
+	optReadBuffer:  "read_buffer",
+	optWriteBuffer: "write_buffer",
+	optReusePort:   "reuse_port",
+	optFastOpen:    "fast_open",
+	optMark:        "mark",
+	optTOS:         "tos",
+}
+
+// setting is an option with its value
+type setting struct {
+	opt   option
+	value int
+}
+
+// fastOpenQueue is the TCP_FASTOPEN queue length of listeners
+const fastOpenQueue = 256
+
+// settings returns the options that are set; reuse_port only applies to
+// listeners
+func (o Options) settings(listen bool) []setting {
+	var s []setting
+	if o.ReadBuffer > 0 {
+		s = append(s, setting{optReadBuffer, o.ReadBuffer})
+	}
+	if o.WriteBuffer > 0 {
+		s = append(s, setting{optWriteBuffer, o.WriteBuffer})
+	}
+	if o.ReusePort && listen {
+		s = append(s, setting{optReusePort, 1})
+	}
+	if o.FastOpen {
+		value := 1
+		if listen {
+			value = fastOpenQueue
+		}
+		s = append(s, setting{optFastOpen, value})
+	}
+	if o.Mark != 0 {
+		s = append(s, setting{optMark, o.Mark})
+	}
+	if o.TOS != 0 {
+		s = append(s, setting{optTOS, o.TOS})
+	}
+	return s
+}
+
+// Control returns a function for net.ListenConfig.Control, if listen is
+// set, or net.Dialer.Control that applies the options
+// Options the system refuses are passed to report as *OptionError and
+// skipped, so an unsupported option never fails a listener or connection.
+// Control returns nil if no option is set.
+func Control(o Options, listen bool, report func(error)) func(network, address string, c syscall.RawConn) error {
+	settings := o.settings(listen)
+	if len(settings) == 0 {
+		return nil
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		return c.Control(func(fd uintptr) {
+			for _, s := range settings {
+				if err := set(fd, network, listen, s.opt, s.value); err != nil && report != nil {
+					report(&OptionError{Option: optionNames[s.opt], Err: err})
+				}
+			}
+		})
+	}
+}
+
+// Probe applies the options to a temporary socket and returns an
+// *OptionError for each one the system refuses, e.g. for lack of support
+// or privileges
+func Probe(o Options, listen bool) []error {
+	var errs []error
+	lc := net.ListenConfig{Control: Control(o, listen, func(err error) {
+		errs = append(errs, err)
+	})}
+	if lc.Control == nil {
+		return nil
+	}
+
+	l, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		return []error{fmt.Errorf("cannot open a probe socket: %w", err)}
+	}
+	l.Close()
+	return errs
+}
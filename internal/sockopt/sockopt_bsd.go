@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package sockopt
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// set applies one option to the socket fd
+func set(fd uintptr, network string, listen bool, opt option, value int) error {
+	s := int(fd)
+	switch opt {
+	case optReadBuffer:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_RCVBUF, value)
+	case optWriteBuffer:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_SNDBUF, value)
+	case optReusePort:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_REUSEPORT, value)
+	case optTOS:
+		if strings.HasSuffix(network, "6") {
+			return unix.SetsockoptInt(s, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, value)
+		}
+		return unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, value)
+	}
+	return errUnsupported
+}
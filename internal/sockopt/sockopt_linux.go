@@ -0,0 +1,41 @@
+package sockopt
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// set applies one option to the socket fd
+func set(fd uintptr, network string, listen bool, opt option, value int) error {
+	s := int(fd)
+	switch opt {
+	case optReadBuffer:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_RCVBUF, value)
+	case optWriteBuffer:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_SNDBUF, value)
+	case optReusePort:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_REUSEPORT, value)
+	case optFastOpen:
+		if listen {
+			return unix.SetsockoptInt(s, unix.IPPROTO_TCP, unix.TCP_FASTOPEN, value)
+		}
+		return unix.SetsockoptInt(s, unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, value)
+	case optMark:
+		return unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_MARK, value)
+	case optTOS:
+		if strings.HasSuffix(network, "6") {
+			if err := unix.SetsockoptInt(s, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, value); err != nil {
+				return err
+			}
+			// Dual-stack sockets also carry IPv4 traffic
+			if err := unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, value); err != nil {
+				return fmt.Errorf("IP_TOS for IPv4 traffic: %w", err)
+			}
+			return nil
+		}
+		return unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, value)
+	}
+	return errUnsupported
+}
@@ -0,0 +1,95 @@
+package sockopt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestControlLinux(t *testing.T) {
+	opts := Options{ReadBuffer: 1 << 16, WriteBuffer: 1 << 16, ReusePort: true, FastOpen: true, Mark: 42, TOS: 0x10}
+
+	var reported []error
+	lc := net.ListenConfig{Control: Control(opts, true, func(err error) {
+		reported = append(reported, err)
+	})}
+	l, err := lc.Listen(context.Background(), "tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer l.Close()
+
+	refused := make(map[string]bool)
+	for _, err := range reported {
+		var optErr *OptionError
+		if !errors.As(err, &optErr) {
+			t.Fatalf("reported %v, want an *OptionError", err)
+		}
+		refused[optErr.Option] = true
+	}
+	// Setting a mark needs CAP_NET_ADMIN
+	if len(refused) > 1 || (len(refused) == 1 && !refused["mark"]) {
+		t.Fatalf("refused options = %v", reported)
+	}
+
+	raw, err := l.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type check struct {
+		name       string
+		level, opt int
+		want       int
+	}
+	checks := []check{
+		{"reuse_port", unix.SOL_SOCKET, unix.SO_REUSEPORT, 1},
+		{"tos", unix.IPPROTO_IP, unix.IP_TOS, 0x10},
+		// The kernel doubles buffer sizes for bookkeeping
+		{"read_buffer", unix.SOL_SOCKET, unix.SO_RCVBUF, 2 << 16},
+		{"write_buffer", unix.SOL_SOCKET, unix.SO_SNDBUF, 2 << 16},
+	}
+	if !refused["mark"] {
+		checks = append(checks, check{"mark", unix.SOL_SOCKET, unix.SO_MARK, 42})
+	}
+
+	raw.Control(func(fd uintptr) {
+		for _, c := range checks {
+			got, err := unix.GetsockoptInt(int(fd), c.level, c.opt)
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			} else if got != c.want {
+				t.Errorf("%s = %d, want %d", c.name, got, c.want)
+			}
+		}
+	})
+}
+
+func TestControlReportsRefusedOptions(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		t.Run(network, func(t *testing.T) {
+			var reported []error
+			control := Control(Options{TOS: 0x10}, false, func(err error) {
+				reported = append(reported, err)
+			})
+
+			// An invalid descriptor makes every option fail
+			if err := control(network, "localhost:1", fakeRawConn(-1)); err != nil {
+				t.Fatalf("Control() error = %v, want options skipped", err)
+			}
+			if len(reported) != 1 || !errors.Is(reported[0], syscall.EBADF) {
+				t.Errorf("reported = %v, want EBADF for tos", reported)
+			}
+		})
+	}
+}
+
+// fakeRawConn runs Control on a fixed descriptor
+type fakeRawConn int
+
+func (c fakeRawConn) Control(f func(fd uintptr)) error    { f(uintptr(c)); return nil }
+func (c fakeRawConn) Read(f func(fd uintptr) bool) error  { return nil }
+func (c fakeRawConn) Write(f func(fd uintptr) bool) error { return nil }
@@ -0,0 +1,8 @@
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package sockopt
+
+// set applies one option to the socket fd
+func set(fd uintptr, network string, listen bool, opt option, value int) error {
+	return errUnsupported
+}
@@ -0,0 +1,48 @@
+package sockopt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSettings(t *testing.T) {
+	opts := Options{ReadBuffer: 65536, ReusePort: true, FastOpen: true, TOS: 0x10}
+
+	tests := []struct {
+		name   string
+		listen bool
+		want   []setting
+	}{
+		{
+			name:   "listener",
+			listen: true,
+			want: []setting{
+				{optReadBuffer, 65536},
+				{optReusePort, 1},
+				{optFastOpen, fastOpenQueue},
+				{optTOS, 0x10},
+			},
+		},
+		{
+			name:   "dialer skips reuse_port",
+			listen: false,
+			want: []setting{
+				{optReadBuffer, 65536},
+				{optFastOpen, 1},
+				{optTOS, 0x10},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opts.settings(tt.listen); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if Control(Options{}, true, nil) != nil {
+		t.Error("Control() should be nil without options")
+	}
+}
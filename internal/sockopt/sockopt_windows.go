@@ -0,0 +1,15 @@
+package sockopt
+
+import "syscall"
+
+// set applies one option to the socket fd
+func set(fd uintptr, network string, listen bool, opt option, value int) error {
+	s := syscall.Handle(fd)
+	switch opt {
+	case optReadBuffer:
+		return syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_RCVBUF, value)
+	case optWriteBuffer:
+		return syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_SNDBUF, value)
+	}
+	return errUnsupported
+}
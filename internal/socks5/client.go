@@ -12,8 +12,9 @@ import (
 
 // Client wraps a SOCKS5 proxy connection with additional features
 type Client struct {
-	config *Config
-	dialer proxy.Dialer
+	config  *Config
+	dialer  proxy.Dialer
+	forward proxy.Dialer
 }
 
 // Config holds SOCKS5 client configuration
@@ -75,14 +76,25 @@ func NewClient(cfg *Config) (*Client, error) {
 	}
 
 	return &Client{
-		config: cfg,
-		dialer: dialer,
+		config:  cfg,
+		dialer:  dialer,
+		forward: forward,
 	}, nil
 }
 
 // NewClientFromURL creates a SOCKS5 client from a URL string
 // Format: socks5://[username:password@]host:port
 func NewClientFromURL(proxyURL string, timeout time.Duration) (*Client, error) {
+	cfg, err := ConfigFromURL(proxyURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(cfg)
+}
+
+// ConfigFromURL parses a SOCKS5 proxy URL into a client configuration
+// Format: socks5://[username:password@]host:port
+func ConfigFromURL(proxyURL string, timeout time.Duration) (*Config, error) {
 	u, err := url.Parse(proxyURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid proxy URL: %w", err)
@@ -103,7 +115,7 @@ func NewClientFromURL(proxyURL string, timeout time.Duration) (*Client, error) {
 		cfg.Password, _ = u.User.Password()
 	}
 
-	return NewClient(cfg)
+	return cfg, nil
 }
 
 // Dial connects to the address on the named network through the SOCKS5 proxy
@@ -122,6 +134,15 @@ func (c *Client) DialContext(ctx context.Context, network, address string) (net.
 		return nil, fmt.Errorf("unsupported network type: %s (must be tcp, tcp4, or tcp6)", network)
 	}
 
+	conn, err := dialContext(ctx, c.dialer, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial through SOCKS5: %w", err)
+	}
+	return conn, nil
+}
+
+// dialContext dials address with dialer, giving up when ctx is done
+func dialContext(ctx context.Context, dialer proxy.Dialer, network, address string) (net.Conn, error) {
 	// Create a channel for the dial result
 	type dialResult struct {
 		conn net.Conn
@@ -131,7 +152,7 @@ func (c *Client) DialContext(ctx context.Context, network, address string) (net.
 
 	// Dial in goroutine to support context cancellation
 	go func() {
-		conn, err := c.dialer.Dial(network, address)
+		conn, err := dialer.Dial(network, address)
 		resultCh <- dialResult{conn: conn, err: err}
 	}()
 
@@ -140,10 +161,7 @@ func (c *Client) DialContext(ctx context.Context, network, address string) (net.
 	case <-ctx.Done():
 		return nil, fmt.Errorf("dial cancelled: %w", ctx.Err())
 	case result := <-resultCh:
-		if result.err != nil {
-			return nil, fmt.Errorf("failed to dial through SOCKS5: %w", result.err)
-		}
-		return result.conn, nil
+		return result.conn, result.err
 	}
 }
 
@@ -154,24 +172,56 @@ func (c *Client) DialTimeout(network, address string, timeout time.Duration) (ne
 	return c.DialContext(ctx, network, address)
 }
 
+// DefaultTestEndpoint is the endpoint used by Test
+// We use google.com:80 as it's reliable and supports TCP
+const DefaultTestEndpoint = "google.com:80"
+
 // Test tests the SOCKS5 proxy connection by attempting to connect
 // to a well-known test endpoint
 func (c *Client) Test() error {
-	// Try to connect to a well-known endpoint through the proxy
-	// We use google.com:80 as it's reliable and supports TCP
-	testEndpoint := "google.com:80"
+	_, err := c.TestEndpoint(DefaultTestEndpoint)
+	return err
+}
+
+// TestResult holds the timing of a proxy test
+type TestResult struct {
+	// ProxyConnect is the time to open a TCP connection to the proxy itself
+	ProxyConnect time.Duration
+
+	// Tunnel is the time to establish a connection to the endpoint through
+	// the proxy (TCP connect, SOCKS5 handshake and CONNECT)
+	Tunnel time.Duration
+}
 
+// TestEndpoint tests the SOCKS5 proxy by connecting to the given endpoint
+// through it, and reports how long each step took
+func (c *Client) TestEndpoint(endpoint string) (*TestResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
 	defer cancel()
 
-	conn, err := c.DialContext(ctx, "tcp", testEndpoint)
+	result := &TestResult{}
+
+	// Measure plain TCP connect time to the proxy, reached the same way
+	// as for tunnelled connections
+	start := time.Now()
+	proxyConn, err := dialContext(ctx, c.forward, "tcp", c.config.ProxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy test failed: cannot reach proxy: %w", err)
+	}
+	result.ProxyConnect = time.Since(start)
+	proxyConn.Close()
+
+	// Try to connect to the endpoint through the proxy
+	start = time.Now()
+	conn, err := c.DialContext(ctx, "tcp", endpoint)
 	if err != nil {
-		return fmt.Errorf("proxy test failed: %w", err)
+		return nil, fmt.Errorf("proxy test failed: %w", err)
 	}
+	result.Tunnel = time.Since(start)
 	defer conn.Close()
 
 	// Successfully connected
-	return nil
+	return result, nil
 }
 
 // GetProxyAddr returns the configured proxy address
@@ -2,7 +2,10 @@ package socks5
 
 import (
 	"context"
+	"io"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -235,7 +238,7 @@ func TestDialContextValidation(t *testing.T) {
 			if tt.wantErr {
 				if err == nil {
 					t.Error("DialContext() should return error for invalid network")
-				} else if err.Error()[:29] != "unsupported network type" {
+				} else if !strings.HasPrefix(err.Error(), "unsupported network type") {
 					t.Errorf("Expected unsupported network error, got: %v", err)
 				}
 			}
@@ -326,6 +329,98 @@ func TestDialTimeout(t *testing.T) {
 	}
 }
 
+// recordingDialer dials directly and records every address it is asked for
+type recordingDialer struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (d *recordingDialer) Dial(network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.addrs = append(d.addrs, address)
+	d.mu.Unlock()
+	return net.Dial(network, address)
+}
+
+// serveSOCKS5 answers every CONNECT request on listener with success
+func serveSOCKS5(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			// Greeting: version, method count, methods
+			buf := make([]byte, 262)
+			if _, err := io.ReadFull(c, buf[:2]); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(c, buf[:buf[1]]); err != nil {
+				return
+			}
+			c.Write([]byte{0x05, 0x00})
+
+			// Request: version, command, reserved, address type, address, port
+			if _, err := io.ReadFull(c, buf[:4]); err != nil {
+				return
+			}
+			var addrLen int
+			switch buf[3] {
+			case 0x01:
+				addrLen = net.IPv4len
+			case 0x04:
+				addrLen = net.IPv6len
+			case 0x03:
+				if _, err := io.ReadFull(c, buf[:1]); err != nil {
+					return
+				}
+				addrLen = int(buf[0])
+			}
+			if _, err := io.ReadFull(c, buf[:addrLen+2]); err != nil {
+				return
+			}
+			c.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		}(conn)
+	}
+}
+
+func TestEndpointUsesForwardDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create test server: %v", err)
+	}
+	defer listener.Close()
+	go serveSOCKS5(listener)
+
+	forward := &recordingDialer{}
+	client, err := NewClient(&Config{
+		ProxyAddr:     listener.Addr().String(),
+		Timeout:       5 * time.Second,
+		ForwardDialer: forward,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if _, err := client.TestEndpoint("example.com:80"); err != nil {
+		t.Fatalf("TestEndpoint() error = %v", err)
+	}
+
+	// Both the proxy connect step and the tunnel reach the proxy through
+	// the forward dialer
+	forward.mu.Lock()
+	defer forward.mu.Unlock()
+	if len(forward.addrs) != 2 {
+		t.Fatalf("forward dialer used %d times, want 2", len(forward.addrs))
+	}
+	for _, addr := range forward.addrs {
+		if addr != listener.Addr().String() {
+			t.Errorf("forward dialer dialed %s, want %s", addr, listener.Addr())
+		}
+	}
+}
+
 // Benchmark tests
 func BenchmarkNewClient(b *testing.B) {
 	cfg := &Config{
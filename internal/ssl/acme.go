@@ -0,0 +1,353 @@
+package ssl
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Challenge types supported by the ACME issuer
+const (
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+// LetsEncryptURL is the default ACME directory
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// HTTPChallengePrefix is the URL path prefix of HTTP-01 challenge requests
+const HTTPChallengePrefix = "/.well-known/acme-challenge/"
+
+// ACMETLSALPNProtocol is the ALPN protocol of TLS-ALPN-01 validation handshakes
+const ACMETLSALPNProtocol = acme.ALPNProto
+
+// acmeRetryInterval is how long to wait after a failed issuance
+const acmeRetryInterval = 15 * time.Minute
+
+// acmeOrderTimeout bounds a single certificate order
+const acmeOrderTimeout = 5 * time.Minute
+
+// acmeAccountKeyFile is the account key file name in the ACME directory
+const acmeAccountKeyFile = "account.key"
+
+// ACMEConfig holds ACME certificate issuance settings
+type ACMEConfig struct {
+	// Enabled obtains certificates from an ACME CA instead of generating them
+	Enabled bool
+
+	// DirectoryURL is the ACME directory; defaults to Let's Encrypt
+	DirectoryURL string
+
+	// Email is the account contact address
+	Email string
+
+	// Domains to request; defaults to the configured DNS names
+	Domains []string
+
+	// AcceptTOS agrees to the CA's terms of service
+	AcceptTOS bool
+
+	// Challenges lists the challenge types to use, in order of preference
+	Challenges []string
+
+	// RenewBeforeDays renews certificates this many days before expiry
+	RenewBeforeDays int
+
+	// DirectoryCAFile is an extra PEM root for the directory's TLS
+	// certificate, for private or test ACME servers
+	DirectoryCAFile string
+}
+
+// acmeIssuer obtains certificates from an ACME CA and answers its challenges
+type acmeIssuer struct {
+	config ACMEConfig
+	dir    string
+	client *acme.Client
+
+	regMutex   sync.Mutex
+	registered bool
+
+	mutex      sync.RWMutex
+	httpTokens map[string]string
+	alpnCerts  map[string]*tls.Certificate
+}
+
+// newACMEIssuer loads or creates the account key and prepares the client
+// Account keys are kept per directory URL under cacheDir/acme
+func newACMEIssuer(cfg ACMEConfig, cacheDir string) (*acmeIssuer, error) {
+	sum := sha256.Sum256([]byte(cfg.DirectoryURL))
+	dir := filepath.Join(cacheDir, "acme", hex.EncodeToString(sum[:8]))
+
+	key, err := loadOrCreateAccountKey(filepath.Join(dir, acmeAccountKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if cfg.DirectoryCAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(cfg.DirectoryCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME directory CA: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.DirectoryCAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		httpClient.Transport = transport
+	}
+
+	return &acmeIssuer{
+		config: cfg,
+		dir:    dir,
+		client: &acme.Client{
+			Key:          key,
+			DirectoryURL: cfg.DirectoryURL,
+			HTTPClient:   httpClient,
+			UserAgent:    "whatsapp-proxy-go",
+		},
+		httpTokens: make(map[string]string),
+		alpnCerts:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// loadOrCreateAccountKey reads the account key, generating it on first use
+func loadOrCreateAccountKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no key found in %s", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ACME account key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported ACME account key type %T", key)
+		}
+		return signer, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read ACME account key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ACME directory: %w", err)
+	}
+	if err := writeFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write ACME account key: %w", err)
+	}
+
+	log.Printf("[INFO] Created ACME account key %s", path)
+	return key, nil
+}
+
+// ensureAccount registers the account key with the CA once per process;
+// registering an existing key just returns its account
+func (a *acmeIssuer) ensureAccount(ctx context.Context) error {
+	a.regMutex.Lock()
+	defer a.regMutex.Unlock()
+
+	if a.registered {
+		return nil
+	}
+
+	account := &acme.Account{}
+	if a.config.Email != "" {
+		account.Contact = []string{"mailto:" + a.config.Email}
+	}
+
+	_, err := a.client.Register(ctx, account, func(tosURL string) bool {
+		if a.config.AcceptTOS {
+			log.Printf("[INFO] Accepting ACME terms of service %s", tosURL)
+		}
+		return a.config.AcceptTOS
+	})
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("ACME account registration failed: %w", err)
+	}
+
+	a.registered = true
+	return nil
+}
+
+// obtain runs a complete order for domains and returns the issued certificate
+func (a *acmeIssuer) obtain(ctx context.Context, domains []string) (*tls.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, acmeOrderTimeout)
+	defer cancel()
+
+	if err := a.ensureAccount(ctx); err != nil {
+		return nil, err
+	}
+
+	order, err := a.client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := a.authorize(ctx, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := a.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	chain, _, err := a.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+
+	cert, err := withLeaf(&tls.Certificate{Certificate: chain, PrivateKey: key})
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(cert.Leaf.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("issued certificate does not match the requested key")
+	}
+	return cert, nil
+}
+
+// authorize completes one authorization with the preferred challenge type
+func (a *acmeIssuer) authorize(ctx context.Context, authzURL string) error {
+	authz, err := a.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	domain := authz.Identifier.Value
+	var chal *acme.Challenge
+	for _, typ := range a.config.Challenges {
+		for _, c := range authz.Challenges {
+			if c.Type == typ {
+				chal = c
+				break
+			}
+		}
+		if chal != nil {
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no supported challenge offered for %s", domain)
+	}
+
+	cleanup, err := a.present(chal, domain)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	log.Printf("[INFO] Answering ACME %s challenge for %s", chal.Type, domain)
+	if _, err := a.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("failed to accept %s challenge for %s: %w", chal.Type, domain, err)
+	}
+	if _, err := a.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s failed: %w", domain, err)
+	}
+	return nil
+}
+
+// present makes the challenge response available until cleanup is called
+func (a *acmeIssuer) present(chal *acme.Challenge, domain string) (func(), error) {
+	switch chal.Type {
+	case ChallengeHTTP01:
+		response, err := a.client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return nil, err
+		}
+		a.mutex.Lock()
+		a.httpTokens[chal.Token] = response
+		a.mutex.Unlock()
+		return func() {
+			a.mutex.Lock()
+			delete(a.httpTokens, chal.Token)
+			a.mutex.Unlock()
+		}, nil
+
+	case ChallengeTLSALPN01:
+		cert, err := a.client.TLSALPN01ChallengeCert(chal.Token, domain)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(domain)
+		a.mutex.Lock()
+		a.alpnCerts[name] = &cert
+		a.mutex.Unlock()
+		return func() {
+			a.mutex.Lock()
+			delete(a.alpnCerts, name)
+			a.mutex.Unlock()
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported challenge type %s", chal.Type)
+	}
+}
+
+// httpResponse returns the key authorization for an HTTP-01 token
+func (a *acmeIssuer) httpResponse(token string) (string, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	response, ok := a.httpTokens[token]
+	return response, ok
+}
+
+// alpnCertificate returns the TLS-ALPN-01 certificate for a server name
+func (a *acmeIssuer) alpnCertificate(serverName string) (*tls.Certificate, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	cert, ok := a.alpnCerts[strings.ToLower(serverName)]
+	return cert, ok
+}
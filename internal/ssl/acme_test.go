@@ -0,0 +1,501 @@
+package ssl
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// oidACMEIdentifier is the TLS-ALPN-01 acmeIdentifier extension
+var oidACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// fakeACME is a minimal in-memory ACME server in the spirit of Pebble
+// It validates challenges synchronously against the manager under test
+type fakeACME struct {
+	t       *testing.T
+	server  *httptest.Server
+	caCert  *x509.Certificate
+	caKey   *ecdsa.PrivateKey
+	manager *Manager
+
+	mutex      sync.Mutex
+	thumbprint string
+	domains    []string
+	challenges map[string]string // challenge URL -> token
+	authzValid map[string]bool
+	chalType   map[string]string // challenge URL -> type
+	chalDomain map[string]string
+	certPEM    []byte
+	offered    []string
+}
+
+func newFakeACME(t *testing.T, offered ...string) *fakeACME {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(der)
+
+	f := &fakeACME{
+		t:          t,
+		caCert:     caCert,
+		caKey:      caKey,
+		challenges: make(map[string]string),
+		authzValid: make(map[string]bool),
+		chalType:   make(map[string]string),
+		chalDomain: make(map[string]string),
+		offered:    offered,
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeACME) url(path string) string {
+	return f.server.URL + path
+}
+
+// decodeJWS returns the protected header and payload of a JWS request
+func decodeJWS(r *http.Request) (map[string]json.RawMessage, []byte, error) {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, nil, err
+	}
+	header, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	var protected map[string]json.RawMessage
+	if err := json.Unmarshal(header, &protected); err != nil {
+		return nil, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return protected, payload, err
+}
+
+// jwkThumbprint computes the account key thumbprint from an EC JWK
+func jwkThumbprint(raw json.RawMessage) (string, error) {
+	var jwk struct {
+		Crv, X, Y string
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", err
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return "", err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return "", err
+	}
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	return acme.JWKThumbprint(pub)
+}
+
+func (f *fakeACME) writeJSON(w http.ResponseWriter, status int, location string, v interface{}) {
+	if location != "" {
+		w.Header().Set("Location", location)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeACME) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+
+	if r.URL.Path == "/directory" {
+		f.writeJSON(w, http.StatusOK, "", map[string]interface{}{
+			"newNonce":   f.url("/nonce"),
+			"newAccount": f.url("/account"),
+			"newOrder":   f.url("/order"),
+			"revokeCert": f.url("/revoke"),
+			"keyChange":  f.url("/key-change"),
+			"meta":       map[string]string{"termsOfService": f.url("/tos")},
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	protected, payload, err := decodeJWS(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch {
+	case r.URL.Path == "/account":
+		var req struct {
+			TermsOfServiceAgreed bool `json:"termsOfServiceAgreed"`
+		}
+		json.Unmarshal(payload, &req)
+		if !req.TermsOfServiceAgreed {
+			http.Error(w, "terms not agreed", http.StatusForbidden)
+			return
+		}
+		thumbprint, err := jwkThumbprint(protected["jwk"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.thumbprint = thumbprint
+		f.writeJSON(w, http.StatusCreated, f.url("/account/1"), map[string]interface{}{"status": "valid"})
+
+	case r.URL.Path == "/order":
+		var req struct {
+			Identifiers []struct{ Type, Value string }
+		}
+		json.Unmarshal(payload, &req)
+		f.domains = nil
+		for _, id := range req.Identifiers {
+			f.domains = append(f.domains, id.Value)
+		}
+		f.writeJSON(w, http.StatusCreated, f.url("/order/1"), f.order("pending"))
+
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		var i int
+		fmt.Sscanf(r.URL.Path, "/authz/%d", &i)
+		domain := f.domains[i]
+		status := "pending"
+		if f.authzValid[domain] {
+			status = "valid"
+		}
+		var challenges []map[string]string
+		for _, typ := range f.offered {
+			chalURL := f.url(fmt.Sprintf("/chal/%d/%s", i, typ))
+			token := fmt.Sprintf("token-%d-%s", i, typ)
+			f.challenges[chalURL] = token
+			f.chalType[chalURL] = typ
+			f.chalDomain[chalURL] = domain
+			challenges = append(challenges, map[string]string{"type": typ, "url": chalURL, "token": token, "status": "pending"})
+		}
+		f.writeJSON(w, http.StatusOK, "", map[string]interface{}{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": domain},
+			"challenges": challenges,
+		})
+
+	case strings.HasPrefix(r.URL.Path, "/chal/"):
+		chalURL := f.url(r.URL.Path)
+		token := f.challenges[chalURL]
+		domain := f.chalDomain[chalURL]
+		if err := f.validate(f.chalType[chalURL], domain, token); err != nil {
+			f.t.Errorf("challenge %s for %s failed: %v", f.chalType[chalURL], domain, err)
+		} else {
+			f.authzValid[domain] = true
+		}
+		f.writeJSON(w, http.StatusOK, "", map[string]string{"type": f.chalType[chalURL], "url": chalURL, "token": token, "status": "processing"})
+
+	case r.URL.Path == "/order/1":
+		f.writeJSON(w, http.StatusOK, f.url("/order/1"), f.order(f.orderStatus()))
+
+	case r.URL.Path == "/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		json.Unmarshal(payload, &req)
+		if err := f.issue(req.CSR); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.writeJSON(w, http.StatusOK, f.url("/order/1"), f.order("valid"))
+
+	case r.URL.Path == "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(f.certPEM)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeACME) orderStatus() string {
+	if f.certPEM != nil {
+		return "valid"
+	}
+	for _, domain := range f.domains {
+		if !f.authzValid[domain] {
+			return "pending"
+		}
+	}
+	return "ready"
+}
+
+func (f *fakeACME) order(status string) map[string]interface{} {
+	var authzs []string
+	for i := range f.domains {
+		authzs = append(authzs, f.url(fmt.Sprintf("/authz/%d", i)))
+	}
+	order := map[string]interface{}{
+		"status":         status,
+		"authorizations": authzs,
+		"finalize":       f.url("/finalize"),
+	}
+	if status == "valid" {
+		order["certificate"] = f.url("/cert")
+	}
+	return order
+}
+
+// validate checks a challenge response through the manager's public hooks
+func (f *fakeACME) validate(typ, domain, token string) error {
+	keyAuth := token + "." + f.thumbprint
+
+	switch typ {
+	case ChallengeHTTP01:
+		response, ok := f.manager.HTTPChallengeResponse(token)
+		if !ok || response != keyAuth {
+			return fmt.Errorf("HTTP-01 response = %q, %v; want %q", response, ok, keyAuth)
+		}
+		return nil
+
+	case ChallengeTLSALPN01:
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go func() {
+			defer serverConn.Close()
+			tls.Server(serverConn, f.manager.ChallengeTLSConfig()).Handshake()
+		}()
+
+		conn := tls.Client(clientConn, &tls.Config{
+			ServerName:         domain,
+			NextProtos:         []string{ACMETLSALPNProtocol},
+			InsecureSkipVerify: true,
+		})
+		if err := conn.Handshake(); err != nil {
+			return err
+		}
+		if proto := conn.ConnectionState().NegotiatedProtocol; proto != ACMETLSALPNProtocol {
+			return fmt.Errorf("negotiated protocol %q", proto)
+		}
+
+		leaf := conn.ConnectionState().PeerCertificates[0]
+		want := sha256.Sum256([]byte(keyAuth))
+		for _, ext := range leaf.Extensions {
+			if ext.Id.Equal(oidACMEIdentifier) {
+				var got []byte
+				if _, err := asn1.Unmarshal(ext.Value, &got); err != nil {
+					return err
+				}
+				if !bytes.Equal(got, want[:]) {
+					return fmt.Errorf("acmeIdentifier mismatch")
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("acmeIdentifier extension missing")
+	}
+	return fmt.Errorf("unknown challenge type %s", typ)
+}
+
+// issue signs the CSR with the fake root
+func (f *fakeACME) issue(encodedCSR string) error {
+	der, err := base64.RawURLEncoding.DecodeString(encodedCSR)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, f.caCert, csr.PublicKey, f.caKey)
+	if err != nil {
+		return err
+	}
+
+	f.certPEM = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.caCert.Raw})...)
+	return nil
+}
+
+func newACMEManager(t *testing.T, f *fakeACME, dir string, challenges ...string) *Manager {
+	t.Helper()
+
+	manager, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"proxy.example.com", "chat.example.com"},
+		ValidityDays: 365,
+		CacheDir:     dir,
+		ACME: ACMEConfig{
+			Enabled:      true,
+			DirectoryURL: f.url("/directory"),
+			Email:        "admin@example.com",
+			AcceptTOS:    true,
+			Challenges:   challenges,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+
+	f.mutex.Lock()
+	f.manager = manager
+	f.mutex.Unlock()
+	return manager
+}
+
+func TestACMEIssuance(t *testing.T) {
+	tests := []struct {
+		name       string
+		offered    []string
+		challenges []string
+	}{
+		{"http-01", []string{ChallengeHTTP01, ChallengeTLSALPN01}, []string{ChallengeHTTP01}},
+		{"tls-alpn-01", []string{ChallengeHTTP01, ChallengeTLSALPN01}, []string{ChallengeTLSALPN01}},
+		{"preference falls back", []string{ChallengeHTTP01}, []string{ChallengeTLSALPN01, ChallengeHTTP01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			f := newFakeACME(t, tt.offered...)
+			manager := newACMEManager(t, f, tmpDir, tt.challenges...)
+
+			// A temporary certificate is served until the first order completes
+			if !manager.needsRenewal() {
+				t.Fatal("needsRenewal() = false before first issuance")
+			}
+
+			if err := manager.RotateCertificates(); err != nil {
+				t.Fatalf("RotateCertificates() error = %v", err)
+			}
+
+			cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "chat.example.com"})
+			if err != nil {
+				t.Fatalf("GetCertificate() error = %v", err)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(f.caCert)
+			if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "chat.example.com", Roots: roots}); err != nil {
+				t.Errorf("issued certificate does not verify: %v", err)
+			}
+			if manager.needsRenewal() {
+				t.Error("needsRenewal() = true after issuance")
+			}
+
+			// Challenge responses are removed once the order completes
+			if _, ok := manager.HTTPChallengeResponse("token-0-" + ChallengeHTTP01); ok {
+				t.Error("HTTP-01 response still served after issuance")
+			}
+			if manager.HasTLSALPNChallenge("proxy.example.com") {
+				t.Error("TLS-ALPN-01 certificate still served after issuance")
+			}
+		})
+	}
+}
+
+func TestACMEAccountAndCachePersistence(t *testing.T) {
+	tmpDir := t.TempDir()
+	f := newFakeACME(t, ChallengeHTTP01)
+
+	manager := newACMEManager(t, f, tmpDir, ChallengeHTTP01)
+	if err := manager.RotateCertificates(); err != nil {
+		t.Fatalf("RotateCertificates() error = %v", err)
+	}
+	issued, _ := manager.GetCertificate(nil)
+	thumbprint := f.thumbprint
+	manager.Close()
+
+	keys, _ := filepath.Glob(filepath.Join(tmpDir, "acme", "*", acmeAccountKeyFile))
+	if len(keys) != 1 {
+		t.Fatalf("expected one account key, found %v", keys)
+	}
+	if info, err := os.Stat(keys[0]); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("account key mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	// A restart reuses the account key and the cached certificate
+	reloaded := newACMEManager(t, f, tmpDir, ChallengeHTTP01)
+	if reloaded.needsRenewal() {
+		t.Error("needsRenewal() = true with a valid cached certificate")
+	}
+	if cert, _ := reloaded.GetCertificate(nil); cert.Leaf.SerialNumber.Cmp(issued.Leaf.SerialNumber) != 0 {
+		t.Error("cached ACME certificate was not reused")
+	}
+
+	if err := reloaded.RotateCertificates(); err != nil {
+		t.Fatalf("RotateCertificates() error = %v", err)
+	}
+	if f.thumbprint != thumbprint {
+		t.Error("account key changed across restarts")
+	}
+}
+
+func TestACMETermsNotAccepted(t *testing.T) {
+	f := newFakeACME(t, ChallengeHTTP01)
+
+	manager, err := NewManager(&Config{
+		CacheDir: t.TempDir(),
+		ACME: ACMEConfig{
+			Enabled:      true,
+			DirectoryURL: f.url("/directory"),
+			Domains:      []string{"proxy.example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	if err := manager.RotateCertificates(); err == nil {
+		t.Error("RotateCertificates() succeeded without accepting the terms of service")
+	}
+}
@@ -0,0 +1,240 @@
+package ssl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// CA file names inside the CA directory
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+)
+
+// caExpiryWarning is how long before root expiry a warning is logged
+const caExpiryWarning = 90 * 24 * time.Hour
+
+// CAConfig holds local certificate authority settings
+type CAConfig struct {
+	// Enabled issues leaf certificates from a local root CA instead of
+	// generating self-signed ones
+	Enabled bool
+
+	// Dir is where the root certificate and encrypted key are stored
+	Dir string
+
+	// Passphrase protects the root private key on disk
+	Passphrase string
+
+	// ValidityDays is the root certificate validity period in days
+	ValidityDays int
+
+	// LeafValidityDays is the validity period of issued leaf certificates
+	LeafValidityDays int
+
+	// OnDemand issues a leaf certificate for any requested SNI name not
+	// covered by the configured names
+	OnDemand bool
+}
+
+// CA is a local certificate authority
+type CA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// LoadOrCreateCA loads the root CA from dir, or creates and persists a new
+// one if none exists
+func LoadOrCreateCA(dir, passphrase string, validityDays int) (*CA, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("a passphrase is required to protect the CA key")
+	}
+
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(keyPath)
+	switch {
+	case certErr == nil && keyErr == nil:
+		ca, err := loadCA(certPath, keyPath, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().After(ca.cert.NotAfter) {
+			return nil, fmt.Errorf("root CA in %s expired on %s; remove it to create a new one", dir, ca.cert.NotAfter.Format(time.RFC3339))
+		}
+		if time.Until(ca.cert.NotAfter) < caExpiryWarning {
+			log.Printf("[WARN] Root CA expires on %s; clients must trust a new root after that", ca.cert.NotAfter.Format(time.RFC3339))
+		}
+		log.Printf("[INFO] Loaded root CA %s", ca.Fingerprint())
+		return ca, nil
+
+	case os.IsNotExist(certErr) && os.IsNotExist(keyErr):
+		ca, err := createCA(validityDays)
+		if err != nil {
+			return nil, err
+		}
+		if err := ca.save(dir, passphrase); err != nil {
+			return nil, err
+		}
+		log.Printf("[INFO] Created root CA %s in %s", ca.Fingerprint(), dir)
+		return ca, nil
+
+	default:
+		// Never replace a root clients may already trust because one file is missing
+		return nil, fmt.Errorf("incomplete CA in %s: both %s and %s are required", dir, caCertFile, caKeyFile)
+	}
+}
+
+// createCA generates a new root CA
+func createCA(validityDays int) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"WhatsApp Proxy"},
+			CommonName:   "WhatsApp Proxy Local CA " + notBefore.Format("2006-01-02"),
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(time.Duration(validityDays) * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	return &CA{cert: cert, key: key}, nil
+}
+
+// loadCA reads the root certificate and decrypts its key
+func loadCA(certPath, keyPath, passphrase string) (*CA, error) {
+	cert, err := readCACertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	key, err := decryptPrivateKey(keyPEM, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt CA key %s: %w", keyPath, err)
+	}
+
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("CA key %s does not match certificate %s", keyPath, certPath)
+	}
+
+	return &CA{cert: cert, key: key}, nil
+}
+
+// readCACertificate reads the root certificate
+func readCACertificate(certPath string) (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// save writes the root certificate and the passphrase-encrypted key
+func (ca *CA) save(dir, passphrase string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	keyPEM, err := encryptPrivateKey(ca.key, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt CA key: %w", err)
+	}
+
+	// Key first: a certificate without its key is treated as incomplete
+	if err := writeFileAtomic(filepath.Join(dir, caKeyFile), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, caCertFile), ca.PEM(), 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	return nil
+}
+
+// Certificate returns the root certificate
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the root certificate
+func (ca *CA) Fingerprint() string {
+	sum := sha256.Sum256(ca.cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// PEM returns the root certificate in PEM format
+func (ca *CA) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// DER returns the root certificate in DER format
+func (ca *CA) DER() []byte {
+	return ca.cert.Raw
+}
+
+// PKCS12 returns the root certificate as a PKCS#12 trust store protected by
+// password; the root private key is never included
+func (ca *CA) PKCS12(password string) ([]byte, error) {
+	data, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{ca.cert}, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS#12: %w", err)
+	}
+	return data, nil
+}
+
+// publicKeysEqual reports whether two public keys are the same
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
@@ -1,13 +1,82 @@
 package ssl
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
-// saveCertificateToCache saves a certificate to the cache directory
+// Cache file layout: every entry is stored as <key>.crt, <key>.key and
+// <key>.json. The metadata file is written last and marks the entry complete.
+const (
+	certExt     = ".crt"
+	keyExt      = ".key"
+	metaExt     = ".json"
+	tmpPrefix   = ".tmp-"
+	cachePrefix = "cert-"
+
+	// staleTempAge is how old a temporary file must be before it is removed;
+	// younger ones may belong to a write in progress in another process
+	staleTempAge = time.Hour
+)
+
+// cacheMetadata describes a cached certificate
+type cacheMetadata struct {
+	Key         string    `json:"key"`
+	DNSNames    []string  `json:"dns_names"`
+	IPAddresses []string  `json:"ip_addresses"`
+	KeyType     string    `json:"key_type"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// cacheKey derives the cache key from the SAN set, key parameters and issuer
+// The SAN order does not matter
+func cacheKey(dnsNames []string, ipAddresses []net.IP, keyType, issuer string) string {
+	sans := make([]string, 0, len(dnsNames)+len(ipAddresses))
+	for _, name := range dnsNames {
+		sans = append(sans, "dns:"+strings.ToLower(name))
+	}
+	for _, ip := range ipAddresses {
+		sans = append(sans, "ip:"+ip.String())
+	}
+	sort.Strings(sans)
+
+	sum := sha256.Sum256([]byte(keyType + "|" + issuer + "|" + strings.Join(sans, ",")))
+	return cachePrefix + hex.EncodeToString(sum[:12])
+}
+
+// keyTypeOf describes the key algorithm and size of a certificate
+func keyTypeOf(cert *x509.Certificate) string {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa-%d", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ecdsa-" + pub.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "ed25519"
+	default:
+		return "unknown"
+	}
+}
+
+// saveCertificateToCache atomically saves a certificate and its metadata
+// to the cache directory
 func saveCertificateToCache(cacheDir, key string, cert *tls.Certificate) error {
 	if cert == nil || len(cert.Certificate) == 0 {
 		return fmt.Errorf("invalid certificate")
@@ -18,68 +87,219 @@ func saveCertificateToCache(cacheDir, key string, cert *tls.Certificate) error {
 		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	certPath := filepath.Join(cacheDir, key+".crt")
-	keyPath := filepath.Join(cacheDir, key+".key")
+	x509Cert, err := parseTLSCertificate(cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
 
-	// Parse certificate to get PEM encoding
 	certPEM, keyPEM, err := encodeCertificateToPEM(cert)
 	if err != nil {
 		return fmt.Errorf("failed to encode certificate: %w", err)
 	}
 
-	// Write certificate file
-	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
-		return fmt.Errorf("failed to write certificate file: %w", err)
+	meta := cacheMetadata{
+		Key:         key,
+		DNSNames:    x509Cert.DNSNames,
+		IPAddresses: make([]string, len(x509Cert.IPAddresses)),
+		KeyType:     keyTypeOf(x509Cert),
+		NotBefore:   x509Cert.NotBefore,
+		NotAfter:    x509Cert.NotAfter,
+		CreatedAt:   time.Now(),
+	}
+	for i, ip := range x509Cert.IPAddresses {
+		meta.IPAddresses[i] = ip.String()
+	}
+	metaJSON, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	// Invalidate the old entry first so a crash between the writes below
+	// never leaves metadata pointing at a mismatched pair
+	if err := os.Remove(filepath.Join(cacheDir, key+metaExt)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old metadata: %w", err)
 	}
 
 	// Write key file (with restricted permissions)
-	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+	if err := writeFileAtomic(filepath.Join(cacheDir, key+keyExt), keyPEM, 0600); err != nil {
 		return fmt.Errorf("failed to write key file: %w", err)
 	}
 
+	if err := writeFileAtomic(filepath.Join(cacheDir, key+certExt), certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate file: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(cacheDir, key+metaExt), metaJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+
 	return nil
 }
 
-// loadCertificateFromCache loads a certificate from the cache directory
+// loadCertificateFromCache loads a complete cache entry
 func loadCertificateFromCache(cacheDir, key string) (*tls.Certificate, error) {
-	certPath := filepath.Join(cacheDir, key+".crt")
-	keyPath := filepath.Join(cacheDir, key+".key")
+	meta, err := readCacheMetadata(filepath.Join(cacheDir, key+metaExt))
+	if err != nil {
+		return nil, err
+	}
+	if meta.Key != key {
+		return nil, fmt.Errorf("metadata key %s does not match %s", meta.Key, key)
+	}
 
-	// Check if files exist
-	if _, err := os.Stat(certPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("certificate file not found")
+	return loadCertificateFromFiles(filepath.Join(cacheDir, key+certExt), filepath.Join(cacheDir, key+keyExt))
+}
+
+// readCacheMetadata reads a cache metadata file
+func readCacheMetadata(path string) (*cacheMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("certificate not cached")
+		}
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("key file not found")
+
+	var meta cacheMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// gcCache removes expired entries, incomplete entries, files left over by
+// the old fixed-name cache and abandoned temporary files
+// The entry for keep is never removed
+func gcCache(cacheDir, keep string) (int, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	now := time.Now()
+	complete := make(map[string]bool)
+	var remove []string
+
+	// First pass: decide which entries are complete and still valid
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, cachePrefix) || filepath.Ext(name) != metaExt {
+			continue
+		}
+
+		key := strings.TrimSuffix(name, metaExt)
+		meta, err := readCacheMetadata(filepath.Join(cacheDir, name))
+		if key != keep && (err != nil || meta.Key != key || now.After(meta.NotAfter)) {
+			remove = append(remove, name)
+			continue
+		}
+		complete[key] = true
 	}
 
-	// Load certificate
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	// Second pass: certificate and key files without a valid entry
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(name, tmpPrefix):
+			if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > staleTempAge {
+				remove = append(remove, name)
+			}
+		case name == "default"+certExt || name == "default"+keyExt:
+			// Written by versions that used a fixed cache key
+			remove = append(remove, name)
+		case strings.HasPrefix(name, cachePrefix):
+			ext := filepath.Ext(name)
+			key := strings.TrimSuffix(name, ext)
+			if (ext == certExt || ext == keyExt) && key != keep && !complete[key] {
+				remove = append(remove, name)
+			}
+		}
+	}
+
+	removed := 0
+	for _, name := range remove {
+		if err := os.Remove(filepath.Join(cacheDir, name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[WARN] Failed to remove stale cache file %s: %v", name, err)
+			continue
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it into place, so readers never observe a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+filepath.Base(path)+"-")
 	if err != nil {
-		return nil, fmt.Errorf("failed to load certificate: %w", err)
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Clean up on any failure before the rename
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
 	}
 
-	return &cert, nil
+	ok = true
+	return nil
 }
 
-// encodeCertificateToPEM encodes a tls.Certificate to PEM format
+// encodeCertificateToPEM encodes a tls.Certificate chain and its private key
+// to PEM format; the key is encoded as PKCS#8
 func encodeCertificateToPEM(cert *tls.Certificate) ([]byte, []byte, error) {
 	if cert == nil {
 		return nil, nil, fmt.Errorf("certificate is nil")
 	}
 
-	// For generated certificates, we need to get the PEM encoding
-	// This is a simplified approach - in production you might want to store
-	// the original PEM data during generation
-
-	// Note: This won't work perfectly for certificates without PEM data
-	// But for our use case with fresh generation, it's acceptable
-
 	if len(cert.Certificate) == 0 {
 		return nil, nil, fmt.Errorf("no certificate data")
 	}
 
-	// Since we generate certificates with PEM encoding, we can use a workaround
-	// In a real implementation, you'd store PEM data alongside the certificate
-	return nil, nil, fmt.Errorf("PEM encoding not available (use fresh generation)")
+	if cert.PrivateKey == nil {
+		return nil, nil, fmt.Errorf("no private key")
+	}
+
+	var certPEM []byte
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: der,
+		})...)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: keyDER,
+	})
+
+	return certPEM, keyPEM, nil
 }
@@ -0,0 +1,287 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Client certificate verification modes
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Client identity sources
+const (
+	IdentitySubjectCN = "subject_cn"
+	IdentitySubject   = "subject"
+	IdentitySANDNS    = "san_dns"
+	IdentitySANEmail  = "san_email"
+	IdentitySANURI    = "san_uri"
+)
+
+// ClientAuthConfig configures TLS client certificate authentication
+type ClientAuthConfig struct {
+	// Mode is ClientAuthNone, ClientAuthOptional or ClientAuthRequire
+	// With ClientAuthOptional clients may omit a certificate, but one that
+	// is presented must verify
+	Mode string
+
+	// CAFiles are PEM bundles of the CAs that issue client certificates
+	CAFiles []string
+
+	// CRLFiles are PEM or DER revocation lists signed by one of the CAs;
+	// they are reloaded on change every WatchInterval
+	CRLFiles []string
+
+	// Identity lists where the client identity is taken from, in order;
+	// the first non-empty value wins. Defaults to IdentitySubjectCN
+	Identity []string
+}
+
+// clientAuth verifies client certificates
+type clientAuth struct {
+	config ClientAuthConfig
+	mode   tls.ClientAuthType
+	pool   *x509.CertPool
+	cas    []*x509.Certificate
+
+	// revoked holds the current revocation lists
+	revoked atomic.Pointer[revocationSet]
+}
+
+// revocationSet is the set of revoked certificates, keyed by issuer and
+// serial number
+type revocationSet map[string]struct{}
+
+// revocationKey identifies a certificate in a revocation set
+func revocationKey(rawIssuer []byte, serial string) string {
+	return string(rawIssuer) + "/" + serial
+}
+
+// newClientAuth loads the client CAs and revocation lists
+// It returns nil if client authentication is disabled
+func newClientAuth(cfg ClientAuthConfig) (*clientAuth, error) {
+	a := &clientAuth{config: cfg}
+	switch cfg.Mode {
+	case "", ClientAuthNone:
+		return nil, nil
+	case ClientAuthOptional:
+		a.mode = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		a.mode = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q (must be none, optional or require)", cfg.Mode)
+	}
+
+	if len(a.config.Identity) == 0 {
+		a.config.Identity = []string{IdentitySubjectCN}
+	}
+	for _, source := range a.config.Identity {
+		switch source {
+		case IdentitySubjectCN, IdentitySubject, IdentitySANDNS, IdentitySANEmail, IdentitySANURI:
+		default:
+			return nil, fmt.Errorf("unknown client identity source %q", source)
+		}
+	}
+
+	if len(cfg.CAFiles) == 0 {
+		return nil, fmt.Errorf("client auth requires at least one CA file")
+	}
+	a.pool = x509.NewCertPool()
+	for _, file := range cfg.CAFiles {
+		certs, err := loadCertificateBundle(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			a.pool.AddCert(cert)
+			a.cas = append(a.cas, cert)
+		}
+	}
+
+	if err := a.loadRevocationLists(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// loadCertificateBundle reads every certificate in a PEM file
+func loadCertificateBundle(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no certificates found", file)
+	}
+	return certs, nil
+}
+
+// loadRevocationLists reads and verifies the revocation lists and
+// activates them; on error the current lists stay active
+func (a *clientAuth) loadRevocationLists() error {
+	set := make(revocationSet)
+	for _, file := range a.config.CRLFiles {
+		crl, err := a.loadRevocationList(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.Printf("[WARN] Revocation list %s is past its next update (%s)", file, crl.NextUpdate.Format(time.RFC3339))
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			set[revocationKey(crl.RawIssuer, entry.SerialNumber.String())] = struct{}{}
+		}
+	}
+	a.revoked.Store(&set)
+	return nil
+}
+
+// loadRevocationList parses a revocation list and checks it was signed by
+// one of the client CAs
+func (a *clientAuth) loadRevocationList(file string) (*x509.RevocationList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ca := range a.cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			return crl, nil
+		}
+	}
+	return nil, errors.New("revocation list is not signed by a client CA")
+}
+
+// verifyConnection rejects client certificates on a revocation list
+func (a *clientAuth) verifyConnection(state tls.ConnectionState) error {
+	revoked := *a.revoked.Load()
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			if _, ok := revoked[revocationKey(cert.RawIssuer, cert.SerialNumber.String())]; ok {
+				return fmt.Errorf("client certificate %q (serial %s) is revoked", cert.Subject.CommonName, cert.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
+
+// identity maps a verified client certificate to an identity
+func (a *clientAuth) identity(cert *x509.Certificate) string {
+	for _, source := range a.config.Identity {
+		switch source {
+		case IdentitySubjectCN:
+			if cert.Subject.CommonName != "" {
+				return cert.Subject.CommonName
+			}
+		case IdentitySubject:
+			if len(cert.RawSubject) > 0 {
+				return cert.Subject.String()
+			}
+		case IdentitySANDNS:
+			if len(cert.DNSNames) > 0 {
+				return cert.DNSNames[0]
+			}
+		case IdentitySANEmail:
+			if len(cert.EmailAddresses) > 0 {
+				return cert.EmailAddresses[0]
+			}
+		case IdentitySANURI:
+			if len(cert.URIs) > 0 {
+				return cert.URIs[0].String()
+			}
+		}
+	}
+	return ""
+}
+
+// ClientAuthEnabled reports whether TLS clients are asked for certificates
+func (m *Manager) ClientAuthEnabled() bool {
+	return m.clientAuth != nil
+}
+
+// ClientIdentity returns the identity of the verified client certificate of
+// a completed handshake, or "" if the client sent none
+func (m *Manager) ClientIdentity(state tls.ConnectionState) string {
+	if m.clientAuth == nil || len(state.VerifiedChains) == 0 {
+		return ""
+	}
+	return m.clientAuth.identity(state.VerifiedChains[0][0])
+}
+
+// ReloadRevocationLists re-reads the client certificate revocation lists
+func (m *Manager) ReloadRevocationLists() error {
+	if m.clientAuth == nil || len(m.clientAuth.config.CRLFiles) == 0 {
+		return fmt.Errorf("no revocation lists are configured")
+	}
+	return m.clientAuth.loadRevocationLists()
+}
+
+// crlLoop reloads revocation lists when they change on disk
+func (m *Manager) crlLoop() {
+	ticker := time.NewTicker(m.config.WatchInterval)
+	defer ticker.Stop()
+
+	states := statRevocationLists(m.clientAuth.config.CRLFiles)
+	for {
+		select {
+		case <-ticker.C:
+			current := statRevocationLists(m.clientAuth.config.CRLFiles)
+			if current == states {
+				continue
+			}
+			log.Printf("[INFO] Revocation lists changed, reloading")
+			if err := m.clientAuth.loadRevocationLists(); err != nil {
+				log.Printf("[ERROR] Reloading revocation lists failed, keeping the current lists: %v", err)
+			}
+			states = current
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// statRevocationLists summarizes the modification times and sizes of the
+// revocation lists; missing files are skipped
+func statRevocationLists(files []string) string {
+	var state string
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			state += fmt.Sprintf("%d:%d;", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return state
+}
@@ -0,0 +1,240 @@
+package ssl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issueClientCertificate issues a client certificate from ca
+func issueClientCertificate(t *testing.T, ca *CA, serial int64, commonName string, uris ...string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, u)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeRevocationList writes a PEM revocation list of ca revoking serials
+func writeRevocationList(t *testing.T, path string, ca *CA, number int64, serials ...int64) {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range serials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now(),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clientHandshake runs a handshake with an optional client certificate and
+// returns the server's view of the connection
+func clientHandshake(t *testing.T, server *tls.Config, cert *tls.Certificate) (tls.ConnectionState, error) {
+	t.Helper()
+	// A TCP pair buffers, unlike net.Pipe, so alerts sent while the client
+	// is still writing its flight do not deadlock
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	type result struct {
+		state tls.ConnectionState
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn := tls.Server(serverConn, server)
+		err := conn.Handshake()
+		results <- result{conn.ConnectionState(), err}
+		serverConn.Close()
+	}()
+
+	clientConfig := &tls.Config{InsecureSkipVerify: true}
+	if cert != nil {
+		clientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	client := tls.Client(clientConn, clientConfig)
+	client.Handshake()
+	// TLS 1.3 clients learn about rejected certificates on the first read
+	client.Read(make([]byte, 1))
+	clientConn.Close()
+
+	r := <-results
+	return r.state, r.err
+}
+
+func TestClientAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	ca, err := createCA(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := createCA(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(tmpDir, "clients.pem")
+	if err := os.WriteFile(caFile, ca.PEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	crlFile := filepath.Join(tmpDir, "clients.crl")
+	writeRevocationList(t, crlFile, ca, 1, 2)
+
+	device := issueClientCertificate(t, ca, 1, "device-1", "spiffe://fleet/device-1")
+	revoked := issueClientCertificate(t, ca, 2, "device-2")
+	stranger := issueClientCertificate(t, other, 1, "stranger")
+
+	newManager := func(mode string, identity ...string) *Manager {
+		manager, err := NewManager(&Config{
+			AutoGenerate: true,
+			DNSNames:     []string{"localhost"},
+			CacheDir:     tmpDir,
+			ClientAuth: ClientAuthConfig{
+				Mode:     mode,
+				CAFiles:  []string{caFile},
+				CRLFiles: []string{crlFile},
+				Identity: identity,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		t.Cleanup(func() { manager.Close() })
+		return manager
+	}
+
+	required := newManager(ClientAuthRequire)
+	optional := newManager(ClientAuthOptional, IdentitySANURI, IdentitySubjectCN)
+
+	tests := []struct {
+		name         string
+		manager      *Manager
+		cert         *tls.Certificate
+		wantErr      string
+		wantIdentity string
+	}{
+		{"valid certificate", required, device, "", "device-1"},
+		{"identity from SAN URI", optional, device, "", "spiffe://fleet/device-1"},
+		{"no certificate required", required, nil, "certificate", ""},
+		{"no certificate optional", optional, nil, "", ""},
+		{"revoked certificate", required, revoked, "revoked", ""},
+		{"revoked certificate optional", optional, revoked, "revoked", ""},
+		{"unknown issuer", required, stranger, "unknown authority", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := clientHandshake(t, tt.manager.GetTLSConfig(), tt.cert)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("handshake error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake error = %v", err)
+			}
+			if got := tt.manager.ClientIdentity(state); got != tt.wantIdentity {
+				t.Errorf("ClientIdentity() = %q, want %q", got, tt.wantIdentity)
+			}
+		})
+	}
+
+	// A new revocation list takes effect on reload
+	writeRevocationList(t, crlFile, ca, 2, 1, 2)
+	if err := required.ReloadRevocationLists(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientHandshake(t, required.GetTLSConfig(), device); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("handshake error after reload = %v, want revoked", err)
+	}
+
+	// A list from another CA is rejected and the current one kept
+	writeRevocationList(t, crlFile, other, 3)
+	if err := required.ReloadRevocationLists(); err == nil {
+		t.Error("expected an error for a revocation list from another CA")
+	}
+	if _, err := clientHandshake(t, required.GetTLSConfig(), device); err == nil {
+		t.Error("revocation list was replaced by an invalid one")
+	}
+}
+
+func TestClientAuthConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ClientAuthConfig
+		wantErr string
+	}{
+		{"unknown mode", ClientAuthConfig{Mode: "sometimes"}, "unknown client auth mode"},
+		{"missing CA", ClientAuthConfig{Mode: ClientAuthRequire}, "at least one CA file"},
+		{"unknown identity", ClientAuthConfig{Mode: ClientAuthRequire, Identity: []string{"serial"}}, "unknown client identity source"},
+		{"unreadable CA", ClientAuthConfig{Mode: ClientAuthRequire, CAFiles: []string{"/nonexistent/ca.pem"}}, "failed to read client CA file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewManager(&Config{AutoGenerate: true, CacheDir: t.TempDir(), ClientAuth: tt.config})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewManager() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
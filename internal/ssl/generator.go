@@ -1,37 +1,97 @@
 package ssl
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
 	"fmt"
 	"math/big"
 	"net"
+	"strings"
 	"time"
 )
 
+// Key types of generated certificates, named as in the cache metadata
+const (
+	KeyTypeRSA2048   = "rsa-2048"
+	KeyTypeRSA3072   = "rsa-3072"
+	KeyTypeRSA4096   = "rsa-4096"
+	KeyTypeECDSAP256 = "ecdsa-P-256"
+	KeyTypeECDSAP384 = "ecdsa-P-384"
+	KeyTypeEd25519   = "ed25519"
+)
+
+// DefaultKeyType is the key type used when none is configured
+const DefaultKeyType = KeyTypeRSA2048
+
+// ParseKeyType returns the canonical name of a key type
+// Names are case-insensitive and the dash in curve names is optional, so
+// "ecdsa-p256" and "ECDSA-P-256" are the same
+func ParseKeyType(name string) (string, error) {
+	normalized := strings.ReplaceAll(strings.ToLower(name), "p-", "p")
+	for _, keyType := range []string{KeyTypeRSA2048, KeyTypeRSA3072, KeyTypeRSA4096, KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519} {
+		if normalized == strings.ReplaceAll(strings.ToLower(keyType), "p-", "p") {
+			return keyType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key type %q (must be rsa-2048, rsa-3072, rsa-4096, ecdsa-p256, ecdsa-p384 or ed25519)", name)
+}
+
+// generateKey generates a private key of the given type
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
 // generateSelfSignedCertificate generates a new self-signed certificate
 func generateSelfSignedCertificate(dnsNames []string, ipAddresses []net.IP, validityDays int) (*tls.Certificate, error) {
-	// Generate RSA private key (2048-bit)
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	return issueCertificate(dnsNames, ipAddresses, validityDays, DefaultKeyType, nil)
+}
+
+// issueCertificate generates a new server certificate with a key of keyType,
+// signed by ca, or self-signed if ca is nil
+func issueCertificate(dnsNames []string, ipAddresses []net.IP, validityDays int, keyType string, ca *CA) (*tls.Certificate, error) {
+	privateKey, err := generateKey(keyType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
-	// Generate random serial number
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	serialNumber, err := randomSerialNumber()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+		return nil, err
 	}
 
 	// Create certificate template
 	notBefore := time.Now()
 	notAfter := notBefore.Add(time.Duration(validityDays) * 24 * time.Hour)
 
+	// Key encipherment only applies to RSA key exchange
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, ok := privateKey.(*rsa.PrivateKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
 	template := &x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
@@ -40,38 +100,42 @@ func generateSelfSignedCertificate(dnsNames []string, ipAddresses []net.IP, vali
 		},
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              keyUsage,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 		DNSNames:              dnsNames,
 		IPAddresses:           ipAddresses,
 	}
 
-	// Create self-signed certificate
-	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	// Self-signed unless a CA is given
+	parent, signer := template, privateKey
+	if ca != nil {
+		// Leaf certificates never outlive their issuer
+		if notAfter.After(ca.cert.NotAfter) {
+			template.NotAfter = ca.cert.NotAfter
+		}
+		parent, signer = ca.cert, ca.key
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, parent, privateKey.Public(), signer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create certificate: %w", err)
 	}
 
-	// Encode certificate to PEM
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certDER,
-	})
-
-	// Encode private key to PEM
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	return withLeaf(&tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  privateKey,
 	})
+}
 
-	// Parse into tls.Certificate
-	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+// randomSerialNumber generates a random 128-bit certificate serial number
+func randomSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create TLS certificate: %w", err)
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
 	}
-
-	return &tlsCert, nil
+	return serialNumber, nil
 }
 
 // loadCertificateFromFiles loads a certificate from PEM files
@@ -80,7 +144,38 @@ func loadCertificateFromFiles(certFile, keyFile string) (*tls.Certificate, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to load certificate: %w", err)
 	}
-	return &tlsCert, nil
+	return withLeaf(&tlsCert)
+}
+
+// withLeaf populates cert.Leaf so handshakes need not parse the certificate
+func withLeaf(cert *tls.Certificate) (*tls.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert, nil
+	}
+	leaf, err := parseTLSCertificate(cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	cert.Leaf = leaf
+	return cert, nil
+}
+
+// isValidServerName reports whether name is a plausible DNS host name
+func isValidServerName(name string) bool {
+	if name == "" || len(name) > 253 || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // isCertificateExpiringSoon checks if a certificate expires within the given days
@@ -0,0 +1,79 @@
+package ssl
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Certificate sources reported in CertificateInfo
+const (
+	SourceDefault  = "default"
+	SourceEntry    = "entry"
+	SourceOnDemand = "on_demand"
+)
+
+// certificateInfo describes a served certificate
+func certificateInfo(name, source string, cert *tls.Certificate) (*CertificateInfo, error) {
+	leaf, err := parseTLSCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := sha256.Sum256(leaf.Raw)
+	publicKey := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return &CertificateInfo{
+		Name:              name,
+		Source:            source,
+		Subject:           leaf.Subject.String(),
+		Issuer:            leaf.Issuer.String(),
+		SerialNumber:      leaf.SerialNumber.String(),
+		NotBefore:         leaf.NotBefore,
+		NotAfter:          leaf.NotAfter,
+		DNSNames:          leaf.DNSNames,
+		IPAddresses:       leaf.IPAddresses,
+		KeyType:           keyTypeOf(leaf),
+		SHA256Fingerprint: hex.EncodeToString(fingerprint[:]),
+		PublicKeySHA256:   hex.EncodeToString(publicKey[:]),
+	}, nil
+}
+
+// Certificates describes every certificate currently served: the default
+// certificate, certificate entries and on-demand certificates, in that order
+func (m *Manager) Certificates() []CertificateInfo {
+	entryNames := make(map[string]string, len(m.entries))
+	for _, entry := range m.entries {
+		entryNames[entry.id] = strings.Join(entry.config.Names, ",")
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var infos []CertificateInfo
+	for id, cert := range m.certCache {
+		name, source := id, SourceDefault
+		switch {
+		case strings.HasPrefix(id, entryPrefix):
+			name, source = entryNames[id], SourceEntry
+		case strings.HasPrefix(id, onDemandPrefix):
+			name, source = strings.TrimPrefix(id, onDemandPrefix), SourceOnDemand
+		}
+
+		info, err := certificateInfo(name, source, cert)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, *info)
+	}
+
+	order := map[string]int{SourceDefault: 0, SourceEntry: 1, SourceOnDemand: 2}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Source != infos[j].Source {
+			return order[infos[i].Source] < order[infos[j].Source]
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
@@ -0,0 +1,67 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+)
+
+// The functions below read what NewManager would use without changing
+// anything: they never generate, issue or fetch certificates, create files
+// or directories, or start background work.
+
+// LoadCertificate reads the default certificate of cfg: the certificate
+// files, or the cached generated or ACME certificate
+// It fails if the certificate has not been generated or issued yet.
+func LoadCertificate(cfg *Config) (*tls.Certificate, error) {
+	c := *cfg
+	if err := applyDefaults(&c); err != nil {
+		return nil, err
+	}
+
+	if !c.AutoGenerate && !c.ACME.Enabled {
+		return loadCertificateFromFiles(c.CertFile, c.KeyFile)
+	}
+
+	issuer := "self-signed"
+	if c.CA.Enabled && !c.ACME.Enabled {
+		caCert, err := readCACertificate(filepath.Join(c.CA.Dir, caCertFile))
+		if err != nil {
+			return nil, err
+		}
+		issuer = "ca-" + (&CA{cert: caCert}).Fingerprint()
+	}
+
+	key := defaultCacheKey(&c, issuer)
+	cert, err := loadCertificateFromCache(c.CacheDir, key)
+	if err != nil {
+		return nil, fmt.Errorf("no certificate %s in %s: %w", key, c.CacheDir, err)
+	}
+	return cert, nil
+}
+
+// ReadCA reads the root certificate of the local CA of cfg without its
+// key; the result can be exported but cannot issue certificates
+func ReadCA(cfg *Config) (*CA, error) {
+	c := *cfg
+	if err := applyDefaults(&c); err != nil {
+		return nil, err
+	}
+	cert, err := readCACertificate(filepath.Join(c.CA.Dir, caCertFile))
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert}, nil
+}
+
+// DescribeCertificate returns information about a default certificate
+// returned by LoadCertificate
+func DescribeCertificate(cert *tls.Certificate) (*CertificateInfo, error) {
+	return certificateInfo("default", SourceDefault, cert)
+}
+
+// EncodePEM returns the certificate chain and private key of cert in PEM
+// format
+func EncodePEM(cert *tls.Certificate) ([]byte, []byte, error) {
+	return encodeCertificateToPEM(cert)
+}
@@ -1,24 +1,73 @@
 package ssl
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Manager manages SSL certificates for the proxy server
 type Manager struct {
-	config    *Config
-	certCache map[string]*tls.Certificate
-	mutex     sync.RWMutex
-	rotationDone chan struct{}
+	config     *Config
+	certCache  map[string]*tls.Certificate
+	mutex      sync.RWMutex
+	cacheKey   string
+	background bool
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	// ca issues leaf certificates when CA mode is enabled
+	ca *CA
+
+	// issueMutex serializes on-demand issuance
+	issueMutex    sync.Mutex
+	onDemandCount int
+
+	// acme obtains certificates from an ACME CA when enabled; acmeIssued is
+	// false while a temporary certificate is served before first issuance
+	acme       *acmeIssuer
+	acmeIssued bool
+
+	// loads counts loads of externally managed certificate files, and
+	// rotations replacements of generated and ACME certificates
+	loads     loadStats
+	rotations loadStats
+
+	// entries are the configured per-name certificates, indexed by names
+	entries    []*certEntry
+	names      sniIndex
+	selections selectionStats
+
+	// issuer identifies who signs generated certificates, for cache keys
+	issuer string
+
+	// tls holds the parsed TLS policy and tickets the session ticket keys,
+	// nil when session tickets are disabled
+	tls     *tlsParams
+	tickets *ticketKeys
+
+	// clientAuth verifies client certificates, nil when disabled
+	clientAuth *clientAuth
 }
 
+// acmeInitialDelay gives the server time to start listening before the
+// first ACME order, so the CA can reach the challenge responses
+const acmeInitialDelay = 5 * time.Second
+
+// maxOnDemandCertificates caps how many per-SNI certificates are kept, so
+// clients cannot make the proxy issue certificates without bound
+const maxOnDemandCertificates = 1000
+
+// onDemandPrefix prefixes per-SNI entries in the certificate cache
+const onDemandPrefix = "sni:"
+
 // Config holds SSL manager configuration
 type Config struct {
 	// AutoGenerate enables automatic certificate generation
@@ -47,6 +96,30 @@ type Config struct {
 
 	// RotationCheckInterval is how often to check for expiring certificates
 	RotationCheckInterval time.Duration
+
+	// WatchInterval is how often cert_file and key_file are checked for
+	// changes when certificates are not auto-generated; 0 disables reloading
+	WatchInterval time.Duration
+
+	// Certificates are served by SNI server name; other names get the
+	// default certificate
+	Certificates []CertificateEntry
+
+	// CA configures the optional local certificate authority
+	CA CAConfig
+
+	// ACME configures certificate issuance from an ACME CA
+	ACME ACMEConfig
+
+	// KeyType is the key algorithm of generated certificates; see
+	// ParseKeyType. Defaults to DefaultKeyType
+	KeyType string
+
+	// TLS configures the protocol parameters of GetTLSConfig
+	TLS TLSPolicy
+
+	// ClientAuth configures client certificate authentication
+	ClientAuth ClientAuthConfig
 }
 
 // NewManager creates a new SSL certificate manager
@@ -55,63 +128,207 @@ func NewManager(cfg *Config) (*Manager, error) {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
-	// Set defaults
-	if cfg.ValidityDays == 0 {
-		cfg.ValidityDays = 365
+	if err := applyDefaults(cfg); err != nil {
+		return nil, err
 	}
-	if cfg.RotationCheckInterval == 0 {
-		cfg.RotationCheckInterval = 24 * time.Hour
+
+	params, err := compileTLSPolicy(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS policy: %w", err)
 	}
-	if cfg.CacheDir == "" {
-		homeDir, _ := os.UserHomeDir()
-		cfg.CacheDir = filepath.Join(homeDir, ".whatsapp-proxy", "certs")
+
+	clientAuth, err := newClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up client authentication: %w", err)
 	}
 
 	m := &Manager{
-		config:       cfg,
-		certCache:    make(map[string]*tls.Certificate),
-		rotationDone: make(chan struct{}),
+		config:     cfg,
+		certCache:  make(map[string]*tls.Certificate),
+		done:       make(chan struct{}),
+		tls:        params,
+		clientAuth: clientAuth,
 	}
 
 	// Create cache directory if auto-generating
-	if cfg.AutoGenerate {
+	if cfg.AutoGenerate || cfg.ACME.Enabled || m.hasGeneratedEntries() {
 		if err := os.MkdirAll(cfg.CacheDir, 0755); err != nil {
 			return nil, fmt.Errorf("failed to create cache directory: %w", err)
 		}
 	}
 
+	// Load or create the local CA; leaf certificates are then issued by it
+	issuer := "self-signed"
+	if cfg.CA.Enabled && (cfg.AutoGenerate || m.hasGeneratedEntries()) {
+		if cfg.CA.ValidityDays == 0 {
+			cfg.CA.ValidityDays = 3650
+		}
+		if cfg.CA.LeafValidityDays == 0 {
+			cfg.CA.LeafValidityDays = 30
+		}
+
+		ca, err := LoadOrCreateCA(cfg.CA.Dir, cfg.CA.Passphrase, cfg.CA.ValidityDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA: %w", err)
+		}
+		m.ca = ca
+		issuer = "ca-" + ca.Fingerprint()
+	}
+	m.issuer = issuer
+	m.cacheKey = defaultCacheKey(cfg, issuer)
+
+	// ACME replaces generated and file-based certificates
+	if cfg.ACME.Enabled {
+		if len(cfg.ACME.Challenges) == 0 {
+			cfg.ACME.Challenges = []string{ChallengeTLSALPN01, ChallengeHTTP01}
+		}
+		if cfg.ACME.RenewBeforeDays == 0 {
+			cfg.ACME.RenewBeforeDays = 30
+		}
+		if len(cfg.ACME.Domains) == 0 {
+			return nil, fmt.Errorf("ACME requires at least one domain")
+		}
+
+		issuer, err := newACMEIssuer(cfg.ACME, cfg.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		m.acme = issuer
+	}
+
 	// Load or generate initial certificate
 	if err := m.initialize(); err != nil {
 		return nil, err
 	}
+	if err := m.setupEntries(); err != nil {
+		return nil, err
+	}
 
-	// Start rotation goroutine if enabled
-	if cfg.EnableRotation && cfg.AutoGenerate {
+	// Start rotation goroutine if enabled; short-lived CA leaves and ACME
+	// certificates always renew
+	if (cfg.EnableRotation || m.ca != nil) && (cfg.AutoGenerate || m.hasGeneratedEntries()) || m.acme != nil {
+		m.background = true
 		go m.rotationLoop()
 	}
 
+	// Watch externally managed certificate files
+	if pairs := m.filePairs(); cfg.WatchInterval > 0 && len(pairs) > 0 {
+		states := make([]fileState, len(pairs))
+		for i, pair := range pairs {
+			state, err := statCertificateFiles(pair.certFile, pair.keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat certificate files: %w", err)
+			}
+			states[i] = state
+		}
+		m.background = true
+		go m.watchLoop(pairs, states)
+	}
+
+	// Session ticket keys rotate, or follow the shared key file
+	if !cfg.TLS.SessionTickets.Disabled {
+		tickets, err := newTicketKeys(cfg.TLS.SessionTickets)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("failed to set up session ticket keys: %w", err)
+		}
+		m.tickets = tickets
+		m.background = true
+		go m.ticketLoop()
+	}
+
+	// Follow revocation list updates
+	if clientAuth != nil && len(cfg.ClientAuth.CRLFiles) > 0 && cfg.WatchInterval > 0 {
+		m.background = true
+		go m.crlLoop()
+	}
+
 	return m, nil
 }
 
+// applyDefaults fills in unset settings, including those the cache key and
+// the CA directory derive from
+func applyDefaults(cfg *Config) error {
+	if cfg.ValidityDays == 0 {
+		cfg.ValidityDays = 365
+	}
+	if cfg.RotationCheckInterval == 0 {
+		cfg.RotationCheckInterval = 24 * time.Hour
+	}
+	if cfg.CacheDir == "" {
+		homeDir, _ := os.UserHomeDir()
+		cfg.CacheDir = filepath.Join(homeDir, ".whatsapp-proxy", "certs")
+	}
+	if cfg.KeyType == "" {
+		cfg.KeyType = DefaultKeyType
+	}
+	keyType, err := ParseKeyType(cfg.KeyType)
+	if err != nil {
+		return err
+	}
+	cfg.KeyType = keyType
+
+	if cfg.CA.Dir == "" {
+		cfg.CA.Dir = filepath.Join(cfg.CacheDir, "ca")
+	}
+	if cfg.ACME.Enabled {
+		if cfg.ACME.DirectoryURL == "" {
+			cfg.ACME.DirectoryURL = LetsEncryptURL
+		}
+		if len(cfg.ACME.Domains) == 0 {
+			cfg.ACME.Domains = cfg.DNSNames
+		}
+	}
+	return nil
+}
+
+// defaultCacheKey returns the cache key of the default certificate; issuer
+// is "self-signed" or "ca-" and the local CA's fingerprint
+func defaultCacheKey(cfg *Config, issuer string) string {
+	if cfg.ACME.Enabled {
+		return cacheKey(cfg.ACME.Domains, nil, "ecdsa-P-256", "acme-"+cfg.ACME.DirectoryURL)
+	}
+	return cacheKey(cfg.DNSNames, cfg.IPAddresses, cfg.KeyType, issuer)
+}
+
 // initialize loads or generates the initial certificate
 func (m *Manager) initialize() error {
+	if m.acme != nil {
+		defer m.collectGarbage()
+
+		cacheKey := m.getCacheKey()
+		cachedCert, err := loadCertificateFromCache(m.config.CacheDir, cacheKey)
+		if err == nil && !isCertificateExpiringSoon(cachedCert, m.renewBeforeDays()) {
+			log.Printf("[INFO] Loaded ACME certificate %s from cache", cacheKey)
+			m.certCache["default"] = cachedCert
+			m.acmeIssued = true
+			return nil
+		}
+
+		// Serve a short-lived placeholder until the first order completes
+		log.Printf("[INFO] No valid ACME certificate cached, serving a temporary self-signed certificate until issuance completes")
+		cert, err := generateSelfSignedCertificate(m.config.ACME.Domains, nil, 7)
+		if err != nil {
+			return fmt.Errorf("failed to generate certificate: %w", err)
+		}
+		m.certCache["default"] = cert
+		return nil
+	}
+
 	if m.config.AutoGenerate {
+		defer m.collectGarbage()
+
 		// Try to load from cache first
 		cacheKey := m.getCacheKey()
 		cachedCert, err := loadCertificateFromCache(m.config.CacheDir, cacheKey)
-		if err == nil && !isCertificateExpiringSoon(cachedCert, 30) {
-			log.Printf("[INFO] Loaded certificate from cache")
+		if err == nil && !isCertificateExpiringSoon(cachedCert, m.renewBeforeDays()) {
+			log.Printf("[INFO] Loaded certificate %s from cache", cacheKey)
 			m.certCache["default"] = cachedCert
 			return nil
 		}
 
 		// Generate new certificate
-		log.Printf("[INFO] Generating new self-signed certificate")
-		cert, err := generateSelfSignedCertificate(
-			m.config.DNSNames,
-			m.config.IPAddresses,
-			m.config.ValidityDays,
-		)
+		cert, err := m.generate(m.config.DNSNames, m.config.IPAddresses)
 		if err != nil {
 			return fmt.Errorf("failed to generate certificate: %w", err)
 		}
@@ -128,11 +345,16 @@ func (m *Manager) initialize() error {
 		log.Printf("[INFO] Loading custom certificate from %s", m.config.CertFile)
 		cert, err := loadCertificateFromFiles(m.config.CertFile, m.config.KeyFile)
 		if err != nil {
+			m.loads.record(false)
 			return fmt.Errorf("failed to load certificate: %w", err)
 		}
+		if time.Now().After(cert.Leaf.NotAfter) {
+			log.Printf("[WARN] Certificate %s expired on %s", m.config.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+		}
 
 		m.certCache["default"] = cert
-		log.Printf("[INFO] Custom certificate loaded successfully")
+		m.loads.record(true)
+		logCertificate("Loaded", cert)
 	}
 
 	return nil
@@ -141,6 +363,25 @@ func (m *Manager) initialize() error {
 // GetCertificate returns a certificate for the given ClientHello
 // This implements the tls.Config.GetCertificate callback
 func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	// TLS-ALPN-01 validation handshakes get the challenge certificate
+	if m.acme != nil && hello != nil && isTLSALPNChallenge(hello.SupportedProtos) {
+		if cert, ok := m.acme.alpnCertificate(hello.ServerName); ok {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("no ACME challenge pending for %q", hello.ServerName)
+	}
+
+	if hello != nil && hello.ServerName != "" && len(m.entries) > 0 {
+		if cert, result := m.selectEntry(hello.ServerName); cert != nil {
+			if result == SelectionExact {
+				m.selections.exact.Add(1)
+			} else {
+				m.selections.wildcard.Add(1)
+			}
+			return cert, nil
+		}
+	}
+
 	m.mutex.RLock()
 	cert, exists := m.certCache["default"]
 	m.mutex.RUnlock()
@@ -149,96 +390,344 @@ func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate,
 		return nil, fmt.Errorf("no certificate available")
 	}
 
+	if m.ca != nil && m.config.CA.OnDemand && hello != nil && hello.ServerName != "" {
+		onDemand, err := m.onDemandCertificate(hello.ServerName, cert)
+		if err != nil {
+			log.Printf("[WARN] On-demand certificate for %q failed, using default: %v", hello.ServerName, err)
+		} else if onDemand != nil {
+			m.selections.onDemand.Add(1)
+			return onDemand, nil
+		}
+	}
+
+	m.selections.fallback.Add(1)
+	return cert, nil
+}
+
+// onDemandCertificate returns a CA-issued certificate for name, or nil if
+// the default certificate already covers it
+func (m *Manager) onDemandCertificate(name string, defaultCert *tls.Certificate) (*tls.Certificate, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if defaultCert.Leaf != nil && defaultCert.Leaf.VerifyHostname(name) == nil {
+		return nil, nil
+	}
+	if !isValidServerName(name) {
+		return nil, fmt.Errorf("invalid server name")
+	}
+
+	key := onDemandPrefix + name
+	renewBefore := m.renewBeforeDays()
+
+	m.mutex.RLock()
+	cert, exists := m.certCache[key]
+	m.mutex.RUnlock()
+	if exists && !isCertificateExpiringSoon(cert, renewBefore) {
+		return cert, nil
+	}
+
+	m.issueMutex.Lock()
+	defer m.issueMutex.Unlock()
+
+	// Another handshake may have issued it while we waited
+	m.mutex.RLock()
+	cert, exists = m.certCache[key]
+	m.mutex.RUnlock()
+	if exists && !isCertificateExpiringSoon(cert, renewBefore) {
+		return cert, nil
+	}
+
+	if !exists && m.onDemandCount >= maxOnDemandCertificates {
+		return nil, fmt.Errorf("on-demand certificate limit of %d reached", maxOnDemandCertificates)
+	}
+
+	cert, err := issueCertificate([]string{name}, nil, m.config.CA.LeafValidityDays, m.config.KeyType, m.ca)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.certCache[key] = cert
+	m.mutex.Unlock()
+	if !exists {
+		m.onDemandCount++
+	}
+
+	log.Printf("[INFO] Issued on-demand certificate for %s", name)
 	return cert, nil
 }
 
-// GetTLSConfig returns a TLS configuration using this manager
+// GetTLSConfig returns a TLS configuration using this manager and the
+// configured TLS policy
 func (m *Manager) GetTLSConfig() *tls.Config {
-	return &tls.Config{
-		GetCertificate: m.GetCertificate,
-		MinVersion:     tls.VersionTLS12,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-		},
+	cfg := &tls.Config{
+		GetCertificate:           m.GetCertificate,
+		MinVersion:               m.tls.minVersion,
+		MaxVersion:               m.tls.maxVersion,
+		CipherSuites:             m.tls.cipherSuites,
+		CurvePreferences:         m.tls.curves,
+		NextProtos:               m.tls.alpn,
 		PreferServerCipherSuites: true,
 	}
+	if m.tickets != nil {
+		m.tickets.install(cfg)
+	} else {
+		cfg.SessionTicketsDisabled = true
+	}
+	if m.clientAuth != nil {
+		cfg.ClientAuth = m.clientAuth.mode
+		cfg.ClientCAs = m.clientAuth.pool
+		cfg.VerifyConnection = m.clientAuth.verifyConnection
+	}
+	return cfg
 }
 
 // RotateCertificates manually rotates certificates
+// In ACME mode a new certificate is ordered from the CA
 func (m *Manager) RotateCertificates() error {
-	if !m.config.AutoGenerate {
+	err := m.rotateCertificates()
+	m.rotations.record(err == nil)
+	return err
+}
+
+// rotateCertificates replaces the default certificate and every generated
+// entry
+func (m *Manager) rotateCertificates() error {
+	if m.acme != nil {
+		if err := m.renewACME(context.Background()); err != nil {
+			return err
+		}
+		return m.rotateEntries(true)
+	}
+
+	if !m.config.AutoGenerate && !m.hasGeneratedEntries() {
 		return fmt.Errorf("certificate rotation only available with auto-generation")
 	}
 
 	log.Println("[INFO] Rotating certificates...")
 
-	// Generate new certificate
-	cert, err := generateSelfSignedCertificate(
-		m.config.DNSNames,
-		m.config.IPAddresses,
-		m.config.ValidityDays,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to generate certificate: %w", err)
-	}
+	if m.config.AutoGenerate {
+		// Generate new certificate
+		cert, err := m.generate(m.config.DNSNames, m.config.IPAddresses)
+		if err != nil {
+			return fmt.Errorf("failed to generate certificate: %w", err)
+		}
 
-	// Update cache
-	m.mutex.Lock()
-	m.certCache["default"] = cert
-	m.mutex.Unlock()
+		// Update cache
+		m.mutex.Lock()
+		m.certCache["default"] = cert
+		m.mutex.Unlock()
 
-	// Save to disk cache
-	cacheKey := m.getCacheKey()
-	if err := saveCertificateToCache(m.config.CacheDir, cacheKey, cert); err != nil {
-		log.Printf("[WARN] Failed to cache rotated certificate: %v", err)
+		// Save to disk cache
+		cacheKey := m.getCacheKey()
+		if err := saveCertificateToCache(m.config.CacheDir, cacheKey, cert); err != nil {
+			log.Printf("[WARN] Failed to cache rotated certificate: %v", err)
+		}
 	}
 
+	if err := m.rotateEntries(true); err != nil {
+		return err
+	}
+
+	m.collectGarbage()
+
 	log.Println("[INFO] Certificate rotation complete")
 	return nil
 }
 
 // rotationLoop periodically checks for expiring certificates
 func (m *Manager) rotationLoop() {
-	ticker := time.NewTicker(m.config.RotationCheckInterval)
-	defer ticker.Stop()
+	delay := m.config.RotationCheckInterval
+	if m.needsRenewal() {
+		// Only ACME starts without a usable certificate
+		delay = acmeInitialDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			m.mutex.RLock()
-			cert, exists := m.certCache["default"]
-			m.mutex.RUnlock()
-
-			if exists && isCertificateExpiringSoon(cert, 30) {
+		case <-timer.C:
+			delay = m.config.RotationCheckInterval
+			if err := m.rotateEntries(false); err != nil {
+				log.Printf("[ERROR] Certificate rotation failed: %v", err)
+			}
+			if m.needsRenewal() {
 				log.Println("[INFO] Certificate expiring soon, rotating...")
 				if err := m.RotateCertificates(); err != nil {
 					log.Printf("[ERROR] Certificate rotation failed: %v", err)
+					if m.acme != nil && delay > acmeRetryInterval {
+						delay = acmeRetryInterval
+					}
 				}
 			}
-		case <-m.rotationDone:
+			timer.Reset(delay)
+		case <-m.done:
 			return
 		}
 	}
 }
 
+// needsRenewal reports whether the default certificate must be replaced
+func (m *Manager) needsRenewal() bool {
+	if !m.config.AutoGenerate && m.acme == nil {
+		// Certificates loaded from files are renewed externally
+		return false
+	}
+
+	m.mutex.RLock()
+	cert, exists := m.certCache["default"]
+	pending := m.acme != nil && !m.acmeIssued
+	m.mutex.RUnlock()
+
+	return pending || (exists && isCertificateExpiringSoon(cert, m.renewBeforeDays()))
+}
+
+// renewACME orders a new certificate from the ACME CA and installs it
+func (m *Manager) renewACME(ctx context.Context) error {
+	m.issueMutex.Lock()
+	defer m.issueMutex.Unlock()
+
+	log.Printf("[INFO] Requesting ACME certificate for %s from %s",
+		strings.Join(m.config.ACME.Domains, ", "), m.config.ACME.DirectoryURL)
+
+	cert, err := m.acme.obtain(ctx, m.config.ACME.Domains)
+	if err != nil {
+		return fmt.Errorf("ACME issuance failed: %w", err)
+	}
+
+	m.mutex.Lock()
+	m.certCache["default"] = cert
+	m.acmeIssued = true
+	m.mutex.Unlock()
+
+	if err := saveCertificateToCache(m.config.CacheDir, m.getCacheKey(), cert); err != nil {
+		log.Printf("[WARN] Failed to cache ACME certificate: %v", err)
+	}
+	m.collectGarbage()
+
+	log.Printf("[INFO] ACME certificate issued, valid until %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// ACMEEnabled reports whether certificates are obtained from an ACME CA
+func (m *Manager) ACMEEnabled() bool {
+	return m.acme != nil
+}
+
+// HTTPChallengeResponse returns the response for an HTTP-01 challenge token
+func (m *Manager) HTTPChallengeResponse(token string) (string, bool) {
+	if m.acme == nil {
+		return "", false
+	}
+	return m.acme.httpResponse(token)
+}
+
+// HasTLSALPNChallenge reports whether a TLS-ALPN-01 challenge is pending
+// for serverName
+func (m *Manager) HasTLSALPNChallenge(serverName string) bool {
+	if m.acme == nil {
+		return false
+	}
+	_, ok := m.acme.alpnCertificate(serverName)
+	return ok
+}
+
+// ChallengeTLSConfig returns a TLS configuration for answering TLS-ALPN-01
+// validation handshakes
+func (m *Manager) ChallengeTLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{ACMETLSALPNProtocol},
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// isTLSALPNChallenge reports whether the offered protocols are exactly the
+// ACME TLS-ALPN-01 protocol, as the CA sends them
+func isTLSALPNChallenge(protos []string) bool {
+	return len(protos) == 1 && protos[0] == ACMETLSALPNProtocol
+}
+
 // Close stops the certificate manager
 func (m *Manager) Close() error {
-	if m.config.EnableRotation {
-		close(m.rotationDone)
-	}
+	m.closeOnce.Do(func() {
+		if m.background {
+			close(m.done)
+		}
+	})
 	return nil
 }
 
-// getCacheKey generates a cache key based on configuration
+// ExportPEM returns the current certificate chain and private key in PEM format
+func (m *Manager) ExportPEM() ([]byte, []byte, error) {
+	m.mutex.RLock()
+	cert, exists := m.certCache["default"]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, nil, fmt.Errorf("no certificate available")
+	}
+
+	return encodeCertificateToPEM(cert)
+}
+
+// generate creates a certificate for the given names, issued by the local CA
+// if enabled and self-signed otherwise
+func (m *Manager) generate(dnsNames []string, ipAddresses []net.IP) (*tls.Certificate, error) {
+	if m.ca != nil {
+		log.Printf("[INFO] Issuing new certificate from local CA")
+	} else {
+		log.Printf("[INFO] Generating new self-signed certificate")
+	}
+	return issueCertificate(dnsNames, ipAddresses, m.leafValidityDays(), m.config.KeyType, m.ca)
+}
+
+// leafValidityDays returns the validity period of generated certificates
+func (m *Manager) leafValidityDays() int {
+	if m.ca != nil {
+		return m.config.CA.LeafValidityDays
+	}
+	return m.config.ValidityDays
+}
+
+// renewBeforeDays returns how many days before expiry a generated
+// certificate is replaced: a third of its lifetime, at most 30 days
+func (m *Manager) renewBeforeDays() int {
+	if m.acme != nil {
+		return m.config.ACME.RenewBeforeDays
+	}
+
+	days := m.leafValidityDays() / 3
+	if days > 30 {
+		days = 30
+	}
+	if days < 1 {
+		days = 1
+	}
+	return days
+}
+
+// CA returns the local certificate authority, or nil if CA mode is disabled
+func (m *Manager) CA() *CA {
+	return m.ca
+}
+
+// getCacheKey returns the cache key derived from the configured SANs and
+// key parameters
 func (m *Manager) getCacheKey() string {
-	// Simple key based on DNS names and IPs
-	// In production, you might want a more sophisticated key
-	return "default"
+	return m.cacheKey
+}
+
+// collectGarbage removes stale cache entries, keeping the current one
+func (m *Manager) collectGarbage() {
+	removed, err := gcCache(m.config.CacheDir, m.getCacheKey())
+	if err != nil {
+		log.Printf("[WARN] Certificate cache cleanup failed: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("[INFO] Removed %d stale certificate cache file(s)", removed)
+	}
 }
 
 // GetCertificateInfo returns information about the current certificate
@@ -251,28 +740,33 @@ func (m *Manager) GetCertificateInfo() *CertificateInfo {
 		return nil
 	}
 
-	// Parse the certificate
-	x509Cert, err := parseTLSCertificate(cert)
+	info, err := certificateInfo("default", SourceDefault, cert)
 	if err != nil {
 		return nil
 	}
-
-	return &CertificateInfo{
-		Subject:    x509Cert.Subject.String(),
-		Issuer:     x509Cert.Issuer.String(),
-		NotBefore:  x509Cert.NotBefore,
-		NotAfter:   x509Cert.NotAfter,
-		DNSNames:   x509Cert.DNSNames,
-		IPAddresses: x509Cert.IPAddresses,
-	}
+	return info
 }
 
 // CertificateInfo holds certificate information
 type CertificateInfo struct {
-	Subject     string
-	Issuer      string
-	NotBefore   time.Time
-	NotAfter    time.Time
-	DNSNames    []string
-	IPAddresses []net.IP
+	// Name identifies the certificate: "default", the names of a
+	// certificate entry, or the server name of an on-demand certificate
+	Name string `json:"name"`
+
+	// Source is SourceDefault, SourceEntry or SourceOnDemand
+	Source string `json:"source"`
+
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	DNSNames     []string  `json:"dns_names"`
+	IPAddresses  []net.IP  `json:"ip_addresses"`
+	KeyType      string    `json:"key_type"`
+
+	// SHA256Fingerprint is the hex SHA-256 digest of the certificate, and
+	// PublicKeySHA256 that of its public key (as used for key pinning)
+	SHA256Fingerprint string `json:"sha256_fingerprint"`
+	PublicKeySHA256   string `json:"public_key_sha256"`
 }
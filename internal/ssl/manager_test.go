@@ -1,12 +1,23 @@
 package ssl
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 func TestNewManager(t *testing.T) {
@@ -314,6 +325,948 @@ func TestCacheDirectory(t *testing.T) {
 	}
 }
 
+func TestLoadCertificateReadOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		ca   CAConfig
+	}{
+		{name: "self-signed"},
+		{name: "local CA", ca: CAConfig{Enabled: true, Passphrase: "test passphrase"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := filepath.Join(t.TempDir(), "certs")
+			cfg := func() *Config {
+				return &Config{AutoGenerate: true, DNSNames: []string{"localhost"}, ValidityDays: 365, CacheDir: cacheDir, CA: tt.ca}
+			}
+
+			// Nothing is generated or created before the manager runs
+			if _, err := LoadCertificate(cfg()); err == nil {
+				t.Fatal("LoadCertificate() before generation should fail")
+			}
+			if _, err := ReadCA(cfg()); err == nil {
+				t.Fatal("ReadCA() before generation should fail")
+			}
+			if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+				t.Fatalf("cache directory created by a read: %v", err)
+			}
+
+			manager, err := NewManager(cfg())
+			if err != nil {
+				t.Fatalf("NewManager() error = %v", err)
+			}
+			defer manager.Close()
+
+			cert, err := LoadCertificate(cfg())
+			if err != nil {
+				t.Fatalf("LoadCertificate() error = %v", err)
+			}
+			info, err := DescribeCertificate(cert)
+			if err != nil {
+				t.Fatalf("DescribeCertificate() error = %v", err)
+			}
+			if want := manager.GetCertificateInfo().SHA256Fingerprint; info.SHA256Fingerprint != want {
+				t.Errorf("loaded certificate %s, manager serves %s", info.SHA256Fingerprint, want)
+			}
+
+			if manager.CA() != nil {
+				ca, err := ReadCA(cfg())
+				if err != nil {
+					t.Fatalf("ReadCA() error = %v", err)
+				}
+				if ca.Fingerprint() != manager.CA().Fingerprint() {
+					t.Error("ReadCA() returned another root")
+				}
+			}
+		})
+	}
+}
+
+func TestExportPEMAndCacheReload(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg := &Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"localhost"},
+		ValidityDays: 365,
+		CacheDir:     tmpDir,
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	certPEM, keyPEM, err := manager.ExportPEM()
+	if err != nil {
+		t.Fatalf("ExportPEM() error = %v", err)
+	}
+
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatalf("exported PEM is not a valid key pair: %v", err)
+	}
+
+	// A second manager must load the cached certificate instead of generating
+	reloaded, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"localhost"},
+		ValidityDays: 365,
+		CacheDir:     tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer reloaded.Close()
+
+	reloadedPEM, _, err := reloaded.ExportPEM()
+	if err != nil {
+		t.Fatalf("ExportPEM() error = %v", err)
+	}
+	if string(reloadedPEM) != string(certPEM) {
+		t.Error("expected the cached certificate to be reused")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	localhost := net.ParseIP("127.0.0.1")
+
+	key := cacheKey([]string{"a.example", "b.example"}, []net.IP{localhost}, DefaultKeyType, "self-signed")
+
+	if got := cacheKey([]string{"B.example", "a.example"}, []net.IP{localhost}, DefaultKeyType, "self-signed"); got != key {
+		t.Errorf("cache key depends on SAN order or case: %s != %s", got, key)
+	}
+	if got := cacheKey([]string{"a.example"}, []net.IP{localhost}, DefaultKeyType, "self-signed"); got == key {
+		t.Error("cache key should change when DNS names change")
+	}
+	if got := cacheKey([]string{"a.example", "b.example"}, nil, DefaultKeyType, "self-signed"); got == key {
+		t.Error("cache key should change when IP addresses change")
+	}
+	if got := cacheKey([]string{"a.example", "b.example"}, []net.IP{localhost}, "ecdsa-P-256", "self-signed"); got == key {
+		t.Error("cache key should change when the key type changes")
+	}
+	if got := cacheKey([]string{"a.example", "b.example"}, []net.IP{localhost}, DefaultKeyType, "ca-1234"); got == key {
+		t.Error("cache key should change when the issuer changes")
+	}
+}
+
+func TestCacheChangedSANs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	first, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"old.example"},
+		ValidityDays: 365,
+		CacheDir:     tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	first.Close()
+
+	second, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"new.example"},
+		ValidityDays: 365,
+		CacheDir:     tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer second.Close()
+
+	info := second.GetCertificateInfo()
+	if len(info.DNSNames) != 1 || info.DNSNames[0] != "new.example" {
+		t.Errorf("DNS names = %v, want [new.example]", info.DNSNames)
+	}
+
+	// Both entries are valid and kept, each with metadata
+	meta, err := readCacheMetadata(filepath.Join(tmpDir, second.getCacheKey()+metaExt))
+	if err != nil {
+		t.Fatalf("readCacheMetadata() error = %v", err)
+	}
+	if meta.KeyType != DefaultKeyType || len(meta.DNSNames) != 1 || meta.DNSNames[0] != "new.example" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if _, err := loadCertificateFromCache(tmpDir, first.getCacheKey()); err != nil {
+		t.Errorf("previous entry should still be cached: %v", err)
+	}
+}
+
+func TestCacheGarbageCollection(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	expired, err := generateSelfSignedCertificate([]string{"expired.example"}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredKey := cacheKey([]string{"expired.example"}, nil, DefaultKeyType, "self-signed")
+	if err := saveCertificateToCache(tmpDir, expiredKey, expired); err != nil {
+		t.Fatalf("saveCertificateToCache() error = %v", err)
+	}
+
+	// Backdate the metadata so the entry counts as expired
+	metaPath := filepath.Join(tmpDir, expiredKey+metaExt)
+	meta, _ := readCacheMetadata(metaPath)
+	meta.NotAfter = time.Now().Add(-time.Hour)
+	data, _ := json.Marshal(meta)
+	os.WriteFile(metaPath, data, 0644)
+
+	// Leftovers: an incomplete entry, the old fixed-name cache and a stale temp file
+	os.WriteFile(filepath.Join(tmpDir, cachePrefix+"incomplete"+certExt), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "default"+certExt), []byte("x"), 0644)
+	tmpFile := filepath.Join(tmpDir, tmpPrefix+"abandoned")
+	os.WriteFile(tmpFile, []byte("x"), 0600)
+	old := time.Now().Add(-2 * staleTempAge)
+	os.Chtimes(tmpFile, old, old)
+
+	manager, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"localhost"},
+		ValidityDays: 365,
+		CacheDir:     tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	key := manager.getCacheKey()
+	want := []string{key + certExt, key + metaExt, key + keyExt}
+	sort.Strings(want)
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("cache directory = %v, want %v", names, want)
+	}
+}
+
+func TestEncryptedPrivateKeyRoundTrip(t *testing.T) {
+	ca, err := createCA(1)
+	if err != nil {
+		t.Fatalf("createCA() error = %v", err)
+	}
+
+	data, err := encryptPrivateKey(ca.key, "correct horse")
+	if err != nil {
+		t.Fatalf("encryptPrivateKey() error = %v", err)
+	}
+
+	key, err := decryptPrivateKey(data, "correct horse")
+	if err != nil {
+		t.Fatalf("decryptPrivateKey() error = %v", err)
+	}
+	if !publicKeysEqual(ca.key.Public(), key.Public()) {
+		t.Error("decrypted key does not match")
+	}
+
+	if _, err := decryptPrivateKey(data, "wrong passphrase"); err == nil {
+		t.Error("decryptPrivateKey() should fail with a wrong passphrase")
+	}
+}
+
+// withIterationCount re-encodes an encrypted key with another PBKDF2
+// iteration count
+func withIterationCount(t *testing.T, data []byte, iterations int) []byte {
+	t.Helper()
+
+	p, _ := pem.Decode(data)
+	var info encryptedPrivateKeyInfo
+	var scheme pbes2Params
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(p.Bytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &scheme); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(scheme.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+
+	kdf.IterationCount = iterations
+	kdfParams, err := asn1.Marshal(kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheme.KeyDerivationFunc.Parameters = asn1.RawValue{FullBytes: kdfParams}
+	schemeParams, err := asn1.Marshal(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Algorithm.Parameters = asn1.RawValue{FullBytes: schemeParams}
+	encoded, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: encryptedKeyPEMType, Bytes: encoded})
+}
+
+func TestEncryptedPrivateKeyIterationBounds(t *testing.T) {
+	ca, err := createCA(1)
+	if err != nil {
+		t.Fatalf("createCA() error = %v", err)
+	}
+	data, err := encryptPrivateKey(ca.key, "correct horse")
+	if err != nil {
+		t.Fatalf("encryptPrivateKey() error = %v", err)
+	}
+
+	for _, iterations := range []int{0, -1, maxPBKDF2Iterations + 1} {
+		_, err := decryptPrivateKey(withIterationCount(t, data, iterations), "correct horse")
+		if err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("iterations %d: decryptPrivateKey() error = %v, want out of range", iterations, err)
+		}
+	}
+}
+
+func newCAManager(t *testing.T, dir string, onDemand bool) *Manager {
+	t.Helper()
+
+	manager, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"proxy.example"},
+		ValidityDays: 365,
+		CacheDir:     dir,
+		CA: CAConfig{
+			Enabled:    true,
+			Passphrase: "test passphrase",
+			OnDemand:   onDemand,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	return manager
+}
+
+func TestCAIssuesTrustedLeaves(t *testing.T) {
+	tmpDir := t.TempDir()
+	manager := newCAManager(t, tmpDir, true)
+
+	ca := manager.CA()
+	if ca == nil {
+		t.Fatal("CA() = nil with CA mode enabled")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "proxy.example"})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "proxy.example", Roots: roots}); err != nil {
+		t.Errorf("leaf does not verify against the root: %v", err)
+	}
+	if days := cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore).Hours() / 24; days > 30.5 {
+		t.Errorf("leaf validity = %.0f days, want 30", days)
+	}
+
+	// Names outside the configured set get their own certificate
+	other, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "Other.Example."})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	if other == cert {
+		t.Fatal("expected an on-demand certificate for other.example")
+	}
+	if _, err := other.Leaf.Verify(x509.VerifyOptions{DNSName: "other.example", Roots: roots}); err != nil {
+		t.Errorf("on-demand leaf does not verify: %v", err)
+	}
+	again, _ := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example"})
+	if again != other {
+		t.Error("on-demand certificate should be reused")
+	}
+
+	// The root persists and leaves are reused across restarts
+	manager.Close()
+	reloaded := newCAManager(t, tmpDir, false)
+	if reloaded.CA().Fingerprint() != ca.Fingerprint() {
+		t.Error("root CA was not reused")
+	}
+	reloadedCert, _ := reloaded.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example"})
+	if !reloadedCert.Leaf.Equal(cert.Leaf) {
+		t.Error("without on-demand the cached default leaf should be served")
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(tmpDir, "ca", caKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(keyPEM), encryptedKeyPEMType) {
+		t.Error("root key is not stored encrypted")
+	}
+}
+
+func TestCAWrongPassphrase(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := LoadOrCreateCA(tmpDir, "first passphrase", 10); err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	if _, err := LoadOrCreateCA(tmpDir, "second passphrase", 10); err == nil {
+		t.Error("LoadOrCreateCA() should fail with a wrong passphrase")
+	}
+
+	// A missing key must not silently replace the root
+	os.Remove(filepath.Join(tmpDir, caKeyFile))
+	if _, err := LoadOrCreateCA(tmpDir, "first passphrase", 10); err == nil {
+		t.Error("LoadOrCreateCA() should fail when the key is missing")
+	}
+}
+
+func TestCAExportFormats(t *testing.T) {
+	ca, err := LoadOrCreateCA(t.TempDir(), "test passphrase", 10)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	block, _ := pem.Decode(ca.PEM())
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatal("PEM() did not return a certificate")
+	}
+	if !bytes.Equal(block.Bytes, ca.DER()) {
+		t.Error("PEM and DER exports differ")
+	}
+
+	p12, err := ca.PKCS12("export")
+	if err != nil {
+		t.Fatalf("PKCS12() error = %v", err)
+	}
+	certs, err := pkcs12.DecodeTrustStore(p12, "export")
+	if err != nil {
+		t.Fatalf("DecodeTrustStore() error = %v", err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(ca.Certificate()) {
+		t.Error("PKCS#12 trust store does not contain the root")
+	}
+}
+
+// writeCertificateFiles writes cert as PEM certificate and key files
+func writeCertificateFiles(t *testing.T, certPath, keyPath string, cert *tls.Certificate) {
+	t.Helper()
+
+	certPEM, keyPEM, err := encodeCertificateToPEM(cert)
+	if err != nil {
+		t.Fatalf("encodeCertificateToPEM() error = %v", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForLoads waits until the manager has recorded n load attempts
+func waitForLoads(t *testing.T, manager *Manager, n uint64) Status {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status := manager.Status()
+		if status.LoadSuccess+status.LoadFailure >= n {
+			return status
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d certificate loads", n)
+	return Status{}
+}
+
+func TestCertificateFileReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+
+	original, err := generateSelfSignedCertificate([]string{"old.example"}, nil, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertificateFiles(t, certPath, keyPath, original)
+
+	manager, err := NewManager(&Config{
+		CertFile:      certPath,
+		KeyFile:       keyPath,
+		CacheDir:      tmpDir,
+		WatchInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	status := manager.Status()
+	if status.LoadSuccess != 1 || !status.LastLoadOK || !status.NotAfter.Equal(original.Leaf.NotAfter) {
+		t.Fatalf("initial Status() = %+v", status)
+	}
+
+	// A certificate that does not match the key must not replace the working pair
+	mismatched, err := generateSelfSignedCertificate([]string{"broken.example"}, nil, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := encodeCertificateToPEM(mismatched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status = waitForLoads(t, manager, 2)
+	if status.LoadFailure != 1 || status.LastLoadOK {
+		t.Errorf("Status() after broken pair = %+v", status)
+	}
+	if cert, _ := manager.GetCertificate(nil); cert.Leaf.DNSNames[0] != "old.example" {
+		t.Errorf("broken pair replaced the active certificate: %v", cert.Leaf.DNSNames)
+	}
+
+	// A valid pair is swapped in
+	renewed, err := generateSelfSignedCertificate([]string{"new.example"}, nil, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertificateFiles(t, certPath, keyPath, renewed)
+
+	status = waitForLoads(t, manager, 3)
+	if status.LoadSuccess != 2 || !status.LastLoadOK || !status.NotAfter.Equal(renewed.Leaf.NotAfter) {
+		t.Errorf("Status() after renewal = %+v", status)
+	}
+	if cert, _ := manager.GetCertificate(nil); cert.Leaf.DNSNames[0] != "new.example" {
+		t.Errorf("GetCertificate() = %v after reload, want new.example", cert.Leaf.DNSNames)
+	}
+}
+
+func TestReloadCertificateFilesRejectsInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+
+	cert, err := generateSelfSignedCertificate([]string{"test.local"}, nil, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertificateFiles(t, certPath, keyPath, cert)
+
+	manager, err := NewManager(&Config{CertFile: certPath, KeyFile: keyPath, CacheDir: tmpDir})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	tests := []struct {
+		name    string
+		certPEM []byte
+	}{
+		{"garbage", []byte("not a certificate")},
+		{"empty", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(certPath, tt.certPEM, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := manager.ReloadCertificateFiles(); err == nil {
+				t.Error("ReloadCertificateFiles() succeeded with an invalid certificate")
+			}
+			if active, _ := manager.GetCertificate(nil); active.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+				t.Error("invalid certificate replaced the active one")
+			}
+		})
+	}
+}
+
+func TestSNISelection(t *testing.T) {
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "chat.pem")
+	keyPath := filepath.Join(tmpDir, "chat.key")
+
+	chat, err := generateSelfSignedCertificate([]string{"chat.example.com"}, nil, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertificateFiles(t, certPath, keyPath, chat)
+
+	manager, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"default.example"},
+		ValidityDays: 365,
+		CacheDir:     tmpDir,
+		Certificates: []CertificateEntry{
+			{Names: []string{"chat.example.com"}, CertFile: certPath, KeyFile: keyPath},
+			{Names: []string{"*.example.org", "example.net"}, AutoGenerate: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	tests := []struct {
+		serverName string
+		wantName   string
+	}{
+		{"chat.example.com", "chat.example.com"},
+		{"CHAT.Example.com.", "chat.example.com"},
+		{"web.example.org", "*.example.org"},
+		{"example.net", "*.example.org"},
+		{"a.b.example.org", "default.example"},
+		{"example.org", "default.example"},
+		{"other.example.com", "default.example"},
+		{"", "default.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if err != nil {
+				t.Fatalf("GetCertificate() error = %v", err)
+			}
+			if cert.Leaf.DNSNames[0] != tt.wantName {
+				t.Errorf("GetCertificate(%q) = %v, want %s", tt.serverName, cert.Leaf.DNSNames, tt.wantName)
+			}
+		})
+	}
+
+	selections := manager.Status().Selections
+	want := map[string]uint64{SelectionExact: 3, SelectionWildcard: 1, SelectionOnDemand: 0, SelectionDefault: 4}
+	for result, n := range want {
+		if selections[result] != n {
+			t.Errorf("selections[%s] = %d, want %d", result, selections[result], n)
+		}
+	}
+
+	// Entries are reloaded with the default certificate
+	renewed, err := generateSelfSignedCertificate([]string{"chat.example.com", "renewed.example.com"}, nil, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertificateFiles(t, certPath, keyPath, renewed)
+	if err := manager.ReloadCertificateFiles(); err != nil {
+		t.Fatalf("ReloadCertificateFiles() error = %v", err)
+	}
+	cert, _ := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "chat.example.com"})
+	if len(cert.Leaf.DNSNames) != 2 {
+		t.Errorf("entry not reloaded: %v", cert.Leaf.DNSNames)
+	}
+
+	// Generated entries rotate with the default certificate
+	before, _ := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "web.example.org"})
+	if err := manager.RotateCertificates(); err != nil {
+		t.Fatalf("RotateCertificates() error = %v", err)
+	}
+	after, _ := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "web.example.org"})
+	if before.Leaf.SerialNumber.Cmp(after.Leaf.SerialNumber) == 0 {
+		t.Error("generated entry was not rotated")
+	}
+}
+
+func TestSNIDuplicateNames(t *testing.T) {
+	_, err := NewManager(&Config{
+		AutoGenerate: true,
+		CacheDir:     t.TempDir(),
+		Certificates: []CertificateEntry{
+			{Names: []string{"a.example.com"}, AutoGenerate: true},
+			{Names: []string{"A.example.com"}, AutoGenerate: true},
+		},
+	})
+	if err == nil {
+		t.Error("NewManager() accepted a server name listed by two entries")
+	}
+}
+
+func TestKeyTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string
+		want    string
+	}{
+		{"rsa 2048", "rsa-2048", KeyTypeRSA2048},
+		{"rsa 3072", "RSA-3072", KeyTypeRSA3072},
+		{"ecdsa p256", "ecdsa-p256", KeyTypeECDSAP256},
+		{"ecdsa p384", "ecdsa-P-384", KeyTypeECDSAP384},
+		{"ed25519", "ed25519", KeyTypeEd25519},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			manager, err := NewManager(&Config{
+				AutoGenerate: true,
+				DNSNames:     []string{"localhost"},
+				CacheDir:     tmpDir,
+				KeyType:      tt.keyType,
+			})
+			if err != nil {
+				t.Fatalf("NewManager() error = %v", err)
+			}
+			defer manager.Close()
+
+			cert, err := manager.GetCertificate(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keyTypeOf(cert.Leaf); got != tt.want {
+				t.Errorf("key type = %s, want %s", got, tt.want)
+			}
+			leaf := cert.Leaf
+			if err := leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+				t.Errorf("self-signature does not verify: %v", err)
+			}
+			if want := cacheKey([]string{"localhost"}, nil, tt.want, "self-signed"); manager.getCacheKey() != want {
+				t.Errorf("cache key = %s, want %s", manager.getCacheKey(), want)
+			}
+		})
+	}
+
+	if _, err := NewManager(&Config{AutoGenerate: true, CacheDir: t.TempDir(), KeyType: "dsa-1024"}); err == nil {
+		t.Error("expected an error for an unknown key type")
+	}
+}
+
+func TestTLSPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  TLSPolicy
+		wantErr string
+		check   func(*testing.T, *tls.Config)
+	}{
+		{
+			name:   "defaults",
+			policy: TLSPolicy{},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != 0 {
+					t.Errorf("versions = %x-%x, want TLS 1.2 and up", cfg.MinVersion, cfg.MaxVersion)
+				}
+				if len(cfg.CipherSuites) != len(defaultCipherSuites) {
+					t.Errorf("cipher suites = %v, want defaults", cfg.CipherSuites)
+				}
+			},
+		},
+		{
+			name: "custom",
+			policy: TLSPolicy{
+				MinVersion:   "1.3",
+				MaxVersion:   "1.3",
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+				Curves:       []string{"X25519", "p-256"},
+				ALPN:         []string{"h2", "http/1.1"},
+			},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if cfg.MinVersion != tls.VersionTLS13 || cfg.MaxVersion != tls.VersionTLS13 {
+					t.Errorf("versions = %x-%x, want TLS 1.3 only", cfg.MinVersion, cfg.MaxVersion)
+				}
+				if len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+					t.Errorf("cipher suites = %v", cfg.CipherSuites)
+				}
+				if len(cfg.CurvePreferences) != 2 || cfg.CurvePreferences[0] != tls.X25519 || cfg.CurvePreferences[1] != tls.CurveP256 {
+					t.Errorf("curves = %v", cfg.CurvePreferences)
+				}
+				if strings.Join(cfg.NextProtos, ",") != "h2,http/1.1" {
+					t.Errorf("ALPN = %v", cfg.NextProtos)
+				}
+			},
+		},
+		{
+			name:   "tickets disabled",
+			policy: TLSPolicy{SessionTickets: SessionTicketConfig{Disabled: true}},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if !cfg.SessionTicketsDisabled || cfg.WrapSession != nil {
+					t.Error("expected session tickets to be disabled")
+				}
+			},
+		},
+		{name: "unknown version", policy: TLSPolicy{MinVersion: "1.4"}, wantErr: "unknown TLS version"},
+		{name: "max below min", policy: TLSPolicy{MinVersion: "1.3", MaxVersion: "1.2"}, wantErr: "below minimum"},
+		{name: "insecure suite", policy: TLSPolicy{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, wantErr: "insecure"},
+		{name: "TLS 1.3 suite", policy: TLSPolicy{CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}, wantErr: "TLS 1.3 only"},
+		{name: "unknown suite", policy: TLSPolicy{CipherSuites: []string{"TLS_NULL"}}, wantErr: "unknown cipher suite"},
+		{name: "unknown curve", policy: TLSPolicy{Curves: []string{"P-192"}}, wantErr: "unknown curve"},
+		{name: "empty ALPN", policy: TLSPolicy{ALPN: []string{""}}, wantErr: "invalid ALPN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, err := NewManager(&Config{AutoGenerate: true, CacheDir: t.TempDir(), TLS: tt.policy})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewManager() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewManager() error = %v", err)
+			}
+			defer manager.Close()
+			tt.check(t, manager.GetTLSConfig())
+		})
+	}
+}
+
+// handshake runs a TLS handshake over a pipe and reports whether the
+// session was resumed
+func handshake(t *testing.T, server *tls.Config, cache tls.ClientSessionCache, version uint16) bool {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		conn := tls.Server(serverConn, server)
+		err := conn.Handshake()
+		if err == nil {
+			// TLS 1.3 tickets are sent after the handshake; reading
+			// flushes them to the client
+			_, err = conn.Write([]byte{1})
+		}
+		errs <- err
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{
+		InsecureSkipVerify: true,
+		ClientSessionCache: cache,
+		MaxVersion:         version,
+		ServerName:         "localhost",
+	})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("client read: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	return client.ConnectionState().DidResume
+}
+
+func TestSessionTicketKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyFile := filepath.Join(tmpDir, "tickets.keys")
+
+	newManager := func() *Manager {
+		manager, err := NewManager(&Config{
+			AutoGenerate: true,
+			DNSNames:     []string{"localhost"},
+			CacheDir:     tmpDir,
+			TLS:          TLSPolicy{SessionTickets: SessionTicketConfig{KeyFile: keyFile}},
+		})
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		t.Cleanup(func() { manager.Close() })
+		return manager
+	}
+
+	first := newManager()
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("key file not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+	second := newManager()
+
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		cache := tls.NewLRUClientSessionCache(4)
+		if handshake(t, first.GetTLSConfig(), cache, version) {
+			t.Fatalf("version %x: first handshake resumed", version)
+		}
+		if !handshake(t, second.GetTLSConfig(), cache, version) {
+			t.Errorf("version %x: session from one instance did not resume on the other", version)
+		}
+	}
+
+	// A rotation keeps the previous key for decryption
+	cache := tls.NewLRUClientSessionCache(4)
+	config := first.GetTLSConfig()
+	handshake(t, config, cache, tls.VersionTLS13)
+	if err := first.tickets.rotateFile(); err != nil {
+		t.Fatal(err)
+	}
+	if !handshake(t, config, cache, tls.VersionTLS13) {
+		t.Error("session did not resume after key rotation")
+	}
+
+	// The other instance picks up the rotated file
+	if err := second.tickets.check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(second.tickets.keys) != 2 || second.tickets.keys[0] != first.tickets.keys[0] {
+		t.Error("rotated key file was not reloaded")
+	}
+
+	// An invalid file keeps the current keys
+	if err := os.WriteFile(keyFile, []byte("not a key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.tickets.check(); err == nil {
+		t.Error("expected an error for an invalid key file")
+	}
+	if len(second.tickets.keys) != 2 {
+		t.Error("invalid key file replaced the current keys")
+	}
+}
+
+func TestCertificatesStatus(t *testing.T) {
+	manager, err := NewManager(&Config{
+		AutoGenerate: true,
+		DNSNames:     []string{"default.example"},
+		CacheDir:     t.TempDir(),
+		Certificates: []CertificateEntry{
+			{Names: []string{"chat.example.com", "*.example.org"}, AutoGenerate: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	infos := manager.Certificates()
+	if len(infos) != 2 {
+		t.Fatalf("Certificates() returned %d certificates, want 2", len(infos))
+	}
+	if infos[0].Name != "default" || infos[0].Source != SourceDefault {
+		t.Errorf("first certificate = %s (%s), want the default", infos[0].Name, infos[0].Source)
+	}
+	if infos[1].Name != "chat.example.com,*.example.org" || infos[1].Source != SourceEntry {
+		t.Errorf("second certificate = %s (%s), want the entry", infos[1].Name, infos[1].Source)
+	}
+
+	cert, _ := manager.GetCertificate(nil)
+	fingerprint := sha256.Sum256(cert.Certificate[0])
+	if infos[0].SHA256Fingerprint != hex.EncodeToString(fingerprint[:]) {
+		t.Error("fingerprint does not match the served certificate")
+	}
+	if infos[0].KeyType != KeyTypeRSA2048 || len(infos[0].PublicKeySHA256) != 64 {
+		t.Errorf("unexpected key details %s %s", infos[0].KeyType, infos[0].PublicKeySHA256)
+	}
+
+	if err := manager.RotateCertificates(); err != nil {
+		t.Fatal(err)
+	}
+	status := manager.Status()
+	if status.RotationSuccess != 1 || status.RotationFailure != 0 {
+		t.Errorf("rotations = %d/%d, want 1 success", status.RotationSuccess, status.RotationFailure)
+	}
+	if status.Certificates[0].SHA256Fingerprint == infos[0].SHA256Fingerprint {
+		t.Error("rotation did not replace the default certificate")
+	}
+}
+
 // Benchmark tests
 func BenchmarkGenerateSelfSignedCertificate(b *testing.B) {
 	dnsNames := []string{"localhost"}
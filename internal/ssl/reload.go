@@ -0,0 +1,240 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// reloadSettleDelay is how long the files must stay unchanged before a
+// reload, so a certificate and key written one after the other are read as
+// a pair
+const reloadSettleDelay = time.Second
+
+// fileState identifies one version of the certificate and key files
+type fileState struct {
+	certModTime int64
+	certSize    int64
+	keyModTime  int64
+	keySize     int64
+}
+
+// statCertificateFiles returns the current state of the certificate files
+// Stat follows symlinks, so atomically swapped links (as used for mounted
+// secrets) are detected too
+func statCertificateFiles(certFile, keyFile string) (fileState, error) {
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		return fileState{}, err
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{
+		certModTime: certInfo.ModTime().UnixNano(),
+		certSize:    certInfo.Size(),
+		keyModTime:  keyInfo.ModTime().UnixNano(),
+		keySize:     keyInfo.Size(),
+	}, nil
+}
+
+// loadStats counts certificate file loads or rotations
+type loadStats struct {
+	success  atomic.Uint64
+	failure  atomic.Uint64
+	lastOK   atomic.Bool
+	lastLoad atomic.Int64 // unix seconds
+}
+
+// record stores the result of a load attempt
+func (s *loadStats) record(ok bool) {
+	if ok {
+		s.success.Add(1)
+	} else {
+		s.failure.Add(1)
+	}
+	s.lastOK.Store(ok)
+	s.lastLoad.Store(time.Now().Unix())
+}
+
+// Status reports the served certificates, certificate file load results,
+// certificate selections and rotations
+type Status struct {
+	// NotAfter is the expiry of the active default certificate
+	NotAfter time.Time
+
+	// LoadSuccess and LoadFailure count certificate file loads, including
+	// the initial load
+	LoadSuccess uint64
+	LoadFailure uint64
+
+	// LastLoadOK reports whether the most recent load succeeded
+	LastLoadOK bool
+
+	// LastLoad is the time of the most recent load attempt
+	LastLoad time.Time
+
+	// Selections counts handshakes by certificate selection result
+	Selections map[string]uint64
+
+	// RotationSuccess and RotationFailure count replacements of generated
+	// and ACME certificates, manual and scheduled
+	RotationSuccess uint64
+	RotationFailure uint64
+
+	// Certificates describes every served certificate
+	Certificates []CertificateInfo
+}
+
+// Status returns the served certificates and the load, selection and
+// rotation counters
+func (m *Manager) Status() Status {
+	status := Status{
+		LoadSuccess:     m.loads.success.Load(),
+		LoadFailure:     m.loads.failure.Load(),
+		LastLoadOK:      m.loads.lastOK.Load(),
+		Selections:      m.selections.snapshot(),
+		RotationSuccess: m.rotations.success.Load(),
+		RotationFailure: m.rotations.failure.Load(),
+		Certificates:    m.Certificates(),
+	}
+	if last := m.loads.lastLoad.Load(); last != 0 {
+		status.LastLoad = time.Unix(last, 0)
+	}
+
+	m.mutex.RLock()
+	cert, exists := m.certCache["default"]
+	m.mutex.RUnlock()
+	if exists && cert.Leaf != nil {
+		status.NotAfter = cert.Leaf.NotAfter
+	}
+	return status
+}
+
+// filePair is a certificate loaded from files and watched for changes
+type filePair struct {
+	// id is the certificate's key in the certificate cache
+	id       string
+	certFile string
+	keyFile  string
+}
+
+// filePairs returns every certificate loaded from files
+func (m *Manager) filePairs() []filePair {
+	var pairs []filePair
+	if !m.config.AutoGenerate && m.acme == nil {
+		pairs = append(pairs, filePair{id: "default", certFile: m.config.CertFile, keyFile: m.config.KeyFile})
+	}
+	for _, entry := range m.entries {
+		if !entry.config.AutoGenerate {
+			pairs = append(pairs, filePair{id: entry.id, certFile: entry.config.CertFile, keyFile: entry.config.KeyFile})
+		}
+	}
+	return pairs
+}
+
+// loadValidCertificate loads a certificate pair for a reload
+// Unlike at startup, a pair that is not currently valid is rejected
+func loadValidCertificate(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := loadCertificateFromFiles(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired on %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(cert.Leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate is not valid before %s", cert.Leaf.NotBefore.Format(time.RFC3339))
+	}
+	return cert, nil
+}
+
+// ReloadCertificateFiles reloads every certificate loaded from files
+// Each new pair is validated before it replaces the active certificate; on
+// any error that certificate stays in use
+func (m *Manager) ReloadCertificateFiles() error {
+	pairs := m.filePairs()
+	if len(pairs) == 0 {
+		return fmt.Errorf("no certificates are loaded from files")
+	}
+
+	var errs []error
+	for _, pair := range pairs {
+		if err := m.reloadPair(pair); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reloadPair reloads one certificate pair
+func (m *Manager) reloadPair(pair filePair) error {
+	cert, err := loadValidCertificate(pair.certFile, pair.keyFile)
+	if err != nil {
+		m.loads.record(false)
+		log.Printf("[ERROR] Reloading %s failed, keeping the current certificate: %v", pair.certFile, err)
+		return fmt.Errorf("%s: %w", pair.certFile, err)
+	}
+
+	m.mutex.Lock()
+	m.certCache[pair.id] = cert
+	m.mutex.Unlock()
+	m.loads.record(true)
+
+	logCertificate("Reloaded", cert)
+	return nil
+}
+
+// logCertificate logs the names and expiry of a loaded certificate
+func logCertificate(action string, cert *tls.Certificate) {
+	ips := make([]string, len(cert.Leaf.IPAddresses))
+	for i, ip := range cert.Leaf.IPAddresses {
+		ips[i] = ip.String()
+	}
+	log.Printf("[INFO] %s certificate %q: DNS names [%s], IP addresses [%s], expires %s",
+		action, cert.Leaf.Subject.CommonName, strings.Join(cert.Leaf.DNSNames, ", "),
+		strings.Join(ips, ", "), cert.Leaf.NotAfter.Format(time.RFC3339))
+}
+
+// watchLoop reloads certificate files when they change on disk
+func (m *Manager) watchLoop(pairs []filePair, states []fileState) {
+	ticker := time.NewTicker(m.config.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for i, pair := range pairs {
+				state, err := statCertificateFiles(pair.certFile, pair.keyFile)
+				if err != nil || state == states[i] {
+					// Missing files are usually mid-replacement; keep serving
+					continue
+				}
+
+				// Wait until both files have been written
+				select {
+				case <-time.After(reloadSettleDelay):
+				case <-m.done:
+					return
+				}
+				if settled, err := statCertificateFiles(pair.certFile, pair.keyFile); err != nil || settled != state {
+					continue
+				}
+
+				log.Printf("[INFO] Certificate files %s changed, reloading", pair.certFile)
+				m.reloadPair(pair)
+				states[i] = state
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// CertificateEntry is a certificate served for a set of server names
+type CertificateEntry struct {
+	// Names are exact host names or single-label wildcards such as
+	// *.example.com
+	Names []string
+
+	// CertFile and KeyFile load the certificate from disk
+	CertFile string
+	KeyFile  string
+
+	// AutoGenerate generates the certificate for Names instead, issued by
+	// the local CA when it is enabled
+	AutoGenerate bool
+}
+
+// Certificate selection results
+const (
+	SelectionExact    = "exact"
+	SelectionWildcard = "wildcard"
+	SelectionOnDemand = "on_demand"
+	SelectionDefault  = "default"
+)
+
+// entryPrefix prefixes certificate entries in the certificate cache
+const entryPrefix = "entry:"
+
+// certEntry is a configured certificate entry
+type certEntry struct {
+	// id is the entry's key in the certificate cache
+	id       string
+	config   CertificateEntry
+	cacheKey string
+}
+
+// sniIndex maps server names to certificate entries
+type sniIndex struct {
+	exact map[string]*certEntry
+
+	// wildcard is keyed by the parent domain of "*.<parent>"
+	wildcard map[string]*certEntry
+}
+
+// selectionStats counts certificate selections by result
+type selectionStats struct {
+	exact    atomic.Uint64
+	wildcard atomic.Uint64
+	onDemand atomic.Uint64
+	fallback atomic.Uint64
+}
+
+// snapshot returns the counters keyed by selection result
+func (s *selectionStats) snapshot() map[string]uint64 {
+	return map[string]uint64{
+		SelectionExact:    s.exact.Load(),
+		SelectionWildcard: s.wildcard.Load(),
+		SelectionOnDemand: s.onDemand.Load(),
+		SelectionDefault:  s.fallback.Load(),
+	}
+}
+
+// normalizeServerName lowercases a server name and strips a trailing dot
+func normalizeServerName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// setupEntries indexes and loads the configured certificate entries
+func (m *Manager) setupEntries() error {
+	m.names = sniIndex{
+		exact:    make(map[string]*certEntry),
+		wildcard: make(map[string]*certEntry),
+	}
+
+	for i, cfg := range m.config.Certificates {
+		if len(cfg.Names) == 0 {
+			return fmt.Errorf("certificate entry %d has no names", i)
+		}
+
+		entry := &certEntry{id: fmt.Sprintf("%s%d", entryPrefix, i), config: cfg}
+		for _, name := range cfg.Names {
+			name = normalizeServerName(name)
+			index, key := m.names.exact, name
+			if strings.HasPrefix(name, "*.") {
+				index, key = m.names.wildcard, name[2:]
+			}
+			if _, exists := index[key]; exists {
+				return fmt.Errorf("server name %s is listed by more than one certificate entry", name)
+			}
+			index[key] = entry
+		}
+
+		if err := m.loadEntry(entry); err != nil {
+			return fmt.Errorf("certificate entry %s: %w", strings.Join(cfg.Names, ", "), err)
+		}
+		m.entries = append(m.entries, entry)
+	}
+	return nil
+}
+
+// loadEntry loads, or generates, the initial certificate of an entry
+func (m *Manager) loadEntry(entry *certEntry) error {
+	if !entry.config.AutoGenerate {
+		cert, err := loadCertificateFromFiles(entry.config.CertFile, entry.config.KeyFile)
+		if err != nil {
+			m.loads.record(false)
+			return err
+		}
+		m.loads.record(true)
+		m.certCache[entry.id] = cert
+		logCertificate("Loaded", cert)
+		return nil
+	}
+
+	entry.cacheKey = cacheKey(entry.config.Names, nil, m.config.KeyType, m.issuer)
+	cert, err := loadCertificateFromCache(m.config.CacheDir, entry.cacheKey)
+	if err == nil && !isCertificateExpiringSoon(cert, m.renewBeforeDays()) {
+		m.certCache[entry.id] = cert
+		return nil
+	}
+	return m.generateEntry(entry)
+}
+
+// generateEntry generates and caches a new certificate for an entry
+func (m *Manager) generateEntry(entry *certEntry) error {
+	cert, err := m.generate(entry.config.Names, nil)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	if err := saveCertificateToCache(m.config.CacheDir, entry.cacheKey, cert); err != nil {
+		log.Printf("[WARN] Failed to cache certificate: %v", err)
+	}
+
+	m.mutex.Lock()
+	m.certCache[entry.id] = cert
+	m.mutex.Unlock()
+	return nil
+}
+
+// rotateEntries regenerates generated entries; unless force is set only
+// entries close to expiry are replaced
+func (m *Manager) rotateEntries(force bool) error {
+	for _, entry := range m.entries {
+		if !entry.config.AutoGenerate {
+			continue
+		}
+
+		m.mutex.RLock()
+		cert := m.certCache[entry.id]
+		m.mutex.RUnlock()
+		if !force && cert != nil && !isCertificateExpiringSoon(cert, m.renewBeforeDays()) {
+			continue
+		}
+
+		err := m.generateEntry(entry)
+		if !force {
+			// Forced rotations are counted once by RotateCertificates
+			m.rotations.record(err == nil)
+		}
+		if err != nil {
+			return fmt.Errorf("certificate entry %s: %w", strings.Join(entry.config.Names, ", "), err)
+		}
+	}
+	return nil
+}
+
+// hasGeneratedEntries reports whether any entry is auto-generated
+func (m *Manager) hasGeneratedEntries() bool {
+	for _, entry := range m.config.Certificates {
+		if entry.AutoGenerate {
+			return true
+		}
+	}
+	return false
+}
+
+// selectEntry returns the entry certificate for a server name
+// Exact names take precedence over wildcards, and a wildcard matches exactly
+// one label, as in certificate name matching
+func (m *Manager) selectEntry(serverName string) (*tls.Certificate, string) {
+	name := normalizeServerName(serverName)
+
+	entry, ok := m.names.exact[name]
+	result := SelectionExact
+	if !ok {
+		if dot := strings.IndexByte(name, '.'); dot > 0 {
+			entry, ok = m.names.wildcard[name[dot+1:]]
+			result = SelectionWildcard
+		}
+	}
+	if !ok {
+		return nil, ""
+	}
+
+	m.mutex.RLock()
+	cert := m.certCache[entry.id]
+	m.mutex.RUnlock()
+	if cert == nil {
+		return nil, ""
+	}
+	return cert, result
+}
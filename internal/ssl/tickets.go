@@ -0,0 +1,250 @@
+package ssl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTicketKeys is how many session ticket keys are kept; tickets encrypted
+// with older keys no longer resume
+const maxTicketKeys = 3
+
+// ticketKeyCheckInterval is how often keys are checked for rotation and the
+// shared key file for changes
+const ticketKeyCheckInterval = 30 * time.Second
+
+// defaultTicketRotationInterval is used when no rotation interval is set
+const defaultTicketRotationInterval = 24 * time.Hour
+
+// ticketKeys holds the session ticket keys of every TLS config handed out
+// by the manager
+//
+// Without a key file, keys are random and rotate in memory. With a key file
+// the keys are shared: the file holds one base64-encoded 32-byte key per
+// line, the first one encrypting new tickets. A missing file is created, an
+// instance that finds the file older than the rotation interval prepends a
+// new key, and changes made by other instances are picked up.
+type ticketKeys struct {
+	config SessionTicketConfig
+
+	// store holds the active keys; it only serves EncryptTicket and
+	// DecryptTicket, so key changes reach configs that were already cloned
+	store *tls.Config
+
+	mutex   sync.Mutex
+	keys    [][32]byte
+	rotated time.Time
+
+	// modTime and size identify the key file version last loaded
+	modTime time.Time
+	size    int64
+}
+
+// newTicketKeys creates the initial session ticket keys
+func newTicketKeys(cfg SessionTicketConfig) (*ticketKeys, error) {
+	if cfg.RotationInterval == 0 {
+		cfg.RotationInterval = defaultTicketRotationInterval
+	}
+	t := &ticketKeys{config: cfg, store: &tls.Config{}}
+
+	if cfg.KeyFile == "" {
+		return t, t.rotate()
+	}
+	if err := t.loadFile(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		log.Printf("[INFO] Creating session ticket key file %s", cfg.KeyFile)
+		if err := t.rotateFile(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// install makes a TLS config encrypt and decrypt tickets with these keys
+func (t *ticketKeys) install(cfg *tls.Config) {
+	cfg.WrapSession = func(cs tls.ConnectionState, ss *tls.SessionState) ([]byte, error) {
+		return t.store.EncryptTicket(cs, ss)
+	}
+	cfg.UnwrapSession = func(identity []byte, cs tls.ConnectionState) (*tls.SessionState, error) {
+		return t.store.DecryptTicket(identity, cs)
+	}
+}
+
+// setKeys activates keys, the first encrypting new tickets
+func (t *ticketKeys) setKeys(keys [][32]byte) {
+	if len(keys) > maxTicketKeys {
+		keys = keys[:maxTicketKeys]
+	}
+	t.keys = keys
+	t.store.SetSessionTicketKeys(keys)
+}
+
+// newTicketKey returns a random session ticket key
+func newTicketKey() ([32]byte, error) {
+	var key [32]byte
+	_, err := rand.Read(key[:])
+	return key, err
+}
+
+// rotate introduces a new in-memory key
+func (t *ticketKeys) rotate() error {
+	key, err := newTicketKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate session ticket key: %w", err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.setKeys(append([][32]byte{key}, t.keys...))
+	t.rotated = time.Now()
+	return nil
+}
+
+// loadFile activates the keys in the key file
+func (t *ticketKeys) loadFile() error {
+	info, err := os.Stat(t.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(t.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	keys, err := parseTicketKeys(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", t.config.KeyFile, err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.setKeys(keys)
+	t.modTime, t.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// rotateFile prepends a new key to the key file and activates the result
+func (t *ticketKeys) rotateFile() error {
+	key, err := newTicketKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate session ticket key: %w", err)
+	}
+
+	t.mutex.Lock()
+	keys := append([][32]byte{key}, t.keys...)
+	t.mutex.Unlock()
+	if len(keys) > maxTicketKeys {
+		keys = keys[:maxTicketKeys]
+	}
+
+	if err := writeFileAtomic(t.config.KeyFile, formatTicketKeys(keys), 0600); err != nil {
+		return fmt.Errorf("failed to write session ticket key file: %w", err)
+	}
+	return t.loadFile()
+}
+
+// check rotates keys that are due and reloads a changed key file
+// Several instances may rotate a shared file at once; a lost key only costs
+// clients a full handshake
+func (t *ticketKeys) check() error {
+	if t.config.KeyFile == "" {
+		t.mutex.Lock()
+		due := time.Since(t.rotated) >= t.config.RotationInterval
+		t.mutex.Unlock()
+		if !due {
+			return nil
+		}
+		log.Printf("[INFO] Rotating session ticket keys")
+		return t.rotate()
+	}
+
+	info, err := os.Stat(t.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	if time.Since(info.ModTime()) >= t.config.RotationInterval {
+		// Start from the current file contents
+		if err := t.loadFile(); err != nil {
+			return err
+		}
+		log.Printf("[INFO] Rotating session ticket keys in %s", t.config.KeyFile)
+		return t.rotateFile()
+	}
+
+	t.mutex.Lock()
+	changed := !info.ModTime().Equal(t.modTime) || info.Size() != t.size
+	t.mutex.Unlock()
+	if !changed {
+		return nil
+	}
+	log.Printf("[INFO] Session ticket key file %s changed, reloading", t.config.KeyFile)
+	return t.loadFile()
+}
+
+// parseTicketKeys parses a key file; blank lines and # comments are skipped
+func parseTicketKeys(data []byte) ([][32]byte, error) {
+	var keys [][32]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(text)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("line %d: expected a base64-encoded 32-byte key", line)
+		}
+		var key [32]byte
+		copy(key[:], raw)
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no session ticket keys")
+	}
+	return keys, nil
+}
+
+// formatTicketKeys encodes keys in the key file format
+func formatTicketKeys(keys [][32]byte) []byte {
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(base64.StdEncoding.EncodeToString(key[:]))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// ticketLoop rotates session ticket keys and follows the key file
+func (m *Manager) ticketLoop() {
+	interval := ticketKeyCheckInterval
+	if m.tickets.config.RotationInterval < interval {
+		interval = m.tickets.config.RotationInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.tickets.check(); err != nil {
+				log.Printf("[WARN] Session ticket key update failed, keeping the current keys: %v", err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TLSPolicy configures the protocol parameters offered to clients
+// Empty fields keep the defaults: TLS 1.2 and later, ECDHE AEAD cipher
+// suites and Go's curve preferences
+type TLSPolicy struct {
+	// MinVersion and MaxVersion are "1.0", "1.1", "1.2" or "1.3"
+	MinVersion string
+	MaxVersion string
+
+	// CipherSuites are TLS 1.0-1.2 suite names as listed by Go, such as
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; TLS 1.3 suites are not
+	// configurable
+	CipherSuites []string
+
+	// Curves are key exchange groups in preference order: X25519, P-256,
+	// P-384 or P-521
+	Curves []string
+
+	// ALPN lists the application protocols offered, in preference order
+	ALPN []string
+
+	// SessionTickets configures session resumption
+	SessionTickets SessionTicketConfig
+}
+
+// SessionTicketConfig configures session ticket keys
+type SessionTicketConfig struct {
+	// Disabled turns session tickets off
+	Disabled bool
+
+	// RotationInterval is how often a new encryption key is introduced;
+	// tickets stay valid for maxTicketKeys intervals. Defaults to 24h
+	RotationInterval time.Duration
+
+	// KeyFile shares keys between instances; see ticketKeys
+	KeyFile string
+}
+
+// defaultCipherSuites are the suites offered when none are configured
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// tlsVersions maps version names to protocol versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCurves maps curve names to key exchange groups
+var tlsCurves = map[string]tls.CurveID{
+	"x25519": tls.X25519,
+	"p-256":  tls.CurveP256,
+	"p-384":  tls.CurveP384,
+	"p-521":  tls.CurveP521,
+}
+
+// tlsParams is a parsed TLSPolicy
+type tlsParams struct {
+	minVersion   uint16
+	maxVersion   uint16
+	cipherSuites []uint16
+	curves       []tls.CurveID
+	alpn         []string
+}
+
+// compileTLSPolicy parses and checks a TLS policy
+func compileTLSPolicy(policy TLSPolicy) (*tlsParams, error) {
+	params := &tlsParams{
+		minVersion:   tls.VersionTLS12,
+		cipherSuites: defaultCipherSuites,
+		alpn:         policy.ALPN,
+	}
+
+	var err error
+	if policy.MinVersion != "" {
+		if params.minVersion, err = parseTLSVersion(policy.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	if policy.MaxVersion != "" {
+		if params.maxVersion, err = parseTLSVersion(policy.MaxVersion); err != nil {
+			return nil, err
+		}
+		if params.maxVersion < params.minVersion {
+			return nil, fmt.Errorf("maximum TLS version %s is below minimum %s", policy.MaxVersion, policy.MinVersion)
+		}
+	}
+
+	if len(policy.CipherSuites) > 0 {
+		if params.cipherSuites, err = parseCipherSuites(policy.CipherSuites); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range policy.Curves {
+		curve, ok := tlsCurves[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q (must be X25519, P-256, P-384 or P-521)", name)
+		}
+		params.curves = append(params.curves, curve)
+	}
+
+	for _, proto := range policy.ALPN {
+		if proto == "" || len(proto) > 255 {
+			return nil, fmt.Errorf("invalid ALPN protocol %q", proto)
+		}
+	}
+	return params, nil
+}
+
+// parseTLSVersion parses a version name such as "1.2"
+func parseTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (must be 1.0, 1.1, 1.2 or 1.3)", name)
+	}
+	return version, nil
+}
+
+// parseCipherSuites resolves cipher suite names
+// Insecure suites and TLS 1.3 suites, which Go always enables, are rejected
+func parseCipherSuites(names []string) ([]uint16, error) {
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, err := lookupCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// lookupCipherSuite returns the ID of a configurable cipher suite
+func lookupCipherSuite(name string) (uint16, error) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name != name {
+			continue
+		}
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			return 0, fmt.Errorf("cipher suite %s is TLS 1.3 only and cannot be configured", name)
+		}
+		return suite.ID, nil
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			return 0, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
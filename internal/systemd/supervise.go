@@ -0,0 +1,57 @@
+package systemd
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// statusInterval is how often STATUS is refreshed without a watchdog
+const statusInterval = 10 * time.Second
+
+// Supervise sends periodic STATUS updates and, if WatchdogSec= is set,
+// WATCHDOG pings until ctx is cancelled. A ping is only sent while the
+// liveness check passes, so a stuck process is restarted by systemd.
+func Supervise(ctx context.Context, liveness func() error, status func() string) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+
+	watchdog, err := WatchdogInterval()
+	if err != nil {
+		log.Printf("[WARN] systemd watchdog disabled: %v", err)
+	}
+
+	interval := statusInterval
+	if watchdog > 0 {
+		// Ping at half the timeout as recommended by sd_watchdog_enabled(3)
+		interval = watchdog / 2
+		log.Printf("[INFO] systemd watchdog enabled, pinging every %s", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if status != nil {
+			if _, err := Status(status()); err != nil {
+				log.Printf("[WARN] systemd status update failed: %v", err)
+			}
+		}
+
+		if watchdog > 0 {
+			if err := liveness(); err != nil {
+				log.Printf("[WARN] Liveness check failed, skipping watchdog ping: %v", err)
+			} else if _, err := Watchdog(); err != nil {
+				log.Printf("[WARN] systemd watchdog ping failed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package systemd implements the parts of the systemd service protocol used
+// by the proxy: socket activation (LISTEN_FDS), readiness and status
+// notifications (sd_notify) and watchdog keep-alive pings.
+//
+// All functions are no-ops when the process is not started by systemd.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// listenFDsStart is the first fd passed by socket activation
+	listenFDsStart = 3
+)
+
+// Listener is a socket-activated listener with its FileDescriptorName
+type Listener struct {
+	Name     string
+	Listener net.Listener
+}
+
+// Listeners returns the listening sockets passed by systemd socket activation
+// in fd order. It returns nil if the process was not socket-activated.
+// The LISTEN_* variables are unset so child processes do not inherit them.
+func Listeners() ([]Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	listeners := make([]Listener, 0, count)
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		if f == nil {
+			return nil, fmt.Errorf("socket activation: invalid fd %d", fd)
+		}
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: fd %d (%s): %w", fd, name, err)
+		}
+		listeners = append(listeners, Listener{Name: name, Listener: l})
+	}
+
+	return listeners, nil
+}
+
+// Notify sends a state string to the service manager
+// It returns false if NOTIFY_SOCKET is not set
+func Notify(state string) (bool, error) {
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if socketAddr == "" {
+		return false, nil
+	}
+
+	// Abstract namespace sockets are written with a leading '@'
+	if strings.HasPrefix(socketAddr, "@") {
+		socketAddr = "\x00" + socketAddr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketAddr, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to send notification: %w", err)
+	}
+	return true, nil
+}
+
+// Ready notifies the service manager that startup is complete
+func Ready() (bool, error) {
+	return Notify("READY=1")
+}
+
+// ReadyAsMainPID notifies readiness of a process that takes over from a
+// previous main process (listener handoff); requires NotifyAccess=all
+func ReadyAsMainPID() (bool, error) {
+	return Notify(fmt.Sprintf("MAINPID=%d\nREADY=1", os.Getpid()))
+}
+
+// Stopping notifies the service manager that shutdown has started
+func Stopping() (bool, error) {
+	return Notify("STOPPING=1")
+}
+
+// Status sends a free-form status line shown by systemctl status
+func Status(status string) (bool, error) {
+	return Notify("STATUS=" + status)
+}
+
+// Watchdog sends a watchdog keep-alive ping
+func Watchdog() (bool, error) {
+	return Notify("WATCHDOG=1")
+}
+
+// WatchdogInterval returns the watchdog timeout configured with WatchdogSec=
+// It returns 0 if the watchdog is not enabled for this process
+func WatchdogInterval() (time.Duration, error) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", usecStr)
+	}
+
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID %q", pidStr)
+		}
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// PrepareHandoff adjusts the environment before starting a process that will
+// take over as main PID, so the watchdog stays enabled in the new process
+func PrepareHandoff() {
+	os.Unsetenv("WATCHDOG_PID")
+}
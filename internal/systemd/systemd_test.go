@@ -0,0 +1,155 @@
+//go:build !windows
+
+package systemd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotification(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	sent, err := Ready()
+	if err != nil || !sent {
+		t.Fatalf("Ready() = %v, %v", sent, err)
+	}
+	if got := readNotification(t, conn); got != "READY=1" {
+		t.Errorf("notification = %q, want READY=1", got)
+	}
+
+	Status("Serving 3 active connections")
+	if got := readNotification(t, conn); got != "STATUS=Serving 3 active connections" {
+		t.Errorf("notification = %q", got)
+	}
+
+	ReadyAsMainPID()
+	want := "MAINPID=" + strconv.Itoa(os.Getpid()) + "\nREADY=1"
+	if got := readNotification(t, conn); got != want {
+		t.Errorf("notification = %q, want %q", got, want)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	sent, err := Ready()
+	if sent || err != nil {
+		t.Errorf("Ready() = %v, %v; want false, nil", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "not set", usec: "", want: 0},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "own pid", usec: "30000000", pid: strconv.Itoa(os.Getpid()), want: 30 * time.Second},
+		{name: "other pid", usec: "30000000", pid: "1", want: 0},
+		{name: "invalid", usec: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			got, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WatchdogInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenersNotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+
+	listeners, err := Listeners()
+	if err != nil || listeners != nil {
+		t.Errorf("Listeners() = %v, %v; want nil, nil", listeners, err)
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("LISTEN_FDS should be unset")
+	}
+}
+
+func TestSuperviseSkipsPingWhenUnhealthy(t *testing.T) {
+	conn := listenNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "100000") // 100ms
+	t.Setenv("WATCHDOG_PID", "")
+
+	healthy := make(chan bool, 1)
+	healthy <- true
+	liveness := func() error {
+		select {
+		case ok := <-healthy:
+			if ok {
+				return nil
+			}
+		default:
+		}
+		return errors.New("stuck")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Supervise(ctx, liveness, func() string { return "ok" })
+
+	// First tick: status and a ping
+	var got []string
+	for i := 0; i < 2; i++ {
+		got = append(got, readNotification(t, conn))
+	}
+	if got[0] != "STATUS=ok" || got[1] != "WATCHDOG=1" {
+		t.Fatalf("notifications = %q", got)
+	}
+
+	// Later ticks: status only, no pings while unhealthy
+	for i := 0; i < 3; i++ {
+		if msg := readNotification(t, conn); strings.HasPrefix(msg, "WATCHDOG") {
+			t.Fatalf("unexpected watchdog ping while unhealthy")
+		}
+	}
+}
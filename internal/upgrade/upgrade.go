@@ -0,0 +1,32 @@
+// Package upgrade implements zero-downtime restarts by handing listening
+// sockets to a newly exec'd child process through inherited file descriptors.
+//
+// The parent calls Restart with its listeners. The child finds them with
+// Inherited, starts serving and calls Ready. Once the child is ready, the
+// parent drains its existing connections and exits.
+package upgrade
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// envListeners lists the names of inherited listeners in fd order
+	envListeners = "WHATSAPP_PROXY_UPGRADE_LISTENERS"
+
+	// envReadyFD is the fd of the pipe the child writes to when ready
+	envReadyFD = "WHATSAPP_PROXY_UPGRADE_READY_FD"
+
+	// firstFD is the first inherited fd (after stdin, stdout, stderr)
+	firstFD = 3
+)
+
+// Listener is a named listening socket passed to the child process
+type Listener struct {
+	Name     string
+	Listener net.Listener
+}
+
+// DefaultReadyTimeout is how long Restart waits for the child to become ready
+const DefaultReadyTimeout = 30 * time.Second
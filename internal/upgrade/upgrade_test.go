@@ -0,0 +1,101 @@
+//go:build !windows
+
+package upgrade
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestHelperChild is run as the child process by TestRestartHandsOffListener
+func TestHelperChild(t *testing.T) {
+	if os.Getenv("UPGRADE_HELPER_CHILD") != "1" {
+		t.Skip("helper process")
+	}
+
+	listeners, err := Inherited()
+	if err != nil {
+		t.Fatalf("Inherited() error = %v", err)
+	}
+	l, ok := listeners["proxy"]
+	if !ok {
+		t.Fatalf("inherited listeners %v missing proxy", listeners)
+	}
+
+	if err := Ready(); err != nil {
+		t.Fatalf("Ready() error = %v", err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	conn.Write([]byte("child"))
+	conn.Close()
+}
+
+func TestRestartHandsOffListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer l.Close()
+
+	t.Setenv("UPGRADE_HELPER_CHILD", "1")
+	pid, err := restart(os.Args[0], []string{"-test.run=^TestHelperChild$"},
+		[]Listener{{Name: "proxy", Listener: l}}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("restart() error = %v", err)
+	}
+	if pid == 0 {
+		t.Error("restart() returned pid 0")
+	}
+
+	// Parent stops accepting; the child serves the same socket
+	addr := l.Addr().String()
+	l.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(data) != "child" {
+		t.Errorf("got %q from handed-off listener, want %q", data, "child")
+	}
+}
+
+func TestRestartChildFailsBeforeReady(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer l.Close()
+
+	_, err = restart("/bin/false", nil, []Listener{{Name: "proxy", Listener: l}}, 5*time.Second)
+	if err == nil {
+		t.Error("restart() should fail when the child exits without signalling readiness")
+	}
+}
+
+func TestInheritedWithoutParent(t *testing.T) {
+	listeners, err := Inherited()
+	if err != nil {
+		t.Fatalf("Inherited() error = %v", err)
+	}
+	if listeners != nil {
+		t.Errorf("Inherited() = %v, want nil", listeners)
+	}
+	if err := Ready(); err != nil {
+		t.Errorf("Ready() error = %v", err)
+	}
+}
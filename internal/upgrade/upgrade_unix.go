@@ -0,0 +1,177 @@
+//go:build !windows
+
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Restart starts a new instance of the running executable with the same
+// arguments, passing the listeners as inherited file descriptors
+// It returns the child PID once the child has called Ready
+func Restart(listeners []Listener, timeout time.Duration) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	return restart(executable, os.Args[1:], listeners, timeout)
+}
+
+// restart execs the given command with the listeners and waits for readiness
+func restart(path string, args []string, listeners []Listener, timeout time.Duration) (int, error) {
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+
+	var files []*os.File
+	var names []string
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, l := range listeners {
+		if l.Listener == nil {
+			continue
+		}
+		filer, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return 0, fmt.Errorf("listener %s (%T) cannot be passed to a child process", l.Name, l.Listener)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get file for listener %s: %w", l.Name, err)
+		}
+		files = append(files, f)
+		names = append(names, l.Name)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(filterEnv(os.Environ()),
+		envListeners+"="+strings.Join(names, ","),
+		envReadyFD+"="+strconv.Itoa(firstFD+len(files)),
+	)
+
+	if err := cmd.Start(); err != nil {
+		readyW.Close()
+		return 0, fmt.Errorf("failed to start child process: %w", err)
+	}
+	readyW.Close()
+
+	// Reap the child if it exits early so it does not linger as a zombie
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readyR.Read(buf); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("child closed ready pipe without signalling readiness")
+			}
+			ready <- err
+			return
+		}
+		ready <- nil
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return 0, err
+		}
+		return cmd.Process.Pid, nil
+	case err := <-exited:
+		return 0, fmt.Errorf("child process exited before becoming ready: %v", err)
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("child process not ready after %s", timeout)
+	}
+}
+
+// Inherited returns the listeners passed by a parent process, keyed by name
+// It returns nil if the process was not started by Restart
+func Inherited() (map[string]net.Listener, error) {
+	value, ok := os.LookupEnv(envListeners)
+	if !ok {
+		return nil, nil
+	}
+	os.Unsetenv(envListeners)
+
+	listeners := make(map[string]net.Listener)
+	if value == "" {
+		return listeners, nil
+	}
+
+	for i, name := range strings.Split(value, ",") {
+		f := os.NewFile(uintptr(firstFD+i), name)
+		if f == nil {
+			return nil, fmt.Errorf("inherited listener %s: invalid fd %d", name, firstFD+i)
+		}
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited listener %s: %w", name, err)
+		}
+		listeners[name] = l
+	}
+
+	return listeners, nil
+}
+
+// Ready tells the parent process that this process is serving
+// It is a no-op if the process was not started by Restart
+func Ready() error {
+	value, ok := os.LookupEnv(envReadyFD)
+	if !ok {
+		return nil
+	}
+	os.Unsetenv(envReadyFD)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid ready fd %q: %w", value, err)
+	}
+
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	if f == nil {
+		return fmt.Errorf("invalid ready fd %d", fd)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to signal readiness: %w", err)
+	}
+	return nil
+}
+
+// filterEnv removes upgrade variables left over from a previous restart
+func filterEnv(env []string) []string {
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envListeners+"=") || strings.HasPrefix(kv, envReadyFD+"=") {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package upgrade
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Restart is not supported on Windows
+func Restart(listeners []Listener, timeout time.Duration) (int, error) {
+	return 0, fmt.Errorf("listener handoff is not supported on windows")
+}
+
+// Inherited always returns nil on Windows
+func Inherited() (map[string]net.Listener, error) {
+	return nil, nil
+}
+
+// Ready is a no-op on Windows
+func Ready() error {
+	return nil
+}
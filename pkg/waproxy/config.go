@@ -0,0 +1,60 @@
+package waproxy
+
+import (
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/config"
+)
+
+// Config is the proxy configuration, as in the YAML config file
+// Its sections are the types below; field names follow the config keys,
+// e.g. Server.Port for server.port.
+type Config = config.Config
+
+// Configuration sections
+type (
+	ServerConfig        = config.ServerConfig
+	FallbackConfig      = config.FallbackConfig
+	UnixSocketConfig    = config.UnixSocketConfig
+	TCPConfig           = config.TCPConfig
+	SOCKS5Config        = config.SOCKS5Config
+	SSLConfig           = config.SSLConfig
+	ClientAuthConfig    = config.ClientAuthConfig
+	ClientAuthRoute     = config.ClientAuthRoute
+	TLSConfig           = config.TLSConfig
+	SessionTicketConfig = config.SessionTicketConfig
+	CertificateEntry    = config.CertificateEntry
+	CAConfig            = config.CAConfig
+	ACMEConfig          = config.ACMEConfig
+	LoggingConfig       = config.LoggingConfig
+	MetricsConfig       = config.MetricsConfig
+	AdminConfig         = config.AdminConfig
+	JabberConfig        = config.JabberConfig
+	JabberRoute         = config.JabberRoute
+	UpstreamConfig      = config.UpstreamConfig
+)
+
+// Change is a setting changed by a reload
+type Change = config.Change
+
+// DefaultConfig returns the default configuration, which New uses when no
+// configuration is given
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// LoadConfig loads and validates configuration like the whatsapp-proxy
+// command does: the config file at path, or the first one found in the
+// standard locations if path is empty, with its includes, conf.d directory
+// and the named profiles, overridden by WHATSAPP_PROXY_* environment
+// variables
+// Secret references such as password_file are resolved. Warnings are
+// logged to the standard logger.
+func LoadConfig(path string, profiles ...string) (*Config, error) {
+	eff, err := config.LoadFile(path, profiles...)
+	if err != nil {
+		return nil, err
+	}
+	if err := eff.Validate(); err != nil {
+		return nil, err
+	}
+	return eff.Config, nil
+}
@@ -0,0 +1,132 @@
+package waproxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/proxy"
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/socks5"
+)
+
+// Dialer opens upstream connections; *net.Dialer implements it
+type Dialer = proxy.Dialer
+
+// Logger receives log lines, each starting with a level such as "[INFO]";
+// *log.Logger implements it
+type Logger = proxy.Logger
+
+// ConnInfo describes a client connection
+type ConnInfo = proxy.ConnInfo
+
+// ConnHook observes client connections and may refuse them
+type ConnHook = proxy.ConnHook
+
+// ConnHookFuncs implements ConnHook with optional functions
+type ConnHookFuncs = proxy.ConnHookFuncs
+
+// MetricsSink receives metric updates as they happen
+type MetricsSink = proxy.MetricsSink
+
+// Option configures a Server
+type Option func(*options)
+
+// options collects the settings of New
+type options struct {
+	config *Config
+	edits  []func(*Config) error
+	proxy  []proxy.Option
+}
+
+// WithConfig sets the configuration, e.g. from LoadConfig
+// Without it, DefaultConfig is used. Options that change settings, such as
+// WithSOCKS5, apply on top of it in order; cfg itself is not modified.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithSOCKS5 sends upstream connections through a SOCKS5 proxy, given as
+// socks5://[user:pass@]host:port
+func WithSOCKS5(proxyURL string) Option {
+	return func(o *options) {
+		o.edits = append(o.edits, func(cfg *Config) error {
+			parsed, err := socks5.ConfigFromURL(proxyURL, cfg.SOCKS5.Timeout)
+			if err != nil {
+				return fmt.Errorf("invalid SOCKS5 proxy URL: %w", err)
+			}
+			host, port, err := net.SplitHostPort(parsed.ProxyAddr)
+			if err != nil {
+				return fmt.Errorf("invalid SOCKS5 proxy URL: %w", err)
+			}
+			cfg.SOCKS5.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return fmt.Errorf("invalid SOCKS5 proxy URL: invalid port %q", port)
+			}
+			cfg.SOCKS5.Enabled = true
+			cfg.SOCKS5.Host = host
+			cfg.SOCKS5.Username = parsed.Username
+			cfg.SOCKS5.Password = parsed.Password
+			return nil
+		})
+	}
+}
+
+// WithLogLevel sets the log level: debug, info, warn or error
+func WithLogLevel(level string) Option {
+	return func(o *options) {
+		o.edits = append(o.edits, func(cfg *Config) error {
+			cfg.Logging.Level = level
+			return nil
+		})
+	}
+}
+
+// WithTLSCertificate serves the certificate and key in the given PEM files
+// instead of an auto-generated one
+func WithTLSCertificate(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.edits = append(o.edits, func(cfg *Config) error {
+			cfg.SSL.AutoGenerate = false
+			cfg.SSL.CertFile = certFile
+			cfg.SSL.KeyFile = keyFile
+			return nil
+		})
+	}
+}
+
+// WithDialer opens upstream connections with dialer: direct connections,
+// connections to the SOCKS5 proxy and to the fallback target
+// The upstream.tcp socket options are not applied to them.
+func WithDialer(dialer Dialer) Option {
+	return func(o *options) {
+		o.proxy = append(o.proxy, proxy.WithDialer(dialer))
+	}
+}
+
+// WithLogger sends the server's log lines to logger instead of the standard
+// logger
+// Certificate management still logs to the standard logger; redirect it
+// with log.SetOutput if needed.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.proxy = append(o.proxy, proxy.WithLogger(logger))
+	}
+}
+
+// WithConnHook adds a connection hook; hooks run in the order added and
+// the first error refuses the connection
+func WithConnHook(hook ConnHook) Option {
+	return func(o *options) {
+		o.proxy = append(o.proxy, proxy.WithConnHook(hook))
+	}
+}
+
+// WithMetricsSink adds a sink receiving every metric update, in addition to
+// the metrics served by Handler
+func WithMetricsSink(sink MetricsSink) Option {
+	return func(o *options) {
+		o.proxy = append(o.proxy, proxy.WithMetricsSink(sink))
+	}
+}
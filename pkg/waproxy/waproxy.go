@@ -0,0 +1,128 @@
+// Package waproxy embeds the WhatsApp proxy in a Go program
+//
+// A Server is built with functional options from a Config, loaded from a
+// file with LoadConfig or assembled in code, and serves any net.Listener:
+//
+//	srv, err := waproxy.New(
+//		waproxy.WithSOCKS5("socks5://127.0.0.1:1080"),
+//		waproxy.WithLogger(logger),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	ln, err := net.Listen("tcp", ":8443")
+//	if err != nil {
+//		return err
+//	}
+//	return srv.Serve(ctx, ln)
+//
+// Dialers, loggers, metrics sinks and connection hooks can be injected to
+// route upstream traffic, collect logs and metrics, and observe or refuse
+// connections.
+package waproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/RevEngine3r/whatsapp-proxy-go/internal/proxy"
+)
+
+// ReloadResult describes the outcome of Reload
+type ReloadResult = proxy.ReloadResult
+
+// ShutdownError reports connections forcibly closed during shutdown
+type ShutdownError = proxy.ShutdownError
+
+// Server is an embedded proxy server
+type Server struct {
+	proxy *proxy.Server
+}
+
+// New creates a server
+// The configuration is validated; certificates are loaded or generated
+// before New returns. Nothing listens until Serve or ListenAndServe.
+func New(opts ...Option) (*Server, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg := DefaultConfig()
+	if o.config != nil {
+		copied := *o.config
+		cfg = &copied
+	}
+	for _, edit := range o.edits {
+		if err := edit(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	server, err := proxy.New(cfg, o.proxy...)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{proxy: server}, nil
+}
+
+// Serve accepts connections on listener until ctx is canceled, then shuts
+// down gracefully within server.shutdown_timeout
+// It returns a *ShutdownError if connections had to be closed forcibly, and
+// nil right away if Shutdown is called. Serve may be called only once.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	return s.proxy.Serve(ctx, listener)
+}
+
+// ListenAndServe listens on server.unix_socket.path if set, else on
+// server.bind_addr and server.port, and serves like Serve
+// The Unix socket gets the configured mode and ownership and is removed at
+// shutdown.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	return s.proxy.ListenAndServe(ctx)
+}
+
+// Shutdown stops accepting connections, waits for active ones to finish
+// within server.drain_timeout or until ctx expires, then closes the rest
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.proxy.Shutdown(ctx)
+}
+
+// Reload applies a new configuration to the running server
+// Listener and metrics settings are reported as pending and keep their
+// running values. An invalid configuration leaves the server unchanged.
+func (s *Server) Reload(cfg *Config) (*ReloadResult, error) {
+	return s.proxy.Reload(cfg)
+}
+
+// Config returns the running configuration, which must not be modified
+func (s *Server) Config() *Config {
+	return s.proxy.Config()
+}
+
+// Handler serves the metrics endpoint: /metrics, /health, /certificates
+// and, if admin.enabled is set, the admin API under /admin/
+// Mount it on an HTTP server of your own; Serve does not open one.
+func (s *Server) Handler() http.Handler {
+	return s.proxy.Handler()
+}
+
+// Connections returns the active client connections
+func (s *Server) Connections() []ConnInfo {
+	return s.proxy.Connections()
+}
+
+// KillConnection closes the client connection with the given ID
+func (s *Server) KillConnection(id uint64) error {
+	return s.proxy.KillConnection(id)
+}
+
+// SetLogLevel changes the log level at runtime
+func (s *Server) SetLogLevel(level string) error {
+	return s.proxy.SetLogLevel(level)
+}
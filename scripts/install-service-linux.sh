@@ -95,8 +95,14 @@ echo -e "${GREEN}  ✓ Permissions set${NC}"
 # Install systemd service
 echo -e "${YELLOW}Installing systemd service...${NC}"
 cp systemd/whatsapp-proxy.service /etc/systemd/system/
+for socket in systemd/whatsapp-proxy.socket systemd/whatsapp-proxy-metrics.socket; do
+    if [ -f "$socket" ]; then
+        cp "$socket" /etc/systemd/system/
+    fi
+done
 systemctl daemon-reload
 echo -e "${GREEN}  ✓ Service installed${NC}"
+echo -e "${YELLOW}  → Socket activation units installed but not enabled${NC}"
 
 # Enable and start service
 echo -e "${YELLOW}Enabling service...${NC}"
@@ -113,6 +119,8 @@ echo -e "  ${BLUE}Start:${NC}   sudo systemctl start whatsapp-proxy"
 echo -e "  ${BLUE}Stop:${NC}    sudo systemctl stop whatsapp-proxy"
 echo -e "  ${BLUE}Status:${NC}  sudo systemctl status whatsapp-proxy"
 echo -e "  ${BLUE}Logs:${NC}    sudo journalctl -u whatsapp-proxy -f"
+echo -e "  ${BLUE}Reload:${NC}  sudo systemctl reload whatsapp-proxy  (zero-downtime restart)"
+echo -e "  ${BLUE}Sockets:${NC} sudo systemctl enable --now whatsapp-proxy.socket whatsapp-proxy-metrics.socket"
 echo ""
 echo -e "${YELLOW}Configuration:${NC} $CONFIG_DIR/config.yaml"
 echo ""
@@ -37,6 +37,15 @@ if systemctl is-enabled --quiet "$SERVICE_NAME" 2>/dev/null; then
     echo -e "${GREEN}  ✓ Service disabled${NC}"
 fi
 
+# Stop, disable and remove socket units
+for socket in "$SERVICE_NAME.socket" "$SERVICE_NAME-metrics.socket"; do
+    if [ -f "/etc/systemd/system/$socket" ]; then
+        systemctl disable --now "$socket" 2>/dev/null || true
+        rm "/etc/systemd/system/$socket"
+        echo -e "${GREEN}  ✓ Socket unit removed: $socket${NC}"
+    fi
+done
+
 # Remove service file
 if [ -f "/etc/systemd/system/$SERVICE_NAME.service" ]; then
     echo -e "${YELLOW}Removing service file...${NC}"